@@ -5,12 +5,44 @@ package authorization
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	jo "github.com/sassoftware/sas-viya-authorization-model/journal"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
 	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
+// ManagedDescription is the description of authorization rules enabled by goViyaAuth
+const ManagedDescription = "Automatically enabled by goViyaAuth"
+
+// ErrMissingURI is returned when an authorization rule has neither a container nor an object URI
+var ErrMissingURI = errors.New("either a Container or Object URI needs to be provided")
+
+// ErrInvalidType is returned when an authorization rule is neither a grant nor a prohibit
+var ErrInvalidType = errors.New("type needs to be grant or prohibit")
+
+// States of an authorization rule compared with the existing rules
+const (
+	Identical = "identical"
+	Differs   = "differs"
+	Missing   = "missing"
+)
+
+// Comparison of an authorization rule with the existing rules of the same type for the same principal on the same
+// target. IDs lists the existing rules, the closest one first, and Differences the attributes in which it differs
+type Comparison struct {
+	State       string
+	IDs         []string
+	Differences []string
+}
+
 // Authorization object for SAS Viya endpoint
 type Authorization struct {
 	Condition           string
@@ -32,32 +64,129 @@ type Authorization struct {
 }
 
 // Enable authorization rule
-func (a *Authorization) Enable() {
-	zap.S().Debugw("Enabling authorization rule", "containerUri", a.ContainerURI, "objectUri", a.ObjectURI)
-	body, _ := json.Marshal(map[string]interface{}{
-		"permissions":   a.Permissions,
-		"principal":     a.Principal.ID,
-		"principalType": a.Principal.Type,
-		"type":          a.Type,
-		"enabled":       a.Enabled,
-		"description":   a.Description,
-		"containerUri":  a.ContainerURI,
-		"objectUri":     a.ObjectURI,
-	})
-	a.Principal.Connection.Call("POST", "/authorization/rules", "application/vnd.sas.authorization.rule+json", "", nil, body)
+func (a *Authorization) Enable() error {
+	zap.S().Debugw("Enabling authorization rule", "containerUri", a.ContainerURI, "objectUri", a.ObjectURI, "type", a.Type)
+	rule := a.body()
+	attributes := map[string]interface{}{
+		"type":        a.Type,
+		"permissions": a.Permissions,
+	}
+	for name, value := range a.options() {
+		if value != "" {
+			attributes[name] = value
+		}
+	}
+	body, err := json.Marshal(rule)
+	if err != nil {
+		return fmt.Errorf("encoding authorization rule for %s: %w", a.target(), err)
+	}
+	if a.Principal.Connection.Plan != nil {
+		a.Principal.Connection.Plan.Add("create", "rule", a.target(), attributes)
+		return nil
+	}
+	response, _, err := a.Principal.Connection.Call("POST", "/authorization/rules", "application/vnd.sas.authorization.rule+json", "", nil, body)
+	if err != nil {
+		return fmt.Errorf("enabling authorization rule for %s: %w", a.target(), err)
+	}
+	// the rule can only be reverted if SAS Viya returned its ID
+	var inverse *jo.Request
+	result, _ := response.(map[string]interface{})
+	if id, ok := result["id"].(string); ok {
+		inverse = &jo.Request{Action: "delete", Method: "DELETE", Path: "/authorization/rules/" + id}
+	}
+	return a.Principal.Connection.Record("create", "rule", a.target(), inverse)
 }
 
-// Validate authorization rule
-func (a *Authorization) Validate() {
-	zap.S().Debugw("Validating authorization rule", "containerUri", a.ContainerURI, "objectUri", a.ObjectURI)
+// Update the existing authorization rule in place with the permissions, description and options of the rule, so that
+// access is not interrupted and the rule keeps its ID and history. The ETag of the existing rule is sent as If-Match,
+// so that a concurrent change is not overwritten. Further existing rules are duplicates and deleted. Without an
+// existing rule the rule is enabled
+func (a *Authorization) Update() error {
+	if len(a.IDs) == 0 {
+		return a.Enable()
+	}
+	var id string = a.IDs[0]
+	zap.S().Debugw("Updating existing authorization rule", "id", id)
+	response, header, _, err := a.Principal.Connection.CallWithHeader("GET", "/authorization/rules/"+id, "", "", nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("reading authorization rule %s for %s: %w", id, a.target(), err)
+	}
+	current, ok := response.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("reading authorization rule %s for %s: %w", id, a.target(), co.ErrUnexpectedResponse)
+	}
+	previous, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("encoding authorization rule %s for %s: %w", id, a.target(), err)
+	}
+	if changes := a.update(current); len(changes) == 0 {
+		zap.S().Debugw("Authorization rule is up to date", "id", id)
+	} else if a.Principal.Connection.Plan != nil {
+		changes["id"] = id
+		a.Principal.Connection.Plan.Add("update", "rule", a.target(), changes)
+	} else {
+		body, err := json.Marshal(current)
+		if err != nil {
+			return fmt.Errorf("encoding authorization rule %s for %s: %w", id, a.target(), err)
+		}
+		var ifMatch http.Header
+		if etag := header.Get("ETag"); etag != "" {
+			ifMatch = http.Header{"If-Match": []string{etag}}
+		}
+		if _, _, _, err := a.Principal.Connection.CallWithHeader("PUT", "/authorization/rules/"+id, "application/vnd.sas.authorization.rule+json", "", nil, body, ifMatch); err != nil {
+			if co.IsStatus(err, http.StatusPreconditionFailed) {
+				return fmt.Errorf("updating authorization rule %s for %s, which was changed concurrently: %w", id, a.target(), err)
+			}
+			return fmt.Errorf("updating authorization rule %s for %s: %w", id, a.target(), err)
+		}
+		if err := a.Principal.Connection.Record("update", "rule", a.target(), &jo.Request{Action: "update", Method: "PUT", Path: "/authorization/rules/" + id, ContentType: "application/vnd.sas.authorization.rule+json", IfMatch: true, Body: previous}); err != nil {
+			return err
+		}
+	}
+	if len(a.IDs) > 1 {
+		duplicates := *a
+		duplicates.IDs = a.IDs[1:]
+		if err := duplicates.Delete(); err != nil {
+			return err
+		}
+	}
+	a.IDs = []string{id}
+	return nil
+}
+
+// Validate authorization rule, i.e. find the existing rules of the same type for the same principal on the same target
+func (a *Authorization) Validate() error {
+	_, err := a.Compare()
+	return err
+}
+
+// Compare the authorization rule with the existing rules of the same type for the same principal on the same target.
+// The IDs of these rules are set, the closest one first. A rule is identical if it also has the same permissions,
+// condition, media type, expiration and enabled state
+func (a *Authorization) Compare() (Comparison, error) {
+	zap.S().Debugw("Validating authorization rule", "containerUri", a.ContainerURI, "objectUri", a.ObjectURI, "type", a.Type)
+	var comparison Comparison = Comparison{State: Missing}
+	if a.Type != "" && a.Type != "grant" && a.Type != "prohibit" {
+		return comparison, fmt.Errorf("validating authorization rule for %s: %w", a.target(), ErrInvalidType)
+	}
+	if a.ExpirationTimeStamp != "" {
+		if _, err := time.Parse(time.RFC3339, a.ExpirationTimeStamp); err != nil {
+			return comparison, fmt.Errorf("validating authorization rule for %s: invalid expiration timestamp: %w", a.target(), err)
+		}
+	}
+	if pl.IsPending(a.ContainerURI) || pl.IsPending(a.ObjectURI) {
+		zap.S().Debugw("Authorization rule does not exist as its target is only created by the plan")
+		a.IDs = nil
+		return comparison, nil
+	}
 	var filter string
-	if a.Principal.Type == "group" {
+	if a.Principal.Type == "group" || a.Principal.Type == "user" {
 		if a.ContainerURI != "" {
 			filter = "and(eq(principal,'" + a.Principal.ID + "'),eq(containerUri,'" + a.ContainerURI + "'))"
 		} else if a.ObjectURI != "" {
 			filter = "and(eq(principal,'" + a.Principal.ID + "'),eq(objectUri,'" + a.ObjectURI + "'))"
 		} else {
-			zap.S().Fatalw("Either a Container or Object URI needs to be provided", "ContainerURI", a.ContainerURI, "ObjectURI", a.ObjectURI)
+			return comparison, ErrMissingURI
 		}
 	} else {
 		if a.ContainerURI != "" {
@@ -67,36 +196,373 @@ func (a *Authorization) Validate() {
 		} else if a.EveryURI {
 			filter = "eq(principalType,'" + a.Principal.Type + "')"
 		} else {
-			zap.S().Fatalw("Either a Container or Object URI needs to be provided", "ContainerURI", a.ContainerURI, "ObjectURI", a.ObjectURI)
+			return comparison, ErrMissingURI
 		}
 	}
-	search, _ := a.Principal.Connection.Call("GET", "/authorization/rules", "", "", [][]string{
+	// a grant and a prohibit of the same principal on the same URI are separate rules
+	if a.Type != "" {
+		filter = "and(" + filter + ",eq(type,'" + a.Type + "'))"
+	}
+	rules := a.Principal.Connection.Collection("/authorization/rules", [][]string{
 		0: {
 			"filter",
 			filter,
 		},
 		1: {
 			"limit",
-			viper.GetString("responselimit"),
+			a.Principal.Connection.ResponseLimit(),
 		},
-	}, nil)
-	if search.(map[string]interface{})["count"] == "0" {
+	})
+	a.IDs = nil
+	var differences [][]string
+	for rules.Next() {
+		existing, err := parse(rules.Item(), a.Principal.Connection)
+		if err != nil {
+			return comparison, fmt.Errorf("validating authorization rule for %s: %w", a.target(), err)
+		}
+		// the principal type and ID are checked as well, as a group and a user may share an ID
+		if existing.Principal.Type != a.Principal.Type || (a.Type != "" && existing.Type != a.Type) {
+			continue
+		}
+		if (a.Principal.Type == "group" || a.Principal.Type == "user") && existing.Principal.ID != a.Principal.ID {
+			continue
+		}
+		zap.S().Debugw("Authorization rule exists", "id", existing.IDs[0])
+		a.IDs = append(a.IDs, existing.IDs[0])
+		differences = append(differences, a.differences(existing))
+	}
+	if err := rules.Err(); err != nil {
+		return comparison, fmt.Errorf("validating authorization rule for %s: %w", a.target(), err)
+	}
+	if a.IDs == nil {
 		zap.S().Debugw("Authorization rule does not exist")
-		a.IDs = nil
+		return comparison, nil
+	}
+	// the closest existing rule comes first, so that it is the one updated in place
+	order := make([]int, len(a.IDs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(differences[order[i]]) < len(differences[order[j]])
+	})
+	var ids []string
+	for _, i := range order {
+		ids = append(ids, a.IDs[i])
+	}
+	a.IDs = ids
+	comparison.IDs = ids
+	comparison.Differences = differences[order[0]]
+	if len(comparison.Differences) == 0 {
+		comparison.State = Identical
 	} else {
-		for _, rule := range search.(map[string]interface{})["items"].([]interface{}) {
-			var id string = rule.(map[string]interface{})["id"].(string)
-			zap.S().Debugw("Authorization rule exists", "id", id)
-			a.IDs = append(a.IDs, id)
-		}
+		comparison.State = Differs
+		zap.S().Debugw("Authorization rule differs", "id", ids[0], "differences", comparison.Differences)
 	}
+	return comparison, nil
 }
 
 // Delete authorization rule
-func (a *Authorization) Delete() {
-	for _, id := range a.IDs {
+func (a *Authorization) Delete() error {
+	for i, id := range a.IDs {
 		zap.S().Debugw("Removing existing authorization rule", "id", id)
-		a.Principal.Connection.Call("DELETE", "/authorization/rules/"+id, "", "", nil, nil)
+		if a.Principal.Connection.Plan != nil {
+			a.Principal.Connection.Plan.Add("delete", "rule", a.target(), map[string]interface{}{"id": id})
+			continue
+		}
+		// the rule is read before it is deleted, so that the journal can create it again
+		var inverse *jo.Request
+		if a.Principal.Connection.Journal != nil {
+			existing, err := a.read(id)
+			if err != nil {
+				a.IDs = a.IDs[i:]
+				return err
+			}
+			body, err := json.Marshal(existing.body())
+			if err != nil {
+				a.IDs = a.IDs[i:]
+				return fmt.Errorf("encoding authorization rule %s for %s: %w", id, a.target(), err)
+			}
+			inverse = &jo.Request{Action: "create", Method: "POST", Path: "/authorization/rules", ContentType: "application/vnd.sas.authorization.rule+json", Body: body, Replaces: id}
+		}
+		if _, _, err := a.Principal.Connection.Call("DELETE", "/authorization/rules/"+id, "", "", nil, nil); err != nil {
+			a.IDs = a.IDs[i:]
+			return fmt.Errorf("deleting authorization rule %s for %s: %w", id, a.target(), err)
+		}
+		if err := a.Principal.Connection.Record("delete", "rule", a.target(), inverse); err != nil {
+			a.IDs = a.IDs[i+1:]
+			return err
+		}
 	}
 	a.IDs = nil
+	return nil
+}
+
+// List all authorization rules matching a filter (or all rules for an empty filter), each as an Authorization with its single ID
+func List(connection *co.Connection, filter string) ([]*Authorization, error) {
+	zap.S().Debugw("Listing authorization rules", "filter", filter)
+	var list []*Authorization
+	if pl.IsPending(filter) {
+		return list, nil
+	}
+	var query [][]string = [][]string{
+		0: {
+			"limit",
+			connection.ResponseLimit(),
+		},
+	}
+	if filter != "" {
+		query = append(query, []string{"filter", filter})
+	}
+	rules := connection.Collection("/authorization/rules", query)
+	for rules.Next() {
+		a, err := parse(rules.Item(), connection)
+		if err != nil {
+			return nil, fmt.Errorf("listing authorization rules: %w", err)
+		}
+		list = append(list, a)
+	}
+	if err := rules.Err(); err != nil {
+		return nil, fmt.Errorf("listing authorization rules: %w", err)
+	}
+	return list, nil
+}
+
+// Decisions asks SAS Viya to explain the effective access of a user to a URI and returns the result of each permission,
+// e.g. grant or prohibit
+func Decisions(connection *co.Connection, user, uri string) (map[string]string, error) {
+	zap.S().Debugw("Requesting authorization decisions", "user", user, "uri", uri)
+	response, _, err := connection.Call("GET", "/authorization/decisions", "", "application/vnd.sas.authorization.explanations+json", [][]string{
+		0: {
+			"resourceUri",
+			uri,
+		},
+		1: {
+			"principal",
+			user,
+		},
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("requesting authorization decisions of %s on %s: %w", user, uri, err)
+	}
+	result, _ := response.(map[string]interface{})
+	explanations, ok := result["explanations"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("requesting authorization decisions of %s on %s: %w", user, uri, co.ErrUnexpectedResponse)
+	}
+	// the explanation of the user itself is used, or the only one if SAS Viya does not name the principal
+	var explanation map[string]interface{}
+	for _, item := range explanations {
+		e, _ := item.(map[string]interface{})
+		principal, _ := e["principal"].(map[string]interface{})
+		if name, _ := principal["name"].(string); name == user || len(explanations) == 1 {
+			explanation = e
+		}
+	}
+	if explanation == nil {
+		return nil, fmt.Errorf("requesting authorization decisions of %s on %s: %w", user, uri, co.ErrUnexpectedResponse)
+	}
+	decisions := make(map[string]string)
+	for permission, value := range explanation {
+		if decision, ok := value.(map[string]interface{}); ok {
+			if result, ok := decision["result"].(string); ok {
+				decisions[permission] = result
+			}
+		}
+	}
+	return decisions, nil
+}
+
+// read an existing authorization rule by its ID
+func (a *Authorization) read(id string) (*Authorization, error) {
+	response, _, err := a.Principal.Connection.Call("GET", "/authorization/rules/"+id, "", "", nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading authorization rule %s for %s: %w", id, a.target(), err)
+	}
+	item, _ := response.(map[string]interface{})
+	existing, err := parse(item, a.Principal.Connection)
+	if err != nil {
+		return nil, fmt.Errorf("reading authorization rule %s for %s: %w", id, a.target(), err)
+	}
+	return existing, nil
+}
+
+// parse an authorization rule returned by SAS Viya into an Authorization with its single ID
+func parse(item map[string]interface{}, connection *co.Connection) (*Authorization, error) {
+	id, ok := item["id"].(string)
+	if !ok {
+		return nil, co.ErrUnexpectedResponse
+	}
+	a := new(Authorization)
+	a.IDs = []string{id}
+	a.Principal = new(pr.Principal)
+	a.Principal.ID, _ = item["principal"].(string)
+	a.Principal.Type, _ = item["principalType"].(string)
+	a.Principal.Connection = connection
+	a.Type, _ = item["type"].(string)
+	a.ContainerURI, _ = item["containerUri"].(string)
+	a.ObjectURI, _ = item["objectUri"].(string)
+	a.Description, _ = item["description"].(string)
+	a.Condition, _ = item["condition"].(string)
+	a.MediaType, _ = item["mediaType"].(string)
+	a.Reason, _ = item["reason"].(string)
+	a.ExpirationTimeStamp, _ = item["expirationTimestamp"].(string)
+	if enabled, ok := item["enabled"].(bool); ok {
+		a.Enabled = fmt.Sprint(enabled)
+	}
+	permissions, _ := item["permissions"].([]interface{})
+	for _, permission := range permissions {
+		a.Permissions = append(a.Permissions, fmt.Sprint(permission))
+	}
+	return a, nil
+}
+
+// Equal reports whether two authorization rules grant or prohibit the same permissions to the same principal on the same
+// target with the same condition, media type, expiration and, if set, enabled state
+func (a *Authorization) Equal(b *Authorization) bool {
+	return a.Same(b) && len(a.differences(b)) == 0
+}
+
+// Same reports whether two authorization rules are of the same type for the same principal on the same target, so that
+// one can be updated in place to the other
+func (a *Authorization) Same(b *Authorization) bool {
+	if a.Principal.Type != b.Principal.Type || a.Type != b.Type || a.ContainerURI != b.ContainerURI || a.ObjectURI != b.ObjectURI {
+		return false
+	}
+	return (a.Principal.Type != "group" && a.Principal.Type != "user") || a.Principal.ID == b.Principal.ID
+}
+
+// differences returns the attributes in which an existing authorization rule differs from the rule. The enabled state
+// is only compared if the rule sets it
+func (a *Authorization) differences(existing *Authorization) []string {
+	var differences []string
+	if permissionSet(a.Permissions) != permissionSet(existing.Permissions) {
+		differences = append(differences, "permissions")
+	}
+	if a.Condition != existing.Condition {
+		differences = append(differences, "condition")
+	}
+	if a.MediaType != existing.MediaType {
+		differences = append(differences, "mediaType")
+	}
+	if !sameTime(a.ExpirationTimeStamp, existing.ExpirationTimeStamp) {
+		differences = append(differences, "expirationTimestamp")
+	}
+	if a.Enabled != "" && a.Enabled != existing.Enabled {
+		differences = append(differences, "enabled")
+	}
+	return differences
+}
+
+// Managed reports whether an authorization rule was enabled by goViyaAuth
+func (a *Authorization) Managed() bool {
+	return a.Description == ManagedDescription
+}
+
+// Capability reports whether an authorization rule is on a capability URI, i.e. an object URI outside of the folders
+// that IPAPs are applied to
+func (a *Authorization) Capability() bool {
+	return a.ObjectURI != "" && a.ContainerURI == "" && !strings.HasPrefix(a.ObjectURI, "/folders/")
+}
+
+// body returns the attributes of the authorization rule sent to SAS Viya. The options are only sent when set, so that
+// SAS Viya applies its defaults
+func (a *Authorization) body() map[string]interface{} {
+	rule := map[string]interface{}{
+		"permissions":   a.Permissions,
+		"principal":     a.Principal.ID,
+		"principalType": a.Principal.Type,
+		"type":          a.Type,
+		"enabled":       a.Enabled,
+		"description":   a.Description,
+		"containerUri":  a.ContainerURI,
+		"objectUri":     a.ObjectURI,
+	}
+	for name, value := range a.options() {
+		if value != "" {
+			rule[name] = value
+		}
+	}
+	return rule
+}
+
+// options returns the optional attributes of the authorization rule by name
+func (a *Authorization) options() map[string]string {
+	return map[string]string{
+		"condition":           a.Condition,
+		"filter":              a.Filter,
+		"mediaType":           a.MediaType,
+		"expirationTimestamp": a.ExpirationTimeStamp,
+		"reason":              a.Reason,
+	}
+}
+
+// update sets the permissions, description, enabled state and options of an existing rule as returned by SAS Viya to
+// those of the authorization rule and returns the changed attributes with their new values. The principal, type and
+// URIs identify the rule and are kept
+func (a *Authorization) update(current map[string]interface{}) map[string]interface{} {
+	changes := make(map[string]interface{})
+	var permissions []string
+	existing, _ := current["permissions"].([]interface{})
+	for _, permission := range existing {
+		permissions = append(permissions, fmt.Sprint(permission))
+	}
+	if permissionSet(permissions) != permissionSet(a.Permissions) {
+		current["permissions"] = a.Permissions
+		changes["permissions"] = a.Permissions
+	}
+	if description, _ := current["description"].(string); description != a.Description {
+		current["description"] = a.Description
+		changes["description"] = a.Description
+	}
+	if enabled, exists := current["enabled"]; a.Enabled != "" && (!exists || fmt.Sprint(enabled) != a.Enabled) {
+		current["enabled"] = a.Enabled == "true"
+		changes["enabled"] = a.Enabled
+	}
+	for name, value := range a.options() {
+		existing, _ := current[name].(string)
+		if existing == value || (name == "expirationTimestamp" && value != "" && sameTime(existing, value)) {
+			continue
+		}
+		if value == "" {
+			delete(current, name)
+		} else {
+			current[name] = value
+		}
+		changes[name] = value
+	}
+	return changes
+}
+
+// sameTime reports whether two timestamps denote the same instant, e.g. with and without fractional seconds. Timestamps
+// that cannot be parsed need to be identical
+func sameTime(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ta, errA := time.Parse(time.RFC3339, a)
+	tb, errB := time.Parse(time.RFC3339, b)
+	return errA == nil && errB == nil && ta.Equal(tb)
+}
+
+// permissionSet returns a canonical representation of permissions irrespective of their order
+func permissionSet(permissions []string) string {
+	var sorted []string
+	for _, permission := range permissions {
+		sorted = append(sorted, strings.TrimSpace(permission))
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// target describes the principal and URI an authorization rule applies to
+func (a *Authorization) target() string {
+	var principal string = a.Principal.ID
+	if a.Principal.Type != "group" && a.Principal.Type != "user" {
+		principal = a.Principal.Type
+	}
+	if a.ContainerURI != "" {
+		return principal + " on container " + a.ContainerURI
+	}
+	return principal + " on " + a.ObjectURI
 }
@@ -4,13 +4,17 @@
 package authorization
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
 	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
 )
 
@@ -46,11 +50,64 @@ func TestEnable(t *testing.T) {
 	a.Enable()
 }
 
+func TestEnableOptions(t *testing.T) {
+	expBody := []byte(`{"condition":"#resource.name.startsWith('HR')","containerUri":"testuri","description":"Automatically enabled by goViyaAuth","enabled":"true","expirationTimestamp":"2021-12-31T23:59:59Z","mediaType":"application/vnd.sas.report","objectUri":"","permissions":["read"],"principal":"testgroup","principalType":"group","reason":"Contractor access","type":"prohibit"}`)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+		actBody, _ := ioutil.ReadAll(req.Body)
+		if !reflect.DeepEqual(expBody, actBody) {
+			t.Errorf("Expected: %v, Returned: %v.", string(expBody), string(actBody))
+		}
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.Connected = true
+	a := new(Authorization)
+	a.Principal = &pr.Principal{ID: "testgroup", Type: "group", Connection: co}
+	a.Permissions = []string{"read"}
+	a.Type = "prohibit"
+	a.Enabled = "true"
+	a.Description = ManagedDescription
+	a.ContainerURI = "testuri"
+	a.Condition = "#resource.name.startsWith('HR')"
+	a.MediaType = "application/vnd.sas.report"
+	a.ExpirationTimeStamp = "2021-12-31T23:59:59Z"
+	a.Reason = "Contractor access"
+	if err := a.Enable(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	a.Type = "deny"
+	if err := a.Validate(); !errors.Is(err, ErrInvalidType) {
+		t.Errorf("Expected: %v, Returned: %v.", ErrInvalidType, err)
+	}
+	a.Type = "prohibit"
+	a.ExpirationTimeStamp = "31.12.2021"
+	if err := a.Validate(); err == nil {
+		t.Errorf("Expected: %v, Returned: %v.", "invalid expiration timestamp", err)
+	}
+	b := *a
+	a.ExpirationTimeStamp = "2021-12-31T23:59:59Z"
+	b.ExpirationTimeStamp = "2021-12-31T23:59:59.000Z"
+	if !a.Equal(&b) {
+		t.Errorf("Expected: %v, Returned: %v.", true, a.Equal(&b))
+	}
+	b.Type = "grant"
+	if a.Equal(&b) {
+		t.Errorf("Expected: %v, Returned: %v.", false, a.Equal(&b))
+	}
+}
+
 func TestValidate(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		rw.WriteHeader(http.StatusOK)
 		rw.Header().Set("Content-Type", "application/json")
-		rw.Write([]byte(`{"accept":"application/vnd.sas.authorization.rule+json","count":1,"items":[{"createdBy":"geladm","createdTimestamp":"2020-05-06T06:46:39.933Z","creationTimeStamp":"2020-05-06T06:46:39.933Z","description":"Automatically created by goViyaAuth","enabled":true,"id":"a9ce98d4-90be-4e98-8a05-752f190d5255","links":[{"href":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255","method":"GET","rel":"self","responseType":"application/vnd.sas.authorization.rule","uri":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255"},{"href":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255","method":"PUT","rel":"update","responseType":"application/vnd.sas.authorization.rule","type":"application/vnd.sas.authorization.rule","uri":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255"},{"href":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255","method":"DELETE","rel":"delete","uri":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255"}],"matchParams":false,"modifiedBy":"geladm","modifiedTimeStamp":"2020-05-06T06:46:39.933Z","modifiedTimestamp":"2020-05-06T06:46:39.933Z","objectUri":"/SASEnvironmentManager/dashboard","permissions":["delete","update","read"],"principal":"HRModelers","principalType":"group","type":"grant","version":10}],"limit":1000,"links":[{"href":"/authorization/rules?filter=and(eq(principal,'HRModelers'),startsWith(objectUri,'/SASEnvironmentManager/dashboard'))&start=0&limit=1000","method":"GET","rel":"self","type":"application/vnd.sas.collection","uri":"/authorization/rules?filter=and(eq(principal,'HRModelers'),startsWith(objectUri,'/SASEnvironmentManager/dashboard'))&start=0&limit=1000"},{"href":"/authorization/rules","method":"GET","rel":"collection","type":"application/vnd.sas.collection","uri":"/authorization/rules"}],"name":"rules","start":0,"version":2}`))
+		var principal string = `"principalType":"authentiatedUsers"`
+		if strings.Contains(req.URL.Query().Get("filter"), "eq(principal,'testgroup')") {
+			principal = `"principal":"testgroup","principalType":"group"`
+		}
+		rw.Write([]byte(fmt.Sprintf(`{"accept":"application/vnd.sas.authorization.rule+json","count":1,"items":[{"createdBy":"geladm","createdTimestamp":"2020-05-06T06:46:39.933Z","creationTimeStamp":"2020-05-06T06:46:39.933Z","description":"Automatically created by goViyaAuth","enabled":true,"id":"a9ce98d4-90be-4e98-8a05-752f190d5255","links":[{"href":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255","method":"GET","rel":"self","responseType":"application/vnd.sas.authorization.rule","uri":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255"},{"href":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255","method":"PUT","rel":"update","responseType":"application/vnd.sas.authorization.rule","type":"application/vnd.sas.authorization.rule","uri":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255"},{"href":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255","method":"DELETE","rel":"delete","uri":"/authorization/rules/a9ce98d4-90be-4e98-8a05-752f190d5255"}],"matchParams":false,"modifiedBy":"geladm","modifiedTimeStamp":"2020-05-06T06:46:39.933Z","modifiedTimestamp":"2020-05-06T06:46:39.933Z","objectUri":"/SASEnvironmentManager/dashboard","permissions":["delete","update","read"],%s,"type":"grant","version":10}],"limit":1000,"links":[{"href":"/authorization/rules?filter=and(eq(principal,'HRModelers'),startsWith(objectUri,'/SASEnvironmentManager/dashboard'))&start=0&limit=1000","method":"GET","rel":"self","type":"application/vnd.sas.collection","uri":"/authorization/rules?filter=and(eq(principal,'HRModelers'),startsWith(objectUri,'/SASEnvironmentManager/dashboard'))&start=0&limit=1000"},{"href":"/authorization/rules","method":"GET","rel":"collection","type":"application/vnd.sas.collection","uri":"/authorization/rules"}],"name":"rules","start":0,"version":2}`, principal)))
 
 	}))
 	defer server.Close()
@@ -149,3 +206,158 @@ func TestDelete(t *testing.T) {
 		t.Errorf("Expected: %v, Returned: %v.", nil, a.IDs)
 	}
 }
+
+func TestList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(`{"count": 2, "items": [{"id": "rule1", "principal": "testgroup", "principalType": "group", "type": "grant", "permissions": ["read", "update"], "containerUri": "/folders/folders/1", "description": "Automatically enabled by goViyaAuth", "enabled": true}, {"id": "rule2", "principalType": "authenticatedUsers", "type": "grant", "permissions": ["read"], "objectUri": "/folders/folders/1/**", "enabled": true}]}`))
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.Connected = true
+	rules, err := List(co, "eq(containerUri,'/folders/folders/1')")
+	if err != nil || len(rules) != 2 {
+		t.Fatalf("Expected: %v, Returned: %v (%v).", 2, len(rules), err)
+	}
+	if !rules[0].Managed() || rules[1].Managed() {
+		t.Errorf("Expected: %v, Returned: %v.", []bool{true, false}, []bool{rules[0].Managed(), rules[1].Managed()})
+	}
+	target := &Authorization{
+		Principal:    &pr.Principal{ID: "testgroup", Type: "group"},
+		Type:         "grant",
+		Permissions:  []string{"update", "read"},
+		ContainerURI: "/folders/folders/1",
+	}
+	if !target.Equal(rules[0]) {
+		t.Errorf("Expected: %v, Returned: %v.", true, target.Equal(rules[0]))
+	}
+	target.Permissions = []string{"read"}
+	if target.Equal(rules[0]) {
+		t.Errorf("Expected: %v, Returned: %v.", false, target.Equal(rules[0]))
+	}
+	everyone := &Authorization{
+		Principal:   &pr.Principal{ID: "authenticatedUsers", Type: "authenticatedUsers"},
+		Type:        "grant",
+		Permissions: []string{"read"},
+		ObjectURI:   "/folders/folders/1/**",
+	}
+	if !everyone.Equal(rules[1]) || !reflect.DeepEqual(rules[1].IDs, []string{"rule2"}) {
+		t.Errorf("Expected: %v, Returned: %v.", []string{"rule2"}, rules[1].IDs)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	var requests []string
+	expBody := []byte(`{"containerUri":"/folders/folders/1","description":"Automatically enabled by goViyaAuth","enabled":true,"id":"rule1","permissions":["read","update","delete"],"principal":"testgroup","principalType":"group","type":"grant","version":3}`)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		rw.Header().Set("Content-Type", "application/json")
+		switch req.Method {
+		case "GET":
+			rw.Header().Set("ETag", `"etag1"`)
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte(`{"id": "rule1", "principal": "testgroup", "principalType": "group", "type": "grant", "permissions": ["read"], "containerUri": "/folders/folders/1", "description": "Automatically enabled by goViyaAuth", "enabled": true, "version": 3}`))
+		case "PUT":
+			if req.Header.Get("If-Match") != `"etag1"` {
+				t.Errorf("Expected: %v, Returned: %v.", `"etag1"`, req.Header.Get("If-Match"))
+			}
+			actBody, _ := ioutil.ReadAll(req.Body)
+			if !reflect.DeepEqual(expBody, actBody) {
+				t.Errorf("Expected: %v, Returned: %v.", string(expBody), string(actBody))
+			}
+			rw.WriteHeader(http.StatusOK)
+		default:
+			rw.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.Connected = true
+	a := new(Authorization)
+	a.Principal = &pr.Principal{ID: "testgroup", Type: "group", Connection: co}
+	a.Type = "grant"
+	a.Enabled = "true"
+	a.Description = ManagedDescription
+	a.Permissions = []string{"read", "update", "delete"}
+	a.ContainerURI = "/folders/folders/1"
+	a.IDs = []string{"rule1", "rule2"}
+	if err := a.Update(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	expected := []string{"GET /authorization/rules/rule1", "PUT /authorization/rules/rule1", "DELETE /authorization/rules/rule2"}
+	if !reflect.DeepEqual(expected, requests) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, requests)
+	}
+	if !reflect.DeepEqual(a.IDs, []string{"rule1"}) {
+		t.Errorf("Expected: %v, Returned: %v.", []string{"rule1"}, a.IDs)
+	}
+	requests = nil
+	a.Permissions = []string{"read"}
+	if err := a.Update(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if !reflect.DeepEqual([]string{"GET /authorization/rules/rule1"}, requests) {
+		t.Errorf("Expected: %v, Returned: %v.", []string{"GET /authorization/rules/rule1"}, requests)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write([]byte(`{"count": 3, "items": [{"id": "rule1", "principal": "testgroup", "principalType": "user", "type": "grant", "permissions": ["read"], "objectUri": "/SASDrive/**", "enabled": true}, {"id": "rule2", "principal": "testgroup", "principalType": "group", "type": "grant", "permissions": ["read", "update"], "objectUri": "/SASDrive/**", "enabled": false}, {"id": "rule3", "principal": "testgroup", "principalType": "group", "type": "grant", "permissions": ["read"], "objectUri": "/SASDrive/**", "enabled": true}]}`))
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.Connected = true
+	a := new(Authorization)
+	a.Principal = &pr.Principal{ID: "testgroup", Type: "group", Connection: co}
+	a.Type = "grant"
+	a.Enabled = "true"
+	a.ObjectURI = "/SASDrive/**"
+	var TestCases = []struct {
+		Name        string
+		Permissions []string
+		Condition   string
+		Expected    Comparison
+	}{
+		{
+			Name:        "Identical",
+			Permissions: []string{"read"},
+			Expected:    Comparison{State: Identical, IDs: []string{"rule3", "rule2"}},
+		},
+		{
+			Name:        "Enabled",
+			Permissions: []string{"update", "read"},
+			Expected:    Comparison{State: Differs, IDs: []string{"rule2", "rule3"}, Differences: []string{"enabled"}},
+		},
+		{
+			Name:        "Condition",
+			Permissions: []string{"read"},
+			Condition:   "#resource.name.startsWith('HR')",
+			Expected:    Comparison{State: Differs, IDs: []string{"rule3", "rule2"}, Differences: []string{"condition"}},
+		},
+	}
+	for _, test := range TestCases {
+		t.Run(test.Name, func(t *testing.T) {
+			a.Permissions = test.Permissions
+			a.Condition = test.Condition
+			returned, err := a.Compare()
+			if err != nil || !reflect.DeepEqual(test.Expected, returned) {
+				t.Errorf("Expected: %v, Returned: %v (%v).", test.Expected, returned, err)
+			}
+		})
+	}
+	a.ObjectURI = ""
+	a.ContainerURI = pl.PendingURI("/folders/folders", "Test")
+	if returned, _ := a.Compare(); returned.State != Missing || a.IDs != nil {
+		t.Errorf("Expected: %v, Returned: %v.", Missing, returned.State)
+	}
+}
@@ -5,10 +5,14 @@ package cas
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	jo "github.com/sassoftware/sas-viya-authorization-model/journal"
 	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -33,10 +37,33 @@ type AC struct {
 	TableFilter string
 }
 
+// transactions serializes CAS access control transactions, as these are bound to the CAS session
+var transactions sync.Mutex
+
+// Control is a single direct CAS Access Control as represented by the REST API
+type Control struct {
+	Identity     string `json:"identity"`
+	IdentityType string `json:"identityType"`
+	Permission   string `json:"permission"`
+	TableFilter  string `json:"tableFilter,omitempty"`
+	Type         string `json:"type"`
+	Version      string `json:"version,omitempty"`
+}
+
 // Create a global scope PATH or DNFS type CASLIB
-func (cas *LIB) Create() {
+func (cas *LIB) Create() error {
 	zap.S().Infow("Creating CASLIB", "name", cas.Name)
-	body, _ := json.Marshal(map[string]interface{}{
+	if cas.Connection.Plan != nil {
+		cas.Connection.Plan.Add("create", "caslib", cas.Name, map[string]interface{}{
+			"description": cas.Description,
+			"path":        cas.Path,
+			"type":        cas.Type,
+			"scope":       cas.Scope,
+		})
+		cas.Exists = true
+		return nil
+	}
+	body, err := json.Marshal(map[string]interface{}{
 		"description": cas.Description,
 		"name":        cas.Name,
 		"path":        cas.Path,
@@ -45,13 +72,19 @@ func (cas *LIB) Create() {
 		"hidden":      false,
 		"transient":   false,
 	})
-	cas.Connection.Call("POST", "/casManagement/servers/"+cas.Connection.CASServer+"/caslibs", "application/vnd.sas.cas.caslib+json", "application/vnd.sas.cas.caslib+json", nil, body)
+	if err != nil {
+		return fmt.Errorf("encoding CASLIB %s: %w", cas.Name, err)
+	}
+	if _, _, err := cas.Connection.Call("POST", "/casManagement/servers/"+cas.Connection.CASServer+"/caslibs", "application/vnd.sas.cas.caslib+json", "application/vnd.sas.cas.caslib+json", nil, body); err != nil {
+		return fmt.Errorf("creating CASLIB %s: %w", cas.Name, err)
+	}
+	return cas.Connection.Record("create", "caslib", cas.Name, &jo.Request{Action: "delete", Method: "DELETE", Path: "/casManagement/servers/" + cas.Connection.CASServer + "/caslibs/" + cas.Name, Session: true})
 }
 
 // Validate whether a CASLIB exists
-func (cas *LIB) Validate() {
+func (cas *LIB) Validate() error {
 	zap.S().Debugw("Validating CASLIB", "name", cas.Name)
-	search, _ := cas.Connection.Call("GET", "/casManagement/servers/"+cas.Connection.CASServer+"/caslibs", "", "", [][]string{
+	caslibs := cas.Connection.Collection("/casManagement/servers/"+cas.Connection.CASServer+"/caslibs", [][]string{
 		0: {
 			"sessionId",
 			cas.Connection.CASSession,
@@ -62,115 +95,370 @@ func (cas *LIB) Validate() {
 		},
 		2: {
 			"limit",
-			viper.GetString("responselimit"),
+			cas.Connection.ResponseLimit(),
 		},
 		3: {
 			"filter",
 			`eq("name","` + cas.Name + `")`,
 		},
-	}, nil)
-	if search.(map[string]interface{})["count"].(float64) == 0 {
-		zap.S().Debugw("CASLIB does not exist", "name", cas.Name)
-		cas.Exists = false
-	} else {
+	})
+	cas.Exists = false
+	for caslibs.Next() {
+		if name, _ := caslibs.Item()["name"].(string); strings.EqualFold(name, cas.Name) {
+			cas.Exists = true
+		}
+	}
+	if err := caslibs.Err(); err != nil {
+		return fmt.Errorf("validating CASLIB %s: %w", cas.Name, err)
+	}
+	if cas.Exists {
 		zap.S().Debugw("CASLIB exists", "name", cas.Name)
+	} else {
+		zap.S().Debugw("CASLIB does not exist", "name", cas.Name)
+	}
+	return nil
+}
+
+// List all global scope CASLIBs of the CAS server
+func List(connection *co.Connection) ([]*LIB, error) {
+	zap.S().Debugw("Listing CASLIBs", "server", connection.CASServer)
+	items := connection.Collection("/casManagement/servers/"+connection.CASServer+"/caslibs", [][]string{
+		0: {
+			"sessionId",
+			connection.CASSession,
+		},
+		1: {
+			"limit",
+			connection.ResponseLimit(),
+		},
+	})
+	var caslibs []*LIB
+	for items.Next() {
+		item := items.Item()
+		cas := new(LIB)
+		cas.Name, _ = item["name"].(string)
+		cas.Description, _ = item["description"].(string)
+		cas.Path, _ = item["path"].(string)
+		cas.Type, _ = item["type"].(string)
+		cas.Scope, _ = item["scope"].(string)
 		cas.Exists = true
+		cas.Connection = connection
+		if cas.Name == "" {
+			return nil, fmt.Errorf("listing CASLIBs: %w", co.ErrUnexpectedResponse)
+		}
+		if cas.Scope == "global" {
+			caslibs = append(caslibs, cas)
+		}
 	}
+	if err := items.Err(); err != nil {
+		return nil, fmt.Errorf("listing CASLIBs: %w", err)
+	}
+	return caslibs, nil
 }
 
 // lock a CASLIB for editing
-func (cas *LIB) lock() {
+func (cas *LIB) lock() error {
 	zap.S().Debugw("Locking CASLIB", "name", cas.Name)
-	cas.Connection.Call("POST", "/casAccessManagement/servers/"+cas.Connection.CASServer+"/caslibControls/"+cas.Name+"/lock", "", "", [][]string{
+	if _, _, err := cas.Connection.Call("POST", "/casAccessManagement/servers/"+cas.Connection.CASServer+"/caslibControls/"+cas.Name+"/lock", "", "", [][]string{
 		0: {
 			"sessionId",
 			cas.Connection.CASSession,
 		},
-	}, nil)
+	}, nil); err != nil {
+		return fmt.Errorf("locking CASLIB %s: %w", cas.Name, err)
+	}
+	return nil
 }
 
 // startTransaction starts a CAS access control transaction
-func (cas *LIB) startTransaction() {
+func (cas *LIB) startTransaction() error {
 	zap.S().Debugw("Starting CAS access control transaction")
-	cas.Connection.Call("POST", "/casManagement/servers/"+cas.Connection.CASServer+"/sessions/"+cas.Connection.CASSession, "", "", [][]string{
-		0: {
-			"action",
-			"start",
-		},
-	}, nil)
+	return cas.transaction("start")
 }
 
 // commitTransaction commits a CAS access control transaction
-func (cas *LIB) commitTransaction() {
+func (cas *LIB) commitTransaction() error {
 	zap.S().Debugw("Committing CAS access control transaction")
-	cas.Connection.Call("POST", "/casManagement/servers/"+cas.Connection.CASServer+"/sessions/"+cas.Connection.CASSession, "", "", [][]string{
+	return cas.transaction("commit")
+}
+
+// cancelTransaction discards a CAS access control transaction
+func (cas *LIB) cancelTransaction() error {
+	zap.S().Debugw("Cancelling CAS access control transaction")
+	return cas.transaction("cancel")
+}
+
+// transaction performs a CAS access control transaction action
+func (cas *LIB) transaction(action string) error {
+	if _, _, err := cas.Connection.Call("POST", "/casManagement/servers/"+cas.Connection.CASServer+"/sessions/"+cas.Connection.CASSession, "", "", [][]string{
 		0: {
 			"action",
-			"commit",
+			action,
 		},
-	}, nil)
+	}, nil); err != nil {
+		return fmt.Errorf("%s CAS access control transaction: %w", action, err)
+	}
+	return nil
 }
 
 // Apply a list of direct CAS Access Controls to a CASLIB while replacing all existing ACs
-func (cas *LIB) Apply() {
+func (cas *LIB) Apply() error {
 	zap.S().Infow("Applying direct CAS access controls and replacing all existing", "CASLIB", cas.Name)
-	cas.lock()
-	cas.startTransaction()
-	var body []map[string]string
-	for _, ac := range cas.ACL {
-		for _, perm := range ac.Permissions {
-			add := make(map[string]string)
-			add["type"] = ac.Type
-			add["permission"] = perm
-			add["identityType"] = ac.Principal.Type
-			add["identity"] = ac.Principal.ID
-			if ac.Version != "" {
-				add["version"] = ac.Version
-			}
-			if ac.TableFilter != "" {
-				add["tableFilter"] = ac.TableFilter
-			}
-			body = append(body, add)
+	if cas.Connection.Plan != nil {
+		// replacing the controls with identical controls is not a change
+		add, remove, err := cas.Diff()
+		if co.IsStatus(err, http.StatusNotFound) {
+			zap.S().Debugw("CASLIB is only created by the plan", "CASLIB", cas.Name)
+			add, err = cas.controls(), nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(add) == 0 && len(remove) == 0 {
+			zap.S().Infow("Direct CAS access controls are up to date", "CASLIB", cas.Name)
+			return nil
+		}
+		cas.Connection.Plan.Add("replace", "accessControls", cas.Name, map[string]interface{}{"controls": cas.describe()})
+		return nil
+	}
+	return cas.journaled("replace", func() error {
+		return cas.send("PUT", cas.controls())
+	})
+}
+
+// Remove a list of direct CAS Access Controls from a CASLIB. An empty ACL will remove all existing controls
+func (cas *LIB) Remove() error {
+	zap.S().Infow("Removing specified existing direct CAS Access Controls", "CASLIB", cas.Name)
+	if cas.Connection.Plan != nil {
+		cas.Connection.Plan.Add("remove", "accessControls", cas.Name, map[string]interface{}{"controls": cas.describe()})
+		return nil
+	}
+	return cas.journaled("remove", func() error {
+		return cas.send("DELETE", cas.controls())
+	})
+}
+
+// Restore replaces all existing direct CAS Access Controls of a CASLIB with previously read controls
+func (cas *LIB) Restore(controls []Control) error {
+	zap.S().Infow("Restoring direct CAS access controls", "CASLIB", cas.Name, "controls", len(controls))
+	if cas.Connection.Plan != nil {
+		var described []string
+		for _, control := range controls {
+			described = append(described, control.Type+" "+control.IdentityType+" "+control.Identity+": "+control.Permission)
 		}
+		cas.Connection.Plan.Add("replace", "accessControls", cas.Name, map[string]interface{}{"controls": described})
+		return nil
 	}
-	bodyJSON, _ := json.Marshal(body)
-	cas.Connection.Call("PUT", "/casAccessManagement/servers/"+cas.Connection.CASServer+"/caslibControls/"+cas.Name, "application/vnd.sas.cas.access.controls+json", "", [][]string{
+	return cas.update(func() error {
+		return cas.send("PUT", controls)
+	})
+}
+
+// Controls returns the current direct CAS Access Controls of a CASLIB
+func (cas *LIB) Controls() ([]Control, error) {
+	zap.S().Debugw("Reading direct CAS access controls", "CASLIB", cas.Name)
+	items := cas.Connection.Collection("/casAccessManagement/servers/"+cas.Connection.CASServer+"/caslibControls/"+cas.Name, [][]string{
 		0: {
 			"sessionId",
 			cas.Connection.CASSession,
 		},
-	}, bodyJSON)
-	cas.commitTransaction()
+		1: {
+			"limit",
+			cas.Connection.ResponseLimit(),
+		},
+	})
+	var current []Control
+	for items.Next() {
+		item := items.Item()
+		var control Control
+		control.Identity, _ = item["identity"].(string)
+		control.IdentityType, _ = item["identityType"].(string)
+		control.Permission, _ = item["permission"].(string)
+		control.TableFilter, _ = item["tableFilter"].(string)
+		control.Type, _ = item["type"].(string)
+		if control.Permission == "" || control.Type == "" {
+			return nil, fmt.Errorf("reading CAS access controls of %s: %w", cas.Name, co.ErrUnexpectedResponse)
+		}
+		current = append(current, control)
+	}
+	if err := items.Err(); err != nil {
+		return nil, fmt.Errorf("reading CAS access controls of %s: %w", cas.Name, err)
+	}
+	return current, nil
 }
 
-// Remove a list of direct CAS Access Controls from a CASLIB. An empty ACL will remove all existing controls
-func (cas *LIB) Remove() {
-	zap.S().Infow("Removing specified existing direct CAS Access Controls", "CASLIB", cas.Name)
-	cas.lock()
-	cas.startTransaction()
-	var body []map[string]string
-	for _, ac := range cas.ACL {
-		for _, perm := range ac.Permissions {
-			add := make(map[string]string)
-			add["type"] = ac.Type
-			add["permission"] = perm
-			add["identityType"] = ac.Principal.Type
-			add["identity"] = ac.Principal.ID
-			if ac.Version != "" {
-				add["version"] = ac.Version
-			}
-			if ac.TableFilter != "" {
-				add["tableFilter"] = ac.TableFilter
+// Diff compares the ACL with the current direct CAS Access Controls of a CASLIB and returns the controls
+// to add and to remove
+func (cas *LIB) Diff() (add, remove []Control, err error) {
+	current, err := cas.Controls()
+	if err != nil {
+		return nil, nil, err
+	}
+	target := cas.controls()
+	for _, control := range target {
+		if !containsControl(current, control) {
+			add = append(add, control)
+		}
+	}
+	for _, control := range current {
+		if !containsControl(target, control) {
+			remove = append(remove, control)
+		}
+	}
+	return add, remove, nil
+}
+
+// Sync the direct CAS Access Controls of a CASLIB with the ACL by only adding missing and removing surplus
+// controls within a single transaction
+func (cas *LIB) Sync() error {
+	zap.S().Infow("Synchronizing direct CAS access controls", "CASLIB", cas.Name)
+	add, remove, err := cas.Diff()
+	if cas.Connection.Plan != nil && co.IsStatus(err, http.StatusNotFound) {
+		zap.S().Debugw("CASLIB is only created by the plan", "CASLIB", cas.Name)
+		add, err = cas.controls(), nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		zap.S().Infow("Direct CAS access controls are in sync", "CASLIB", cas.Name)
+		return nil
+	}
+	for _, control := range remove {
+		zap.S().Infow("Removing CAS access control", "CASLIB", cas.Name, "type", control.Type, "identityType", control.IdentityType, "identity", control.Identity, "permission", control.Permission)
+		if cas.Connection.Plan != nil {
+			cas.Connection.Plan.Add("remove", "accessControl", cas.Name, control.attributes())
+		}
+	}
+	for _, control := range add {
+		zap.S().Infow("Adding CAS access control", "CASLIB", cas.Name, "type", control.Type, "identityType", control.IdentityType, "identity", control.Identity, "permission", control.Permission)
+		if cas.Connection.Plan != nil {
+			cas.Connection.Plan.Add("add", "accessControl", cas.Name, control.attributes())
+		}
+	}
+	if cas.Connection.Plan != nil {
+		return nil
+	}
+	return cas.journaled("sync", func() error {
+		if len(remove) > 0 {
+			if err := cas.send("DELETE", remove); err != nil {
+				return err
 			}
-			body = append(body, add)
 		}
+		if len(add) > 0 {
+			return cas.send("PATCH", add)
+		}
+		return nil
+	})
+}
+
+// update performs the requests within a locked CAS access control transaction, cancelling it on failure
+func (cas *LIB) update(requests func() error) error {
+	transactions.Lock()
+	defer transactions.Unlock()
+	if err := cas.lock(); err != nil {
+		return err
+	}
+	if err := cas.startTransaction(); err != nil {
+		return err
+	}
+	if err := requests(); err != nil {
+		if cancelErr := cas.cancelTransaction(); cancelErr != nil {
+			zap.S().Errorw("Error when cancelling CAS access control transaction", "CASLIB", cas.Name, "error", cancelErr)
+		}
+		return err
+	}
+	return cas.commitTransaction()
+}
+
+// journaled performs the requests like update and records the previous direct CAS Access Controls in the journal of
+// the connection, so that the change can be rolled back by restoring them
+func (cas *LIB) journaled(action string, requests func() error) error {
+	if cas.Connection.Journal == nil {
+		return cas.update(requests)
 	}
-	bodyJSON, _ := json.Marshal(body)
-	cas.Connection.Call("DELETE", "/casAccessManagement/servers/"+cas.Connection.CASServer+"/caslibControls/"+cas.Name, "application/vnd.sas.cas.access.controls+json", "", [][]string{
+	previous, err := cas.Controls()
+	if err != nil {
+		return err
+	}
+	if err := cas.update(requests); err != nil {
+		return err
+	}
+	return cas.Connection.RecordState(action, "accessControls", cas.Name, previous)
+}
+
+// send access controls to the CASLIB within the current transaction
+func (cas *LIB) send(method string, controls []Control) error {
+	bodyJSON, err := json.Marshal(controls)
+	if err != nil {
+		return fmt.Errorf("encoding CAS access controls of %s: %w", cas.Name, err)
+	}
+	if _, _, err := cas.Connection.Call(method, "/casAccessManagement/servers/"+cas.Connection.CASServer+"/caslibControls/"+cas.Name, "application/vnd.sas.cas.access.controls+json", "", [][]string{
 		0: {
 			"sessionId",
 			cas.Connection.CASSession,
 		},
-	}, bodyJSON)
-	cas.commitTransaction()
+	}, bodyJSON); err != nil {
+		return fmt.Errorf("updating CAS access controls of %s: %w", cas.Name, err)
+	}
+	return nil
+}
+
+// controls flattens the ACL into the individual access controls expected by the REST API
+func (cas *LIB) controls() []Control {
+	var body []Control
+	for _, ac := range cas.ACL {
+		for _, perm := range ac.Permissions {
+			body = append(body, Control{
+				Identity:     ac.Principal.ID,
+				IdentityType: ac.Principal.Type,
+				Permission:   perm,
+				TableFilter:  ac.TableFilter,
+				Type:         ac.Type,
+				Version:      ac.Version,
+			})
+		}
+	}
+	return body
+}
+
+// describe summarizes the ACL with one entry per principal
+func (cas *LIB) describe() []string {
+	var acl []string
+	for _, ac := range cas.ACL {
+		acl = append(acl, ac.Type+" "+ac.Principal.Type+" "+ac.Principal.ID+": "+strings.Join(ac.Permissions, ","))
+	}
+	return acl
+}
+
+// equal reports whether two access controls grant or deny the same permission to the same identity
+func (c Control) equal(other Control) bool {
+	return c.Type == other.Type &&
+		c.IdentityType == other.IdentityType &&
+		c.Identity == other.Identity &&
+		c.Permission == other.Permission &&
+		c.TableFilter == other.TableFilter
+}
+
+// attributes describes an access control within a plan
+func (c Control) attributes() map[string]interface{} {
+	attributes := map[string]interface{}{
+		"type":       c.Type,
+		"identity":   c.IdentityType + " " + c.Identity,
+		"permission": c.Permission,
+	}
+	if c.TableFilter != "" {
+		attributes["tableFilter"] = c.TableFilter
+	}
+	return attributes
+}
+
+// containsControl reports whether an equal access control is part of a list
+func containsControl(controls []Control, control Control) bool {
+	for _, c := range controls {
+		if c.equal(control) {
+			return true
+		}
+	}
+	return false
 }
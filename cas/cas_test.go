@@ -4,12 +4,15 @@
 package cas
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
 	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
 )
 
@@ -17,7 +20,7 @@ func TestValidate(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		rw.WriteHeader(http.StatusOK)
 		rw.Header().Set("Content-Type", "application/json")
-		rw.Write([]byte(`{"count": 1}`))
+		rw.Write([]byte(`{"count": 1, "items": [{"name": "TESTCASLIB"}]}`))
 	}))
 	defer server.Close()
 	co := new(co.Connection)
@@ -215,3 +218,105 @@ func TestCreate(t *testing.T) {
 	cas.Scope = "global"
 	cas.Create()
 }
+
+func TestSync(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		defer req.Body.Close()
+		body, _ := ioutil.ReadAll(req.Body)
+		requests = append(requests, req.Method+" "+req.URL.Path+" "+string(body))
+		rw.Header().Set("Content-Type", "application/json")
+		if req.Method == "GET" {
+			rw.Write([]byte(`{"count": 2, "items": [{"identity": "testgroup", "identityType": "group", "permission": "readInfo", "type": "grant"}, {"identity": "oldgroup", "identityType": "group", "permission": "select", "type": "grant"}]}`))
+		}
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.CASServer = "default"
+	co.CASSession = "testsession"
+	co.Connected = true
+	pr := &pr.Principal{ID: "testgroup", Type: "group", Connection: co}
+	cas := new(LIB)
+	cas.Connection = co
+	cas.Name = "testcaslib"
+	cas.Exists = true
+	cas.ACL = append(cas.ACL, AC{Type: "grant", Principal: pr, Permissions: []string{"readInfo", "select"}})
+	if err := cas.Sync(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	expected := []string{
+		"GET /casAccessManagement/servers/default/caslibControls/testcaslib ",
+		"POST /casAccessManagement/servers/default/caslibControls/testcaslib/lock ",
+		"POST /casManagement/servers/default/sessions/testsession ",
+		`DELETE /casAccessManagement/servers/default/caslibControls/testcaslib [{"identity":"oldgroup","identityType":"group","permission":"select","type":"grant"}]`,
+		`PATCH /casAccessManagement/servers/default/caslibControls/testcaslib [{"identity":"testgroup","identityType":"group","permission":"select","type":"grant"}]`,
+		"POST /casManagement/servers/default/sessions/testsession ",
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, requests)
+	}
+}
+
+func TestSyncPlan(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" {
+			t.Errorf("Unexpected request in plan mode: %s %s.", req.Method, req.URL.String())
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"count": 1, "items": [{"identity": "oldgroup", "identityType": "group", "permission": "select", "type": "grant"}]}`))
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.CASServer = "default"
+	co.CASSession = "testsession"
+	co.Connected = true
+	co.Plan = new(pl.Plan)
+	pr := &pr.Principal{ID: "testgroup", Type: "group", Connection: co}
+	cas := new(LIB)
+	cas.Connection = co
+	cas.Name = "testcaslib"
+	cas.ACL = append(cas.ACL, AC{Type: "grant", Principal: pr, Permissions: []string{"readInfo"}})
+	cas.Sync()
+	var returned []string
+	for _, c := range co.Plan.Changes {
+		returned = append(returned, c.Action+" "+fmt.Sprint(c.Attributes["identity"]))
+	}
+	expected := []string{"remove group oldgroup", "add group testgroup"}
+	if !reflect.DeepEqual(returned, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
+
+func TestApplyPlan(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" {
+			t.Errorf("Unexpected request in plan mode: %s %s.", req.Method, req.URL.String())
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"count": 1, "items": [{"identity": "testgroup", "identityType": "group", "permission": "readInfo", "type": "grant"}]}`))
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.CASServer = "default"
+	co.CASSession = "testsession"
+	co.Connected = true
+	co.Plan = new(pl.Plan)
+	pr := &pr.Principal{ID: "testgroup", Type: "group", Connection: co}
+	cas := new(LIB)
+	cas.Connection = co
+	cas.Name = "testcaslib"
+	cas.ACL = append(cas.ACL, AC{Type: "grant", Principal: pr, Permissions: []string{"readInfo"}})
+	if err := cas.Apply(); err != nil || len(co.Plan.Changes) != 0 {
+		t.Errorf("Expected: %v, Returned: %v (%v).", nil, co.Plan.Changes, err)
+	}
+	cas.ACL[0].Permissions = append(cas.ACL[0].Permissions, "select")
+	if err := cas.Apply(); err != nil || len(co.Plan.Changes) != 1 || co.Plan.Changes[0].Action != "replace" {
+		t.Errorf("Expected: %v, Returned: %v (%v).", "replace accessControls", co.Plan.Changes, err)
+	}
+}
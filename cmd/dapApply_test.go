@@ -0,0 +1,76 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	ca "github.com/sassoftware/sas-viya-authorization-model/cas"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
+	vt "github.com/sassoftware/sas-viya-authorization-model/viyatest"
+)
+
+func TestApplyDAPAuthenticatedUsers(t *testing.T) {
+	v := vt.New()
+	v.AddGroup("HR", "Human Resources", "")
+	v.AddCASLIB(vt.CASLIB{Name: "HRDATA", Type: "PATH", Path: "/data/hr"})
+	c, err := v.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	patterns := []mo.DAPRow{
+		{Pattern: "restricted", Principal: "HR", Permissions: []string{"ReadInfo"}},
+		{Pattern: "restricted", Principal: "authenticatedUsers", Permissions: []string{"ReadInfo"}},
+	}
+	caslibs := []mo.CASLIBRow{{CASLIB: "HRDATA", Pattern: "restricted"}}
+	var fails failures
+	if err := applyDAP(c, patterns, caslibs, true, false, &fails); err != nil || fails.err() != nil {
+		t.Fatalf("Expected: %v, Returned: %v (%v).", nil, err, fails.err())
+	}
+	// authenticatedUsers is never created as a custom group with the ID *
+	var groups []string
+	for _, g := range v.Groups() {
+		groups = append(groups, g.ID)
+	}
+	if expected := []string{"HR"}; !reflect.DeepEqual(expected, groups) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, groups)
+	}
+	expected := []ca.Control{
+		{Identity: "HR", IdentityType: "group", Permission: "ReadInfo", Type: "grant"},
+		{Identity: "*", IdentityType: "group", Permission: "ReadInfo", Type: "grant"},
+	}
+	if controls := v.CASLIBs()[0].Controls; !reflect.DeepEqual(expected, controls) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, controls)
+	}
+}
+
+func TestApplyDAPPatterns(t *testing.T) {
+	v := vt.New()
+	v.AddGroup("HR", "Human Resources", "")
+	v.AddCASLIB(vt.CASLIB{Name: "HRDATA", Type: "PATH", Path: "/data/hr"})
+	c, err := v.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	c.Plan = new(pl.Plan)
+	patterns := []mo.DAPRow{
+		{Pattern: "read", Principal: "HR", Permissions: []string{"ReadInfo"}},
+		{Pattern: "write", Principal: "Sales", Permissions: []string{"Select"}},
+	}
+	caslibs := []mo.CASLIBRow{{CASLIB: "HRDATA", Pattern: "read"}, {CASLIB: "HRDATA", Pattern: "write"}}
+	var fails failures
+	if err := applyDAP(c, patterns, caslibs, true, false, &fails); err != nil || fails.err() != nil {
+		t.Fatalf("Expected: %v, Returned: %v (%v).", nil, err, fails.err())
+	}
+	// the controls of both patterns are applied once, after the group of the second pattern is created
+	var returned []string
+	for _, change := range c.Plan.Changes {
+		returned = append(returned, change.Action+" "+change.Resource+" "+change.Target)
+	}
+	if expected := []string{"create group Sales", "replace accessControls HRDATA"}; !reflect.DeepEqual(expected, returned) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
@@ -4,13 +4,12 @@
 package cmd
 
 import (
-	"strings"
-
 	ca "github.com/sassoftware/sas-viya-authorization-model/cas"
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
-	fi "github.com/sassoftware/sas-viya-authorization-model/file"
 	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
 	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	ta "github.com/sassoftware/sas-viya-authorization-model/task"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -21,76 +20,125 @@ var dapRemoveCmd = &cobra.Command{
 	Short: "Remove DAP",
 	Long:  `Remove a Data Access Pattern definition [pattern] from a list of CASLIBs [caslibs].`,
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		new(lo.Log).New()
 		deleteGroups, _ := cmd.Flags().GetBool("delete-groups")
 		zap.S().Infow("Removing DAP from CASLIBs", "pattern", args[0], "CASLIBs", args[1], "create-groups", deleteGroups)
-		co := new(co.Connection)
-		co.Connect()
-		fp := new(fi.File)
-		fp.Path = args[0]
-		fp.Schema = []string{"Pattern", "Principal", "Permissions"}
-		fp.Type = "csv"
-		fp.Read()
-		fc := new(fi.File)
-		fc.Path = args[1]
-		fc.Schema = []string{"CASLIB", "Description", "Type", "Path", "Pattern"}
-		fc.Type = "csv"
-		fc.Read()
-		patterns := make(map[string][][]string)
-		principals := make(map[string]*pr.Principal)
-		caslibs := make(map[string]*ca.LIB)
-		for _, pattern := range fp.Content.([][]string)[1:] {
-			patterns[pattern[0]] = append(patterns[pattern[0]], pattern[1:])
+		patternRows, err := mo.ReadDAPPatterns(args[0])
+		if err != nil {
+			return err
 		}
-		for _, caslib := range fc.Content.([][]string)[1:] {
-			if _, exists := caslibs[caslib[0]]; !exists {
-				caslibs[caslib[0]] = new(ca.LIB)
-				caslibs[caslib[0]].Connection = co
-				caslibs[caslib[0]].Name = caslib[0]
-				caslibs[caslib[0]].Description = caslib[1]
-				caslibs[caslib[0]].Type = caslib[2]
-				caslibs[caslib[0]].Path = caslib[3]
-				caslibs[caslib[0]].Scope = "global"
-				caslibs[caslib[0]].Validate()
-			}
-			if !caslibs[caslib[0]].Exists {
-				zap.S().Errorw("CASLIB does not exist", "CASLIB", caslib[0])
-			} else {
-				if _, exists := patterns[caslib[4]]; exists {
-					for _, pattern := range patterns[caslib[4]] {
-						var principal string = pattern[0]
-						if _, exists := principals[principal]; !exists {
-							principals[principal] = new(pr.Principal)
-							principals[principal].Name = principal
-							principals[principal].Connection = co
-							principals[principal].Type = "group"
-							if principal == "authenticatedUsers" {
-								principals[principal].ID = "*"
-								principals[principal].Exists = true
-							} else {
-								principals[principal].ID = principal
-								principals[principal].Validate()
-							}
+		caslibRows, err := mo.ReadDAPCASLIBs(args[1])
+		if err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		if err := removeDAP(co, patternRows, caslibRows, deleteGroups, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// removeDAP removes the direct access controls of a DAP from CASLIBs
+func removeDAP(co *co.Connection, patternRows []mo.DAPRow, caslibRows []mo.CASLIBRow, deleteGroups bool, fails *failures) error {
+	var operations ta.Graph
+	patterns := make(map[string][]mo.DAPRow)
+	principals := make(map[string]*pr.Principal)
+	caslibs := make(map[string]*ca.LIB)
+	dependencies := make(map[string][]string)
+	var names []string
+	for _, pattern := range patternRows {
+		patterns[pattern.Pattern] = append(patterns[pattern.Pattern], pattern)
+	}
+	for _, caslib := range caslibRows {
+		if _, exists := caslibs[caslib.CASLIB]; !exists {
+			l := new(ca.LIB)
+			l.Connection = co
+			l.Name = caslib.CASLIB
+			l.Description = caslib.Description
+			l.Type = caslib.Type
+			l.Path = caslib.Path
+			l.Scope = "global"
+			caslibs[caslib.CASLIB] = l
+			names = append(names, l.Name)
+			dependencies[l.Name] = []string{"caslib " + l.Name}
+			operations.Add("caslib "+l.Name, func() error {
+				if err := l.Validate(); err != nil {
+					return err
+				}
+				if !l.Exists {
+					zap.S().Errorw("CASLIB does not exist", "CASLIB", l.Name)
+				}
+				return nil
+			})
+		}
+		l := caslibs[caslib.CASLIB]
+		if _, exists := patterns[caslib.Pattern]; exists {
+			for _, pattern := range patterns[caslib.Pattern] {
+				var principal string = pattern.Principal
+				if _, exists := principals[principal]; !exists {
+					p := new(pr.Principal)
+					p.Name = principal
+					p.Connection = co
+					p.Type = "group"
+					principals[principal] = p
+					if principal == "authenticatedUsers" {
+						p.ID = "*"
+						p.Exists = true
+					} else {
+						p.ID = principal
+					}
+					operations.Add("group "+principal, func() error {
+						// authenticatedUsers is the identity * of all authenticated users and not a custom group
+						if p.ID == "*" {
+							return nil
 						}
-						if deleteGroups && principals[principal].Exists {
-							principals[principal].Delete()
+						if err := p.Validate(); err != nil {
+							return err
 						}
-						var ac ca.AC = ca.AC{
-							Type:        "grant",
-							Principal:   principals[principal],
-							Permissions: strings.Split(pattern[1], ","),
+						if deleteGroups && p.Exists {
+							return p.Delete()
 						}
-						caslibs[caslib[0]].ACL = append(caslibs[caslib[0]].ACL, ac)
-					}
-					caslibs[caslib[0]].Remove()
-				} else {
-					zap.S().Errorw("Pattern is not defined", "CASLIB", caslib[0], "pattern", caslib[4])
+						return nil
+					})
 				}
+				dependencies[l.Name] = append(dependencies[l.Name], "group "+principal)
+				var ac ca.AC = ca.AC{
+					Type:        "grant",
+					Principal:   principals[principal],
+					Permissions: pattern.Permissions,
+				}
+				l.ACL = append(l.ACL, ac)
 			}
+		} else {
+			zap.S().Errorw("Pattern is not defined", "CASLIB", caslib.CASLIB, "pattern", caslib.Pattern)
 		}
-		co.Disconnect()
-	},
+	}
+	// Each CASLIB is updated once with the access controls of all its patterns
+	for _, name := range names {
+		l := caslibs[name]
+		if l.ACL == nil {
+			continue
+		}
+		operations.Add("access controls "+name, func() error {
+			if !l.Exists {
+				return nil
+			}
+			return l.Remove()
+		}, dependencies[name]...)
+	}
+	fails.execute(&operations)
+	return nil
 }
 
 func init() {
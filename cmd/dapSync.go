@@ -0,0 +1,162 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	ca "github.com/sassoftware/sas-viya-authorization-model/cas"
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	ta "github.com/sassoftware/sas-viya-authorization-model/task"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// dapSyncCmd represents the dapSync command
+var dapSyncCmd = &cobra.Command{
+	Use:   "sync [pattern] [caslibs]",
+	Short: "Sync DAP (apply and/or remove automatically)",
+	Long:  `Synchronize the direct access controls of a list of CASLIBs [caslibs] with a Data Access Pattern definition [pattern]. Only missing access controls are added and surplus access controls are removed.`,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		createGroups, _ := cmd.Flags().GetBool("create-groups")
+		createCASLIBs, _ := cmd.Flags().GetBool("create-caslibs")
+		zap.S().Infow("Synchronizing DAP with CASLIBs (applying and/or removing automatically)", "pattern", args[0], "CASLIBs", args[1], "create-groups", createGroups, "create-caslibs", createCASLIBs)
+		patternRows, err := mo.ReadDAPPatterns(args[0])
+		if err != nil {
+			return err
+		}
+		caslibRows, err := mo.ReadDAPCASLIBs(args[1])
+		if err != nil {
+			return err
+		}
+		if err := lintModel(mo.Files{DAPPatterns: patternRows, DAPCASLIBs: caslibRows}); err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		if err := syncDAP(co, patternRows, caslibRows, createGroups, createCASLIBs, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// syncDAP synchronizes the direct access controls of CASLIBs with a DAP
+func syncDAP(co *co.Connection, patternRows []mo.DAPRow, caslibRows []mo.CASLIBRow, createGroups, createCASLIBs bool, fails *failures) error {
+	var operations ta.Graph
+	patterns := make(map[string][]mo.DAPRow)
+	principals := make(map[string]*pr.Principal)
+	caslibs := make(map[string]*ca.LIB)
+	dependencies := make(map[string][]string)
+	var names []string
+	for _, pattern := range patternRows {
+		patterns[pattern.Pattern] = append(patterns[pattern.Pattern], pattern)
+	}
+	for _, caslib := range caslibRows {
+		if _, exists := caslibs[caslib.CASLIB]; !exists {
+			l := new(ca.LIB)
+			l.Connection = co
+			l.Name = caslib.CASLIB
+			l.Description = caslib.Description
+			l.Type = caslib.Type
+			l.Path = caslib.Path
+			l.Scope = "global"
+			caslibs[caslib.CASLIB] = l
+			names = append(names, l.Name)
+			dependencies[l.Name] = []string{"caslib " + l.Name}
+			operations.Add("caslib "+l.Name, func() error {
+				if err := l.Validate(); err != nil {
+					return err
+				}
+				if !l.Exists && createCASLIBs {
+					if err := l.Create(); err != nil {
+						return err
+					}
+					if co.Plan == nil {
+						if err := l.Validate(); err != nil {
+							return err
+						}
+					}
+				}
+				if !l.Exists {
+					zap.S().Errorw("CASLIB does not exist", "CASLIB", l.Name)
+				}
+				return nil
+			})
+		}
+		l := caslibs[caslib.CASLIB]
+		if _, exists := patterns[caslib.Pattern]; exists {
+			for _, pattern := range patterns[caslib.Pattern] {
+				var principal string = pattern.Principal
+				if _, exists := principals[principal]; !exists {
+					p := new(pr.Principal)
+					p.Name = principal
+					p.Connection = co
+					p.Type = "group"
+					principals[principal] = p
+					if principal == "authenticatedUsers" {
+						p.ID = "*"
+						p.Exists = true
+					} else {
+						p.ID = principal
+					}
+					operations.Add("group "+principal, func() error {
+						// authenticatedUsers is the identity * of all authenticated users and not a custom group
+						if p.ID == "*" {
+							return nil
+						}
+						if err := p.Validate(); err != nil {
+							return err
+						}
+						if createGroups && !p.Exists {
+							return p.Create()
+						}
+						return nil
+					})
+				}
+				dependencies[l.Name] = append(dependencies[l.Name], "group "+principal)
+				var ac ca.AC = ca.AC{
+					Type:        "grant",
+					Principal:   principals[principal],
+					Permissions: pattern.Permissions,
+				}
+				l.ACL = append(l.ACL, ac)
+			}
+		} else {
+			zap.S().Errorw("Pattern is not defined", "CASLIB", caslib.CASLIB, "pattern", caslib.Pattern)
+		}
+	}
+	// Each CASLIB is synchronized once with the access controls of all its patterns
+	for _, name := range names {
+		l := caslibs[name]
+		if l.ACL == nil {
+			continue
+		}
+		operations.Add("access controls "+name, func() error {
+			if !l.Exists {
+				return nil
+			}
+			return l.Sync()
+		}, dependencies[name]...)
+	}
+	fails.execute(&operations)
+	return nil
+}
+
+func init() {
+	dapCmd.AddCommand(dapSyncCmd)
+	dapSyncCmd.Flags().BoolP("create-groups", "g", false, "create missing custom groups")
+	dapSyncCmd.Flags().BoolP("create-caslibs", "c", false, "create missing CASLIBs")
+}
@@ -0,0 +1,110 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	dr "github.com/sassoftware/sas-viya-authorization-model/drift"
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the authorization state of two environments",
+	Long:  `Compare the custom groups, memberships, folders, authorization rules and CAS access controls of the SAS Viya environments of the --from and --to profiles and report what is missing, extra or divergent in the latter. Folders are matched by path, so differing folder URIs are not reported. Rules on other content, e.g. reports, are not compared. Nothing is changed. The command exits with code 3 if differences are found.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		if format != "text" && format != "json" && format != "junit" {
+			return fmt.Errorf("unknown format %q, expected text, json or junit", format)
+		}
+		p, err := newPromotion(cmd)
+		if err != nil {
+			return err
+		}
+		defer disconnect(p.target)
+		var fails failures
+		report, err := diffPromotion(p, &fails)
+		if err != nil {
+			return err
+		}
+		if err := writeReport(report, format, output); err != nil {
+			return err
+		}
+		if err := fails.err(); err != nil {
+			return err
+		}
+		if report.Drifted() {
+			missing, extra, divergent := report.Summary()
+			return &exitError{
+				code: exitDrift,
+				err:  fmt.Errorf("differences found: %d missing, %d extra, %d divergent", missing, extra, divergent),
+			}
+		}
+		return nil
+	},
+}
+
+// diffPromotion compares every part of a promotion as a promotion in plan mode, so that nothing is changed and every
+// difference is recorded as a planned change. Only the selected parts are reported, folders are also resolved to
+// compare the rules on them if they are not selected
+func diffPromotion(p *promotion, fails *failures) (*dr.Report, error) {
+	report := new(dr.Report)
+	compare := func(part string, promote func() error) error {
+		p.target.Plan = new(pl.Plan)
+		if err := promote(); err != nil {
+			return err
+		}
+		report.Add(part, p.target.Plan)
+		return nil
+	}
+	if p.parts["groups"] {
+		if err := compare("groups", func() error {
+			return syncGroups(p.target, p.source.GroupRows(), p.deleteGroups, fails)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	var uris map[string]string
+	if p.parts["folders"] {
+		if err := compare("folders", func() error {
+			uris = restoreFolders(p.target, p.source, true, fails)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if p.parts["rules"] {
+		if err := compare("rules", func() error {
+			if !p.parts["folders"] {
+				uris = restoreFolders(p.target, p.source, false, fails)
+			}
+			return restoreRules(p.target, p.source, uris, p.keep, fails)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if p.parts["caslibs"] {
+		if err := compare("caslibs", func() error {
+			restoreCASLIBs(p.target, p.source, fails)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	promotionFlags(diffCmd)
+	diffCmd.Flags().StringP("format", "f", "text", "report format: text, json or junit")
+	diffCmd.Flags().StringP("output", "o", "", "file to write the report to (default is stdout)")
+}
@@ -0,0 +1,49 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	vt "github.com/sassoftware/sas-viya-authorization-model/viyatest"
+)
+
+func TestDiffPromotion(t *testing.T) {
+	from := vt.New()
+	from.AddGroup("HR", "Human Resources", "")
+	projects := from.AddFolder("/Projects")
+	from.AddRule(vt.Rule{Principal: "HR", PrincipalType: "group", Type: "grant", Permissions: []string{"read"}, ObjectURI: projects + "/**", Enabled: true})
+	to := vt.New()
+	to.AddGroup("HR", "Human Resources", "")
+	to.AddFolder("/Projects")
+	source, err := from.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	target, err := to.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	// folders are resolved to compare the rules on them, but only the selected rules are reported
+	parts, _ := restoreParts([]string{"rules"})
+	p, err := promote(source, target, parts, nil, false)
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	var fails failures
+	report, err := diffPromotion(p, &fails)
+	if err != nil || fails.err() != nil {
+		t.Fatalf("Expected: %v, Returned: %v (%v).", nil, err, fails.err())
+	}
+	if expected := []string{"rules"}; !reflect.DeepEqual(expected, report.Models) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, report.Models)
+	}
+	if missing, _, _ := report.Summary(); missing != 1 {
+		t.Errorf("Expected: %v, Returned: %v.", 1, missing)
+	}
+	if len(to.Rules()) != 0 {
+		t.Errorf("Expected: %v, Returned: %v.", 0, len(to.Rules()))
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	dr "github.com/sassoftware/sas-viya-authorization-model/drift"
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// driftCmd represents the drift command
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Detect drift between the model files and SAS Viya",
+	Long:  `Compare the model files (groups, matrix, IPAP and DAP) with a SAS Viya environment and report missing, extra and divergent groups, memberships, authorization rules and CAS access controls. Nothing is changed. The command exits with code 3 if drift is detected.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		groups, _ := cmd.Flags().GetString("groups")
+		matrix, _ := cmd.Flags().GetString("matrix")
+		ipapPattern, _ := cmd.Flags().GetString("ipap-pattern")
+		ipapFolders, _ := cmd.Flags().GetString("ipap-folders")
+		dapPattern, _ := cmd.Flags().GetString("dap-pattern")
+		dapCASLIBs, _ := cmd.Flags().GetString("dap-caslibs")
+		deleteGroups, _ := cmd.Flags().GetBool("delete-groups")
+		managedOnly, _ := cmd.Flags().GetBool("managed-only")
+		syncPrincipals, _ := cmd.Flags().GetBool("principals")
+		protected, _ := cmd.Flags().GetStringSlice("protect")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		zap.S().Infow("Detecting drift between the model files and SAS Viya", "groups", groups, "matrix", matrix, "ipap-pattern", ipapPattern, "ipap-folders", ipapFolders, "dap-pattern", dapPattern, "dap-caslibs", dapCASLIBs, "format", format)
+		if format != "text" && format != "json" && format != "junit" {
+			return fmt.Errorf("unknown format %q, expected text, json or junit", format)
+		}
+		if (ipapPattern == "") != (ipapFolders == "") {
+			return errors.New("--ipap-pattern and --ipap-folders need to be provided together")
+		}
+		if (dapPattern == "") != (dapCASLIBs == "") {
+			return errors.New("--dap-pattern and --dap-caslibs need to be provided together")
+		}
+		if groups == "" && matrix == "" && ipapPattern == "" && dapPattern == "" {
+			return errors.New("at least one model file needs to be provided")
+		}
+		var groupRows []mo.GroupRow
+		var matrixRows []mo.CapabilityRow
+		var ipapPatternRows []mo.IPAPRow
+		var ipapFolderRows []mo.FolderRow
+		var dapPatternRows []mo.DAPRow
+		var dapCASLIBRows []mo.CASLIBRow
+		var err error
+		if groups != "" {
+			if groupRows, err = mo.ReadGroups(groups); err != nil {
+				return err
+			}
+		}
+		if matrix != "" {
+			if matrixRows, err = mo.ReadMatrix(matrix); err != nil {
+				return err
+			}
+		}
+		if ipapPattern != "" {
+			if ipapPatternRows, err = mo.ReadIPAPPatterns(ipapPattern); err != nil {
+				return err
+			}
+			if ipapFolderRows, err = mo.ReadIPAPFolders(ipapFolders); err != nil {
+				return err
+			}
+		}
+		if dapPattern != "" {
+			if dapPatternRows, err = mo.ReadDAPPatterns(dapPattern); err != nil {
+				return err
+			}
+			if dapCASLIBRows, err = mo.ReadDAPCASLIBs(dapCASLIBs); err != nil {
+				return err
+			}
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		var fails failures
+		report := new(dr.Report)
+		// every model is compared as a sync in plan mode with all creations enabled, so that nothing is changed
+		// and every difference is recorded as a planned change
+		compare := func(model string, sync func() error) error {
+			co.Plan = new(pl.Plan)
+			if err := sync(); err != nil {
+				return err
+			}
+			report.Add(model, co.Plan)
+			return nil
+		}
+		if groups != "" {
+			if err := compare("groups", func() error {
+				return syncGroups(co, groupRows, deleteGroups, &fails)
+			}); err != nil {
+				return err
+			}
+		}
+		if matrix != "" {
+			if err := compare("matrix", func() error {
+				return syncMatrix(co, matrixRows, true, managedOnly, syncPrincipals, protected, &fails)
+			}); err != nil {
+				return err
+			}
+		}
+		if ipapPattern != "" {
+			if err := compare("ipap", func() error {
+				return syncIPAP(co, ipapPatternRows, ipapFolderRows, true, true, managedOnly, &fails)
+			}); err != nil {
+				return err
+			}
+		}
+		if dapPattern != "" {
+			if err := compare("dap", func() error {
+				return syncDAP(co, dapPatternRows, dapCASLIBRows, true, true, &fails)
+			}); err != nil {
+				return err
+			}
+		}
+		if err := writeReport(report, format, output); err != nil {
+			return err
+		}
+		if err := fails.err(); err != nil {
+			return err
+		}
+		if report.Drifted() {
+			missing, extra, divergent := report.Summary()
+			return &exitError{
+				code: exitDrift,
+				err:  fmt.Errorf("drift detected: %d missing, %d extra, %d divergent", missing, extra, divergent),
+			}
+		}
+		return nil
+	},
+}
+
+// writeReport writes the drift report in the requested format to a file or stdout
+func writeReport(report *dr.Report, format, output string) error {
+	var w io.Writer = os.Stdout
+	if output != "" && output != "-" {
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("writing drift report: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	switch format {
+	case "json":
+		return report.WriteJSON(w)
+	case "junit":
+		return report.WriteJUnit(w)
+	default:
+		report.WriteText(w)
+		return nil
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(driftCmd)
+	driftCmd.Flags().String("groups", "", "groups file to compare")
+	driftCmd.Flags().String("matrix", "", "platform capability matrix file to compare")
+	driftCmd.Flags().String("ipap-pattern", "", "IPAP pattern file to compare")
+	driftCmd.Flags().String("ipap-folders", "", "IPAP folders file to compare")
+	driftCmd.Flags().String("dap-pattern", "", "DAP pattern file to compare")
+	driftCmd.Flags().String("dap-caslibs", "", "DAP CASLIBs file to compare")
+	driftCmd.Flags().BoolP("delete-groups", "d", false, "report custom groups that are not part of the groups file as extra")
+	driftCmd.Flags().BoolP("managed-only", "m", false, "only report extra authorization rules enabled by goViyaAuth")
+	driftCmd.Flags().BoolP("principals", "p", false, "also report grants of the matrix principals on object URIs that are not part of the matrix")
+	driftCmd.Flags().StringSlice("protect", []string{"SASAdministrators"}, "principals whose authorization rules are never reported as extra")
+	driftCmd.Flags().StringP("format", "f", "text", "report format: text, json or junit")
+	driftCmd.Flags().StringP("output", "o", "", "file to write the report to (default is stdout)")
+}
@@ -0,0 +1,91 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	xp "github.com/sassoftware/sas-viya-authorization-model/explain"
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Explain the effective access of a user",
+	Long:  `Explain the effective access of a user to an object URI (e.g. a report), a folder or a CASLIB. The effective decision of each permission is requested from SAS Viya, together with the group memberships of the user and the authorization rules that contribute, including rules conveyed by the folders containing the object. For CASLIBs the decisions are derived from the direct CAS access controls. Nothing is changed.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		user, _ := cmd.Flags().GetString("user")
+		uri, _ := cmd.Flags().GetString("uri")
+		folder, _ := cmd.Flags().GetString("folder")
+		caslib, _ := cmd.Flags().GetString("caslib")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		zap.S().Infow("Explaining the effective access of a user", "user", user, "uri", uri, "folder", folder, "caslib", caslib, "format", format)
+		if format != "text" && format != "json" {
+			return fmt.Errorf("unknown format %q, expected text or json", format)
+		}
+		if user == "" {
+			return errors.New("--user needs to be provided")
+		}
+		var targets int
+		for _, target := range []string{uri, folder, caslib} {
+			if target != "" {
+				targets++
+			}
+		}
+		if targets != 1 {
+			return errors.New("exactly one of --uri, --folder and --caslib needs to be provided")
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		var explanation *xp.Explanation
+		var err error
+		switch {
+		case uri != "":
+			explanation, err = xp.URI(co, user, uri)
+		case folder != "":
+			explanation, err = xp.Folder(co, user, folder)
+		default:
+			explanation, err = xp.CASLIB(co, user, caslib)
+		}
+		if err != nil {
+			return err
+		}
+		var w io.Writer = os.Stdout
+		if output != "" && output != "-" {
+			f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+			if err != nil {
+				return fmt.Errorf("writing explanation: %w", err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if format == "json" {
+			return explanation.WriteJSON(w)
+		}
+		explanation.WriteText(w)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+	explainCmd.Flags().String("user", "", "ID of the user whose access is explained")
+	explainCmd.Flags().String("uri", "", "object URI to explain the access to, e.g. /reports/reports/<id>")
+	explainCmd.Flags().String("folder", "", "folder path to explain the access to, e.g. /Projects/HR")
+	explainCmd.Flags().String("caslib", "", "CASLIB to explain the access to")
+	explainCmd.Flags().StringP("format", "f", "text", "explanation format: text or json")
+	explainCmd.Flags().StringP("output", "o", "", "file to write the explanation to (default is stdout)")
+}
@@ -0,0 +1,113 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ex "github.com/sassoftware/sas-viya-authorization-model/export"
+	fi "github.com/sassoftware/sas-viya-authorization-model/file"
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the current authorization model",
+	Long:  `Export the custom groups, platform capability rules, folder rules and CASLIB access controls of a SAS Viya environment into model CSV files. Folders and CASLIBs sharing identical rules share a pattern.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		outputDir, _ := cmd.Flags().GetString("output-dir")
+		include, _ := cmd.Flags().GetStringSlice("include")
+		roots, _ := cmd.Flags().GetStringSlice("folders")
+		exclude, _ := cmd.Flags().GetStringSlice("exclude-folders")
+		managedOnly, _ := cmd.Flags().GetBool("managed-only")
+		zap.S().Infow("Exporting the SAS Viya authorization model", "output-dir", outputDir, "include", include, "folders", roots, "exclude-folders", exclude, "managed-only", managedOnly)
+		parts := make(map[string]bool)
+		for _, part := range include {
+			switch part {
+			case "groups", "matrix", "ipap", "dap":
+				parts[part] = true
+			default:
+				return fmt.Errorf("unknown export %q, expected groups, matrix, ipap or dap", part)
+			}
+		}
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		if parts["groups"] {
+			rows, err := ex.Groups(co)
+			if err != nil {
+				return err
+			}
+			if err := writeModel(outputDir, "groups.csv", ex.GroupsSchema, rows); err != nil {
+				return err
+			}
+		}
+		if parts["matrix"] {
+			rows, err := ex.Matrix(co, managedOnly)
+			if err != nil {
+				return err
+			}
+			if err := writeModel(outputDir, "matrix.csv", ex.MatrixSchema, rows); err != nil {
+				return err
+			}
+		}
+		if parts["ipap"] {
+			patterns, folders, err := ex.Folders(co, roots, exclude, managedOnly)
+			if err != nil {
+				return err
+			}
+			if err := writeModel(outputDir, "ipap_pattern.csv", ex.IPAPPatternSchema, patterns); err != nil {
+				return err
+			}
+			if err := writeModel(outputDir, "ipap_folders.csv", ex.IPAPFoldersSchema, folders); err != nil {
+				return err
+			}
+		}
+		if parts["dap"] {
+			patterns, caslibs, err := ex.CASLIBs(co)
+			if err != nil {
+				return err
+			}
+			if err := writeModel(outputDir, "dap_pattern.csv", ex.DAPPatternSchema, patterns); err != nil {
+				return err
+			}
+			if err := writeModel(outputDir, "dap_caslibs.csv", ex.DAPCASLIBsSchema, caslibs); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// writeModel writes the rows of a model CSV file into the output directory
+func writeModel(dir, name string, schema []string, rows [][]string) error {
+	f := new(fi.File)
+	f.Path = filepath.Join(dir, name)
+	f.Schema = schema
+	f.Type = "csv"
+	f.Content = rows
+	zap.S().Infow("Writing model file", "path", f.Path, "rows", len(rows)-1)
+	return f.Write()
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringP("output-dir", "o", ".", "directory to write the model CSV files to")
+	exportCmd.Flags().StringSlice("include", []string{"groups", "matrix", "ipap", "dap"}, "parts of the model to export")
+	exportCmd.Flags().StringSlice("folders", nil, "folder trees to export (default is all root folders)")
+	exportCmd.Flags().StringSlice("exclude-folders", []string{"/Users"}, "folder trees to skip")
+	exportCmd.Flags().BoolP("managed-only", "m", false, "only export authorization rules enabled by goViyaAuth")
+}
@@ -5,9 +5,10 @@ package cmd
 
 import (
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
-	fi "github.com/sassoftware/sas-viya-authorization-model/file"
 	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
 	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	ta "github.com/sassoftware/sas-viya-authorization-model/task"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -18,68 +19,106 @@ var groupsApplyCmd = &cobra.Command{
 	Short: "Apply Custom Groups",
 	Long:  `Apply a SAS Viya Custom Groups structure [groups].`,
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		new(lo.Log).New()
 		zap.S().Infow("Applying a SAS Viya Custom Groups structure", "groups", args[0])
-		co := new(co.Connection)
-		co.Connect()
-		fi := new(fi.File)
-		fi.Path = args[0]
-		fi.Schema = []string{"ParentGroupID", "GroupID", "GroupName", "UserID"}
-		fi.Type = "csv"
-		fi.Read()
-		groups := make(map[string]*pr.Principal)
-		users := make(map[string]*pr.Principal)
-		for _, item := range fi.Content.([][]string)[1:] {
-			var parent string = item[0]
-			var group string = item[1]
-			var member string = item[3]
-			if group != "" {
-				if _, exists := groups[group]; !exists {
-					groups[group] = new(pr.Principal)
-					groups[group].ID = group
-					groups[group].Name = item[2]
-					groups[group].Description = item[2]
-					groups[group].Type = "group"
-					groups[group].Connection = co
-					groups[group].Validate()
+		rows, err := mo.ReadGroups(args[0])
+		if err != nil {
+			return err
+		}
+		if err := lintModel(mo.Files{Groups: rows}); err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		if err := applyGroups(co, rows, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// applyGroups creates the custom groups and memberships of a groups structure
+func applyGroups(co *co.Connection, rows []mo.GroupRow, fails *failures) error {
+	var operations ta.Graph
+	groups := make(map[string]*pr.Principal)
+	defined := make(map[string]bool)
+	addGroup := func(id string) *pr.Principal {
+		if _, exists := groups[id]; !exists {
+			g := new(pr.Principal)
+			g.ID = id
+			g.Name = id
+			g.Type = "group"
+			g.Connection = co
+			groups[id] = g
+			operations.Add("group "+id, func() error {
+				if err := g.Validate(); err != nil {
+					return err
 				}
-				if parent != "" {
-					if _, exists := groups[parent]; !exists {
-						groups[parent] = new(pr.Principal)
-						groups[parent].ID = parent
-						groups[parent].Name = parent
-						groups[parent].Type = "group"
-						groups[parent].Connection = co
-						groups[parent].Validate()
-					}
-					if groups[parent].Exists {
-						groups[group].Parents = append(groups[group].Parents, groups[parent])
-						groups[group].Nest()
-					} else {
-						zap.S().Errorw("The ParentGroupID does not exist")
-					}
+				if defined[g.ID] && !g.Exists {
+					return g.Create()
 				}
-				if !groups[group].Exists {
-					groups[group].Create()
+				if !g.Exists {
+					return nil
 				}
-				if member != "" {
-					if _, exists := users[member]; !exists {
-						users[member] = new(pr.Principal)
-						users[member].ID = member
-						users[member].Type = "user"
-						users[member].Connection = co
+				// existing memberships are neither added again nor recorded in the journal
+				return g.GetDirectMembers()
+			})
+		}
+		return groups[id]
+	}
+	for _, row := range rows {
+		var parent string = row.ParentGroupID
+		var group string = row.GroupID
+		var member string = row.UserID
+		if group != "" {
+			g := addGroup(group)
+			if !defined[group] {
+				defined[group] = true
+				g.Name = row.GroupName
+				g.Description = row.GroupName
+			}
+			if parent != "" {
+				p := addGroup(parent)
+				operations.Add("nest "+group+" "+parent, func() error {
+					if !p.Exists {
+						zap.S().Errorw("The ParentGroupID does not exist", "id", g.ID, "parentid", p.ID)
+						return nil
 					}
-					users[member].Parents = append(users[member].Parents, groups[group])
-					groups[group].Members = append(groups[group].Members, users[member])
-					users[member].Nest()
-				}
-			} else {
-				zap.S().Errorw("The GroupID always needs to be provided")
+					if p.HasMember(g) {
+						zap.S().Debugw("Custom group is already a member", "id", g.ID, "parentid", p.ID)
+						return nil
+					}
+					return g.NestIn(p)
+				}, "group "+group, "group "+parent)
+			}
+			if member != "" {
+				u := new(pr.Principal)
+				u.ID = member
+				u.Type = "user"
+				u.Connection = co
+				operations.Add("member "+group+" "+member, func() error {
+					if g.HasMember(u) {
+						zap.S().Debugw("User is already a member", "groupID", g.ID, "userID", u.ID)
+						return nil
+					}
+					return u.NestIn(g)
+				}, "group "+group)
 			}
+		} else {
+			zap.S().Errorw("The GroupID always needs to be provided")
 		}
-		co.Disconnect()
-	},
+	}
+	fails.execute(&operations)
+	return nil
 }
 
 func init() {
@@ -0,0 +1,42 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
+	vt "github.com/sassoftware/sas-viya-authorization-model/viyatest"
+)
+
+func TestApplyGroupsPlan(t *testing.T) {
+	v := vt.New()
+	v.AddUser("alice", "Alice")
+	v.AddUser("bob", "Bob")
+	v.AddGroup("HR", "Human Resources", "")
+	v.AddGroup("per001", "Persona: Business User", "")
+	v.AddMember("HR", "user", "alice")
+	v.AddMember("HR", "group", "per001")
+	c, err := v.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	c.Plan = new(pl.Plan)
+	rows := []mo.GroupRow{
+		{GroupID: "HR", GroupName: "Human Resources", UserID: "alice"},
+		{GroupID: "HR", GroupName: "Human Resources", UserID: "bob"},
+		{ParentGroupID: "HR", GroupID: "per001", GroupName: "Persona: Business User"},
+	}
+	var fails failures
+	if err := applyGroups(c, rows, &fails); err != nil || fails.err() != nil {
+		t.Fatalf("Expected: %v, Returned: %v (%v).", nil, err, fails.err())
+	}
+	// only the missing membership is planned
+	expected := []pl.Change{{Action: "add", Resource: "membership", Target: "HR", Attributes: map[string]interface{}{"user": "bob"}}}
+	if !reflect.DeepEqual(expected, c.Plan.Changes) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, c.Plan.Changes)
+	}
+}
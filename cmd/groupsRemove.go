@@ -5,9 +5,10 @@ package cmd
 
 import (
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
-	fi "github.com/sassoftware/sas-viya-authorization-model/file"
 	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
 	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	ta "github.com/sassoftware/sas-viya-authorization-model/task"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -18,7 +19,7 @@ var groupsRemoveCmd = &cobra.Command{
 	Short: "Remove Custom Groups",
 	Long:  `Remove a SAS Viya Custom Groups structure [groups].`,
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		new(lo.Log).New()
 		membersOnly, _ := cmd.Flags().GetBool("members")
 		if membersOnly {
@@ -26,40 +27,62 @@ var groupsRemoveCmd = &cobra.Command{
 		} else {
 			zap.S().Infow("Removing a SAS Viya Custom Groups structure", "groups", args[0])
 		}
-		co := new(co.Connection)
-		co.Connect()
-		fi := new(fi.File)
-		fi.Path = args[0]
-		fi.Schema = []string{"ParentGroupID", "GroupID", "GroupName", "UserID"}
-		fi.Type = "csv"
-		fi.Read()
-		groups := make(map[string]*pr.Principal)
-		for _, item := range fi.Content.([][]string)[1:] {
-			var group string = item[1]
-			if group != "" {
-				if _, exists := groups[group]; !exists {
-					groups[group] = new(pr.Principal)
-					groups[group].ID = group
-					groups[group].Name = item[2]
-					groups[group].Description = item[2]
-					groups[group].Type = "group"
-					groups[group].Connection = co
-					groups[group].Validate()
-				}
-				if groups[group].Exists {
+		rows, err := mo.ReadGroups(args[0])
+		if err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		if err := removeGroups(co, rows, membersOnly, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// removeGroups deletes the custom groups, or only their members, of a groups structure
+func removeGroups(co *co.Connection, rows []mo.GroupRow, membersOnly bool, fails *failures) error {
+	var operations ta.Graph
+	for _, row := range rows {
+		var group string = row.GroupID
+		if group != "" {
+			if !operations.Has("group " + group) {
+				g := new(pr.Principal)
+				g.ID = group
+				g.Name = row.GroupName
+				g.Description = row.GroupName
+				g.Type = "group"
+				g.Connection = co
+				operations.Add("group "+group, func() error {
+					if err := g.Validate(); err != nil {
+						return err
+					}
+					if !g.Exists {
+						return nil
+					}
 					if membersOnly {
-						groups[group].GetMembers()
-						groups[group].DeleteMembers()
-					} else {
-						groups[group].Delete()
+						if err := g.GetMembers(); err != nil {
+							return err
+						}
+						return g.DeleteMembers()
 					}
-				}
-			} else {
-				zap.S().Errorw("The GroupID always needs to be provided")
+					return g.Delete()
+				})
 			}
+		} else {
+			zap.S().Errorw("The GroupID always needs to be provided")
 		}
-		co.Disconnect()
-	},
+	}
+	fails.execute(&operations)
+	return nil
 }
 
 func init() {
@@ -4,12 +4,14 @@
 package cmd
 
 import (
+	"fmt"
+
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
-	fi "github.com/sassoftware/sas-viya-authorization-model/file"
 	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
 	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	ta "github.com/sassoftware/sas-viya-authorization-model/task"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -19,164 +21,215 @@ var groupsSyncCmd = &cobra.Command{
 	Short: "Sync Custom Groups (apply and/or remove automatically)",
 	Long:  `Synchronize a SAS Viya Custom Groups structure [groups].`,
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		new(lo.Log).New()
-		zap.S().Infow("Synchronizing a SAS Viya Custom Groups structure (applying and/or removing automatically)", "groups", args[0])
-		co := new(co.Connection)
-		co.Connect()
-		fi := new(fi.File)
-		fi.Path = args[0]
-		fi.Schema = []string{"ParentGroupID", "GroupID", "GroupName", "UserID"}
-		fi.Type = "csv"
-		fi.Read()
-		groupsTarget := make(map[string]*pr.Principal)
-		usersTarget := make(map[string]*pr.Principal)
-		groupsCurrent := make(map[string]*pr.Principal)
-		usersCurrent := make(map[string]*pr.Principal)
 		deleteGroups, _ := cmd.Flags().GetBool("delete-groups")
-		for _, item := range fi.Content.([][]string)[1:] {
-			var parent string = item[0]
-			var group string = item[1]
-			var member string = item[3]
-			if group != "" {
-				if _, exists := groupsTarget[group]; !exists {
-					groupsTarget[group] = new(pr.Principal)
-					groupsTarget[group].ID = group
-					groupsTarget[group].Name = item[2]
-					groupsTarget[group].Description = item[2]
-					groupsTarget[group].Type = "group"
-					groupsTarget[group].Connection = co
-				}
-				if parent != "" {
-					if _, exists := groupsTarget[parent]; !exists {
-						groupsTarget[parent] = new(pr.Principal)
-						groupsTarget[parent].ID = parent
-						groupsTarget[parent].Name = parent
-						groupsTarget[parent].Type = "group"
-						groupsTarget[parent].Connection = co
-					}
-					groupsTarget[group].Parents = append(groupsTarget[group].Parents, groupsTarget[parent])
-					groupsTarget[parent].Members = append(groupsTarget[parent].Members, groupsTarget[group])
+		zap.S().Infow("Synchronizing a SAS Viya Custom Groups structure (applying and/or removing automatically)", "groups", args[0], "delete-groups", deleteGroups)
+		rows, err := mo.ReadGroups(args[0])
+		if err != nil {
+			return err
+		}
+		if err := lintModel(mo.Files{Groups: rows}); err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		if err := syncGroups(co, rows, deleteGroups, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// syncGroups synchronizes the custom groups and memberships with a groups file
+func syncGroups(co *co.Connection, rows []mo.GroupRow, deleteGroups bool, fails *failures) error {
+	groupsTarget := make(map[string]*pr.Principal)
+	usersTarget := make(map[string]*pr.Principal)
+	groupsCurrent := make(map[string]*pr.Principal)
+	usersCurrent := make(map[string]*pr.Principal)
+	var targetIDs, currentIDs []string
+	for _, row := range rows {
+		var parent string = row.ParentGroupID
+		var group string = row.GroupID
+		var member string = row.UserID
+		if group != "" {
+			if _, exists := groupsTarget[group]; !exists {
+				groupsTarget[group] = new(pr.Principal)
+				groupsTarget[group].ID = group
+				groupsTarget[group].Name = row.GroupName
+				groupsTarget[group].Description = row.GroupName
+				groupsTarget[group].Type = "group"
+				groupsTarget[group].Connection = co
+				targetIDs = append(targetIDs, group)
+			}
+			if parent != "" {
+				if _, exists := groupsTarget[parent]; !exists {
+					groupsTarget[parent] = new(pr.Principal)
+					groupsTarget[parent].ID = parent
+					groupsTarget[parent].Name = parent
+					groupsTarget[parent].Type = "group"
+					groupsTarget[parent].Connection = co
+					targetIDs = append(targetIDs, parent)
 				}
-				if member != "" {
-					if _, exists := usersTarget[member]; !exists {
-						usersTarget[member] = new(pr.Principal)
-						usersTarget[member].ID = member
-						usersTarget[member].Type = "user"
-						usersTarget[member].Connection = co
-					}
-					usersTarget[member].Parents = append(usersTarget[member].Parents, groupsTarget[group])
-					groupsTarget[group].Members = append(groupsTarget[group].Members, usersTarget[member])
+				groupsTarget[group].Parents = append(groupsTarget[group].Parents, groupsTarget[parent])
+				groupsTarget[parent].Members = append(groupsTarget[parent].Members, groupsTarget[group])
+			}
+			if member != "" {
+				if _, exists := usersTarget[member]; !exists {
+					usersTarget[member] = new(pr.Principal)
+					usersTarget[member].ID = member
+					usersTarget[member].Type = "user"
+					usersTarget[member].Connection = co
 				}
-			} else {
-				zap.S().Errorw("The GroupID always needs to be provided")
+				usersTarget[member].Parents = append(usersTarget[member].Parents, groupsTarget[group])
+				groupsTarget[group].Members = append(groupsTarget[group].Members, usersTarget[member])
 			}
+		} else {
+			zap.S().Errorw("The GroupID always needs to be provided")
 		}
-		resp, _ := co.Call("GET", "/identities/groups", "", "", [][]string{
+	}
+	groups := co.Collection("/identities/groups", [][]string{
+		0: {
+			"providerId",
+			"local",
+		},
+		1: {
+			"limit",
+			co.ResponseLimit(),
+		},
+	})
+	for groups.Next() {
+		item := groups.Item()
+		group, _ := item["id"].(string)
+		if _, exists := groupsCurrent[group]; !exists {
+			groupsCurrent[group] = new(pr.Principal)
+			groupsCurrent[group].ID = group
+			groupsCurrent[group].Name, _ = item["name"].(string)
+			groupsCurrent[group].Description = groupsCurrent[group].Name
+			groupsCurrent[group].Type = "group"
+			groupsCurrent[group].Exists = true
+			groupsCurrent[group].Connection = co
+			currentIDs = append(currentIDs, group)
+		}
+		members := co.Collection("/identities/groups/"+group+"/members", [][]string{
 			0: {
-				"providerId",
-				"local",
-			},
-			1: {
 				"limit",
-				viper.GetString("responselimit"),
+				co.ResponseLimit(),
 			},
-		}, nil)
-		if resp.(map[string]interface{})["count"] == "0" {
-			zap.S().Debugw("No custom groups exist")
-			groupsCurrent = nil
-		} else {
-			for _, item := range resp.(map[string]interface{})["items"].([]interface{}) {
-				group := item.(map[string]interface{})["id"].(string)
-				if _, exists := groupsCurrent[group]; !exists {
-					groupsCurrent[group] = new(pr.Principal)
-					groupsCurrent[group].ID = group
-					groupsCurrent[group].Name = item.(map[string]interface{})["name"].(string)
-					groupsCurrent[group].Description = item.(map[string]interface{})["name"].(string)
-					groupsCurrent[group].Type = "group"
-					groupsCurrent[group].Exists = true
-					groupsCurrent[group].Connection = co
+		})
+		for members.Next() {
+			item2 := members.Item()
+			if item2["type"] == "group" {
+				groupMember, _ := item2["id"].(string)
+				if _, exists := groupsCurrent[groupMember]; !exists {
+					groupsCurrent[groupMember] = new(pr.Principal)
+					groupsCurrent[groupMember].ID = groupMember
+					groupsCurrent[groupMember].Name, _ = item2["name"].(string)
+					groupsCurrent[groupMember].Description = groupsCurrent[groupMember].Name
+					groupsCurrent[groupMember].Type = "group"
+					groupsCurrent[groupMember].Exists = true
+					groupsCurrent[groupMember].Connection = co
+					currentIDs = append(currentIDs, groupMember)
 				}
-				resp2, _ := co.Call("GET", "/identities/groups/"+group+"/members", "", "", [][]string{
-					0: {
-						"limit",
-						viper.GetString("responselimit"),
-					},
-				}, nil)
-				if resp2.(map[string]interface{})["count"] == "0" {
-					zap.S().Debugw("No members in group", "group", group)
-					groupsCurrent[group].Members = nil
-				} else {
-					for _, item2 := range resp2.(map[string]interface{})["items"].([]interface{}) {
-						if item2.(map[string]interface{})["type"].(string) == "group" {
-							groupMember := item2.(map[string]interface{})["id"].(string)
-							if _, exists := groupsCurrent[groupMember]; !exists {
-								groupsCurrent[groupMember] = new(pr.Principal)
-								groupsCurrent[groupMember].ID = groupMember
-								groupsCurrent[groupMember].Name = item2.(map[string]interface{})["name"].(string)
-								groupsCurrent[groupMember].Description = item2.(map[string]interface{})["name"].(string)
-								groupsCurrent[groupMember].Type = "group"
-								groupsCurrent[groupMember].Exists = true
-								groupsCurrent[groupMember].Connection = co
-							}
-							groupsCurrent[groupMember].Parents = append(groupsCurrent[groupMember].Parents, groupsCurrent[group])
-							groupsCurrent[group].Members = append(groupsCurrent[group].Members, groupsCurrent[groupMember])
-						} else {
-							userMember := item2.(map[string]interface{})["id"].(string)
-							if _, exists := usersCurrent[userMember]; !exists {
-								usersCurrent[userMember] = new(pr.Principal)
-								usersCurrent[userMember].ID = userMember
-								usersCurrent[userMember].Type = "user"
-								usersCurrent[userMember].Exists = true
-								usersCurrent[userMember].Connection = co
-							}
-							usersCurrent[userMember].Parents = append(usersCurrent[userMember].Parents, groupsCurrent[group])
-							groupsCurrent[group].Members = append(groupsCurrent[group].Members, usersCurrent[userMember])
-						}
-					}
+				groupsCurrent[groupMember].Parents = append(groupsCurrent[groupMember].Parents, groupsCurrent[group])
+				groupsCurrent[group].Members = append(groupsCurrent[group].Members, groupsCurrent[groupMember])
+			} else {
+				userMember, _ := item2["id"].(string)
+				if _, exists := usersCurrent[userMember]; !exists {
+					usersCurrent[userMember] = new(pr.Principal)
+					usersCurrent[userMember].ID = userMember
+					usersCurrent[userMember].Type = "user"
+					usersCurrent[userMember].Exists = true
+					usersCurrent[userMember].Connection = co
 				}
+				usersCurrent[userMember].Parents = append(usersCurrent[userMember].Parents, groupsCurrent[group])
+				groupsCurrent[group].Members = append(groupsCurrent[group].Members, usersCurrent[userMember])
 			}
 		}
-		for _, group := range groupsCurrent {
-			if _, exists := groupsTarget[group.ID]; !exists {
-				if deleteGroups {
-					group.Delete()
-				} else {
-					zap.S().Infow("The group no longer exists in the desired target state", "group", group.ID)
-				}
+		// without the complete current state, memberships that were never seen would be removed
+		if err := members.Err(); err != nil {
+			return fmt.Errorf("listing members of custom group %s: %w", group, err)
+		}
+		if groupsCurrent[group].Members == nil {
+			zap.S().Debugw("No members in group", "group", group)
+		}
+	}
+	if err := groups.Err(); err != nil {
+		return fmt.Errorf("listing custom groups: %w", err)
+	}
+	if len(groupsCurrent) == 0 {
+		zap.S().Debugw("No custom groups exist")
+	}
+	var operations ta.Graph
+	for _, id := range currentIDs {
+		group := groupsCurrent[id]
+		if _, exists := groupsTarget[group.ID]; !exists {
+			if deleteGroups {
+				operations.Add("delete group "+group.ID, group.Delete)
 			} else {
-				for _, memberCurrent := range groupsCurrent[group.ID].Members {
-					var found bool = false
-					for _, memberTarget := range groupsTarget[group.ID].Members {
-						if memberCurrent.ID == memberTarget.ID {
-							found = true
-						}
-					}
-					if !found {
-						group.DeleteMember("user", memberCurrent.ID)
+				zap.S().Infow("The group no longer exists in the desired target state", "group", group.ID)
+			}
+		} else {
+			for _, memberCurrent := range groupsCurrent[group.ID].Members {
+				var found bool = false
+				for _, memberTarget := range groupsTarget[group.ID].Members {
+					if memberCurrent.ID == memberTarget.ID {
+						found = true
 					}
 				}
+				if !found {
+					memberCurrent := memberCurrent
+					operations.Add("remove member "+group.ID+" "+memberCurrent.ID, func() error {
+						return group.DeleteMember(memberCurrent.Type, memberCurrent.ID)
+					})
+				}
 			}
 		}
-		for _, group := range groupsTarget {
-			if _, exists := groupsCurrent[group.ID]; !exists {
-				group.Create()
-			} else {
-				for _, memberTarget := range groupsTarget[group.ID].Members {
-					var found bool = false
-					for _, memberCurrent := range groupsCurrent[group.ID].Members {
-						if memberCurrent.ID == memberTarget.ID {
-							found = true
-						}
-					}
-					if !found {
-						memberTarget.Nest()
+	}
+	for _, id := range targetIDs {
+		group := groupsTarget[id]
+		operations.Add("group "+group.ID, func() error {
+			if _, exists := groupsCurrent[group.ID]; exists {
+				group.Exists = true
+				return nil
+			}
+			return group.Create()
+		})
+	}
+	// memberships are only added once the groups exist, as new groups can be members of each other
+	for _, id := range targetIDs {
+		group := groupsTarget[id]
+		for _, memberTarget := range group.Members {
+			var found bool = false
+			if current, exists := groupsCurrent[group.ID]; exists {
+				for _, memberCurrent := range current.Members {
+					if memberCurrent.ID == memberTarget.ID {
+						found = true
 					}
 				}
 			}
+			if !found {
+				memberTarget := memberTarget
+				var dependencies []string = []string{"group " + group.ID}
+				if memberTarget.Type == "group" {
+					dependencies = append(dependencies, "group "+memberTarget.ID)
+				}
+				operations.Add("member "+group.ID+" "+memberTarget.ID, func() error {
+					return memberTarget.NestIn(group)
+				}, dependencies...)
+			}
 		}
-		co.Disconnect()
-	},
+	}
+	fails.execute(&operations)
+	return nil
 }
 
 func init() {
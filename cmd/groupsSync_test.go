@@ -0,0 +1,73 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	vt "github.com/sassoftware/sas-viya-authorization-model/viyatest"
+	"github.com/spf13/viper"
+)
+
+func TestSyncGroups(t *testing.T) {
+	v := vt.New()
+	v.AddUser("alice", "Alice")
+	v.AddUser("bob", "Bob")
+	v.AddGroup("Sales", "Sales", "")
+	v.AddGroup("per001", "Persona: Business User", "")
+	v.AddGroup("Obsolete", "Obsolete", "")
+	v.AddMember("Sales", "user", "bob")
+	v.AddMember("Obsolete", "user", "alice")
+	c, err := v.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	rows := []mo.GroupRow{
+		{GroupID: "HR", GroupName: "Human Resources", UserID: "alice"},
+		{ParentGroupID: "HR", GroupID: "per001", GroupName: "Persona: Business User"},
+		{ParentGroupID: "Sales", GroupID: "per001", GroupName: "Persona: Business User"},
+		{GroupID: "Sales", GroupName: "Sales"},
+	}
+	// new groups are nested in each other with concurrent operations
+	viper.Set("parallel", 4)
+	defer viper.Set("parallel", 1)
+	for run := 1; run <= 2; run++ {
+		var fails failures
+		if err := syncGroups(c, rows, true, &fails); err != nil || fails.err() != nil {
+			t.Fatalf("Expected: %v, Returned: %v (%v).", nil, err, fails.err())
+		}
+		var groups []string
+		for _, g := range v.Groups() {
+			groups = append(groups, g.ID)
+		}
+		if expected := []string{"HR", "Sales", "per001"}; !reflect.DeepEqual(expected, groups) {
+			t.Errorf("Expected: %v, Returned: %v.", expected, groups)
+		}
+		if expected := []vt.Member{{ID: "alice", Type: "user"}, {ID: "per001", Type: "group"}}; !sameMembers(expected, v.Members("HR")) {
+			t.Errorf("Expected: %v, Returned: %v.", expected, v.Members("HR"))
+		}
+		if expected := []vt.Member{{ID: "per001", Type: "group"}}; !sameMembers(expected, v.Members("Sales")) {
+			t.Errorf("Expected: %v, Returned: %v.", expected, v.Members("Sales"))
+		}
+	}
+}
+
+// sameMembers reports whether two lists contain the same members regardless of their order
+func sameMembers(a, b []vt.Member) bool {
+	count := make(map[vt.Member]int)
+	for _, m := range a {
+		count[m]++
+	}
+	for _, m := range b {
+		count[m]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
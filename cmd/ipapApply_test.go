@@ -0,0 +1,94 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	fo "github.com/sassoftware/sas-viya-authorization-model/folder"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	vt "github.com/sassoftware/sas-viya-authorization-model/viyatest"
+)
+
+func TestApplyIPAP(t *testing.T) {
+	v := vt.New()
+	v.AddGroup("HR", "Human Resources", "")
+	v.AddFolder("/Projects")
+	c, err := v.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	patterns := []mo.IPAPRow{
+		{Pattern: "restricted", Principal: "HR", GrantType: "object", Permissions: []string{"read", "update"}},
+		{Pattern: "restricted", Principal: "HR", GrantType: "conveyed", Permissions: []string{"read"}},
+		{Pattern: "restricted", Principal: "authenticatedUsers", GrantType: "object", Permissions: []string{"delete"}, RuleOptions: mo.RuleOptions{Type: "prohibit"}},
+	}
+	folders := []mo.FolderRow{{Directory: "/Projects"}, {Directory: "/Projects/HR/", Pattern: "restricted"}}
+	var fails failures
+	if err := applyIPAP(c, patterns, folders, false, true, false, &fails); err != nil || fails.err() != nil {
+		t.Fatalf("Expected: %v, Returned: %v (%v).", nil, err, fails.err())
+	}
+	hr := v.Folders()[1]
+	if hr.Path != "/Projects/HR" {
+		t.Fatalf("Expected: %v, Returned: %v.", "/Projects/HR", hr.Path)
+	}
+	rules := v.Rules()
+	if len(rules) != 3 {
+		t.Fatalf("Expected: %v, Returned: %v.", 3, rules)
+	}
+	for _, rule := range rules {
+		if rule.ObjectURI != hr.URI+"/**" && rule.ContainerURI != hr.URI {
+			t.Errorf("Expected: %v, Returned: %v.", hr.URI, rule)
+		}
+	}
+	// applying the pattern again changes nothing, a differing rule is only updated in place with --overwrite-pattern
+	patterns[0].Permissions = []string{"read"}
+	fails = failures{}
+	applyIPAP(c, patterns, folders, false, true, false, &fails)
+	if len(fails.errs) != 1 || !reflect.DeepEqual(rules, v.Rules()) {
+		t.Errorf("Expected: %v, Returned: %v.", 1, fails.errs)
+	}
+	fails = failures{}
+	if err := applyIPAP(c, patterns, folders, false, true, true, &fails); err != nil || fails.err() != nil {
+		t.Fatalf("Expected: %v, Returned: %v (%v).", nil, err, fails.err())
+	}
+	updated := v.Rules()
+	if len(updated) != 3 {
+		t.Fatalf("Expected: %v, Returned: %v.", 3, updated)
+	}
+	for i, rule := range updated {
+		if rule.ID != rules[i].ID || (rule.Principal == "HR" && rule.ObjectURI != "" && !reflect.DeepEqual(rule.Permissions, []string{"read"})) {
+			t.Errorf("Expected: %v, Returned: %v.", rules[i].ID+" read", rule)
+		}
+	}
+}
+
+func TestApplyIPAPUnlistedParent(t *testing.T) {
+	v := vt.New()
+	v.AddGroup("HR", "Human Resources", "")
+	v.AddFolder("/Projects")
+	c, err := v.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	patterns := []mo.IPAPRow{{Pattern: "restricted", Principal: "HR", GrantType: "object", Permissions: []string{"read"}}}
+	// the parent folder is not part of the model, but exists
+	folders := []mo.FolderRow{{Directory: "/Projects/HR", Pattern: "restricted"}}
+	var fails failures
+	if err := applyIPAP(c, patterns, folders, false, true, false, &fails); err != nil || fails.err() != nil {
+		t.Fatalf("Expected: %v, Returned: %v (%v).", nil, err, fails.err())
+	}
+	if created := v.Folders(); len(created) != 2 || created[1].Path != "/Projects/HR" {
+		t.Errorf("Expected: %v, Returned: %v.", "/Projects/HR", created)
+	}
+	// a missing parent folder is not created
+	fails = failures{}
+	folders = []mo.FolderRow{{Directory: "/Missing/HR", Pattern: "restricted"}}
+	applyIPAP(c, patterns, folders, false, true, false, &fails)
+	if len(fails.errs) != 1 || !errors.Is(fails.errs[0], fo.ErrParentMissing) {
+		t.Errorf("Expected: %v, Returned: %v.", fo.ErrParentMissing, fails.errs)
+	}
+}
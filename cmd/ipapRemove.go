@@ -4,14 +4,16 @@
 package cmd
 
 import (
+	"strconv"
 	"strings"
 
 	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
-	fi "github.com/sassoftware/sas-viya-authorization-model/file"
 	fo "github.com/sassoftware/sas-viya-authorization-model/folder"
 	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
 	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	ta "github.com/sassoftware/sas-viya-authorization-model/task"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -22,91 +24,130 @@ var ipapRemoveCmd = &cobra.Command{
 	Short: "Remove IPAP",
 	Long:  `Remove an Information Product Access Pattern definition [pattern] from a list of SAS Viya content folders [folders].`,
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		new(lo.Log).New()
 		deleteGroups, _ := cmd.Flags().GetBool("delete-groups")
 		deleteFolders, _ := cmd.Flags().GetBool("delete-folders")
 		zap.S().Infow("Removing IPAP from SAS Viya content folders", "pattern", args[0], "folders", args[1], "delete-groups", deleteGroups, "delete-folders", deleteFolders)
-		co := new(co.Connection)
-		co.Connect()
-		fp := new(fi.File)
-		fp.Path = args[0]
-		fp.Schema = []string{"Pattern", "Principal", "GrantType", "Permissions"}
-		fp.Type = "csv"
-		fp.Read()
-		ff := new(fi.File)
-		ff.Path = args[1]
-		ff.Schema = []string{"Directory", "Pattern"}
-		ff.Type = "csv"
-		ff.Read()
-		patterns := make(map[string][][]string)
-		principals := make(map[string]*pr.Principal)
-		folders := make(map[string]*fo.Folder)
-		for _, pattern := range fp.Content.([][]string)[1:] {
-			patterns[pattern[0]] = append(patterns[pattern[0]], pattern[1:])
+		patternRows, err := mo.ReadIPAPPatterns(args[0])
+		if err != nil {
+			return err
 		}
-		for _, folder := range ff.Content.([][]string)[1:] {
-			folder[0] = strings.TrimSuffix(folder[0], "/")
-			var pathElements []string = strings.Split(folder[0], "/")
-			if _, exists := folders[folder[0]]; !exists {
-				folders[folder[0]] = new(fo.Folder)
-				folders[folder[0]].Path = folder[0]
-				folders[folder[0]].Connection = co
-				folders[folder[0]].Validate()
-			}
-			if (folders[folder[0]].Parent == nil) && len(pathElements) >= 3 {
+		folderRows, err := mo.ReadIPAPFolders(args[1])
+		if err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		if err := removeIPAP(co, patternRows, folderRows, deleteGroups, deleteFolders, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// removeIPAP deletes the authorization rules of an IPAP from folders
+func removeIPAP(co *co.Connection, patternRows []mo.IPAPRow, folderRows []mo.FolderRow, deleteGroups, deleteFolders bool, fails *failures) error {
+	var operations ta.Graph
+	patterns := make(map[string][]mo.IPAPRow)
+	principals := make(map[string]*pr.Principal)
+	folders := make(map[string]*fo.Folder)
+	for _, pattern := range patternRows {
+		patterns[pattern.Pattern] = append(patterns[pattern.Pattern], pattern)
+	}
+	for _, folder := range folderRows {
+		folder.Directory = strings.TrimSuffix(folder.Directory, "/")
+		var pathElements []string = strings.Split(folder.Directory, "/")
+		if _, exists := folders[folder.Directory]; !exists {
+			f := new(fo.Folder)
+			f.Path = folder.Directory
+			f.Connection = co
+			folders[folder.Directory] = f
+			var dependencies []string
+			if len(pathElements) >= 3 {
 				var parentPath string
 				for i := 1; i <= len(pathElements)-2; i++ {
 					parentPath = parentPath + "/" + pathElements[i]
 				}
 				if _, exists := folders[parentPath]; exists {
-					folders[folder[0]].Parent = folders[parentPath]
+					f.Parent = folders[parentPath]
+					dependencies = append(dependencies, "folder "+parentPath)
 				}
 			}
-			if deleteFolders && folders[folder[0]].Exists {
-				folders[folder[0]].DeleteRecursive()
-			}
-			if _, exists := patterns[folder[1]]; exists {
-				for _, item := range patterns[folder[1]] {
-					var principal string = item[0]
-					if _, exists := principals[principal]; !exists {
-						principals[principal] = new(pr.Principal)
-						principals[principal].ID = principal
-						principals[principal].Name = principal
-						principals[principal].Connection = co
-						if principal == "authenticatedUsers" {
-							principals[principal].Type = principal
-							principals[principal].Exists = true
-						} else {
-							principals[principal].Type = "group"
-							principals[principal].Validate()
-						}
-					}
-					if deleteGroups && principals[principal].Exists {
-						principals[principal].Delete()
+			operations.Add("folder "+f.Path, func() error {
+				if err := f.Validate(); err != nil {
+					return err
+				}
+				if deleteFolders && f.Exists {
+					return f.DeleteRecursive()
+				}
+				return nil
+			}, dependencies...)
+		}
+		f := folders[folder.Directory]
+		if _, exists := patterns[folder.Pattern]; exists {
+			for i, item := range patterns[folder.Pattern] {
+				var principal string = item.Principal
+				if _, exists := principals[principal]; !exists {
+					p := new(pr.Principal)
+					p.ID = principal
+					p.Name = principal
+					p.Connection = co
+					principals[principal] = p
+					if principal == "authenticatedUsers" {
+						p.Type = principal
+						p.Exists = true
+					} else {
+						p.Type = "group"
 					}
-					if folders[folder[0]].URI != "" {
-						au := new(au.Authorization)
-						au.Principal = principals[principal]
-						au.Type = "grant"
-						au.Enabled = "true"
-						au.Permissions = strings.Split(item[2], ",")
-						au.Description = "Automatically enabled by goViyaAuth"
-						if item[1] == "object" {
-							au.ObjectURI = folders[folder[0]].URI + "/**"
-						} else if item[1] == "conveyed" {
-							au.ContainerURI = folders[folder[0]].URI
+					operations.Add("group "+principal, func() error {
+						if err := p.Validate(); err != nil {
+							return err
 						}
-						au.Validate()
-						if au.IDs != nil {
-							au.Delete()
+						if deleteGroups && p.Exists {
+							return p.Delete()
 						}
-					}
+						return nil
+					})
 				}
+				p := principals[principal]
+				item := item
+				operations.Add("rule "+f.Path+" "+folder.Pattern+" "+strconv.Itoa(i), func() error {
+					if f.URI == "" {
+						return nil
+					}
+					rule := new(au.Authorization)
+					rule.Principal = p
+					ruleOptions(rule, item.RuleOptions)
+					rule.Enabled = "true"
+					rule.Permissions = item.Permissions
+					rule.Description = au.ManagedDescription
+					if item.GrantType == "object" {
+						rule.ObjectURI = f.URI + "/**"
+					} else if item.GrantType == "conveyed" {
+						rule.ContainerURI = f.URI
+					}
+					if err := rule.Validate(); err != nil {
+						return err
+					}
+					if rule.IDs != nil {
+						return rule.Delete()
+					}
+					return nil
+				}, "folder "+f.Path, "group "+principal)
 			}
 		}
-		co.Disconnect()
-	},
+	}
+	fails.execute(&operations)
+	return nil
 }
 
 func init() {
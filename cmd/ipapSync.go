@@ -0,0 +1,242 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+
+	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	fo "github.com/sassoftware/sas-viya-authorization-model/folder"
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	ta "github.com/sassoftware/sas-viya-authorization-model/task"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// ipapSyncCmd represents the ipapSync command
+var ipapSyncCmd = &cobra.Command{
+	Use:   "sync [pattern] [folders]",
+	Short: "Sync IPAP (apply and/or remove automatically)",
+	Long:  `Synchronize the authorization rules of a list of SAS Viya content folders [folders] with an Information Product Access Pattern definition [pattern]. Grants on the folders that are not described by the pattern are removed and missing grants are added.`,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		createGroups, _ := cmd.Flags().GetBool("create-groups")
+		createFolders, _ := cmd.Flags().GetBool("create-folders")
+		managedOnly, _ := cmd.Flags().GetBool("managed-only")
+		zap.S().Infow("Synchronizing IPAP with SAS Viya content folders (applying and/or removing automatically)", "pattern", args[0], "folders", args[1], "create-groups", createGroups, "create-folders", createFolders, "managed-only", managedOnly)
+		patternRows, err := mo.ReadIPAPPatterns(args[0])
+		if err != nil {
+			return err
+		}
+		folderRows, err := mo.ReadIPAPFolders(args[1])
+		if err != nil {
+			return err
+		}
+		if err := lintModel(mo.Files{IPAPPatterns: patternRows, IPAPFolders: folderRows}); err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		if err := syncIPAP(co, patternRows, folderRows, createGroups, createFolders, managedOnly, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// contains reports whether an equal authorization rule is part of a list
+func contains(rules []*au.Authorization, rule *au.Authorization) bool {
+	for _, r := range rules {
+		if r.Equal(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcile removes the current authorization rules that are neither kept nor part of the target and enables the
+// missing target rules. A removable rule of the same principal, type and URI is updated in place instead, so that
+// access is not interrupted and the rule keeps its ID
+func reconcile(current, target []*au.Authorization, keep func(rule *au.Authorization) bool, message string, keysAndValues ...interface{}) error {
+	var removable []*au.Authorization
+	for _, rule := range current {
+		if !keep(rule) && !contains(target, rule) {
+			removable = append(removable, rule)
+		}
+	}
+	updates := make(map[*au.Authorization]*au.Authorization)
+	for _, rule := range target {
+		if contains(current, rule) {
+			continue
+		}
+		for i, existing := range removable {
+			if existing.Same(rule) {
+				updates[rule] = existing
+				removable = append(removable[:i], removable[i+1:]...)
+				break
+			}
+		}
+	}
+	for _, rule := range removable {
+		zap.S().Infow(message, append(keysAndValues, "principal", rule.Principal.ID, "principalType", rule.Principal.Type, "permissions", rule.Permissions)...)
+		if err := rule.Delete(); err != nil {
+			return err
+		}
+	}
+	for _, rule := range target {
+		if existing, exists := updates[rule]; exists {
+			zap.S().Infow("Updating authorization rule in place", append(keysAndValues, "principal", rule.Principal.ID, "principalType", rule.Principal.Type, "permissions", rule.Permissions)...)
+			rule.IDs = existing.IDs
+			if err := rule.Update(); err != nil {
+				return err
+			}
+		} else if !contains(current, rule) {
+			if err := rule.Enable(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncIPAP synchronizes the authorization rules of folders with an IPAP
+func syncIPAP(co *co.Connection, patternRows []mo.IPAPRow, folderRows []mo.FolderRow, createGroups, createFolders, managedOnly bool, fails *failures) error {
+	var operations ta.Graph
+	patterns := make(map[string][]mo.IPAPRow)
+	principals := make(map[string]*pr.Principal)
+	folders := make(map[string]*fo.Folder)
+	folderPatterns := make(map[string][]string)
+	var paths []string
+	for _, pattern := range patternRows {
+		patterns[pattern.Pattern] = append(patterns[pattern.Pattern], pattern)
+	}
+	for _, folder := range folderRows {
+		folder.Directory = strings.TrimSuffix(folder.Directory, "/")
+		if _, exists := patterns[folder.Pattern]; !exists && folder.Pattern != "" {
+			zap.S().Errorw("Pattern is not defined", "folder", folder.Directory, "pattern", folder.Pattern)
+			continue
+		}
+		if _, exists := folderPatterns[folder.Directory]; !exists {
+			paths = append(paths, folder.Directory)
+			folderPatterns[folder.Directory] = nil
+		}
+		// folders without a pattern, e.g. parents of exported folders, are only created
+		if folder.Pattern != "" {
+			folderPatterns[folder.Directory] = append(folderPatterns[folder.Directory], folder.Pattern)
+		}
+	}
+	for _, path := range paths {
+		var pathElements []string = strings.Split(path, "/")
+		f := new(fo.Folder)
+		f.Path = path
+		f.Connection = co
+		folders[path] = f
+		var dependencies []string
+		if len(pathElements) >= 3 {
+			var parentPath string
+			for i := 1; i <= len(pathElements)-2; i++ {
+				parentPath = parentPath + "/" + pathElements[i]
+			}
+			if _, exists := folders[parentPath]; exists {
+				f.Parent = folders[parentPath]
+				dependencies = append(dependencies, "folder "+parentPath)
+			}
+		}
+		operations.Add("folder "+path, func() error {
+			if err := f.Validate(); err != nil {
+				return err
+			}
+			if createFolders && !f.Exists {
+				if err := f.ResolveParent(); err != nil {
+					return err
+				}
+				return f.Create()
+			}
+			return nil
+		}, dependencies...)
+		var items []mo.IPAPRow
+		dependencies = []string{"folder " + path}
+		for _, pattern := range folderPatterns[path] {
+			for _, item := range patterns[pattern] {
+				var principal string = item.Principal
+				if _, exists := principals[principal]; !exists {
+					p := new(pr.Principal)
+					p.ID = principal
+					p.Name = principal
+					p.Connection = co
+					principals[principal] = p
+					if principal == "authenticatedUsers" {
+						p.Type = principal
+						p.Exists = true
+					} else {
+						p.Type = "group"
+					}
+					operations.Add("group "+principal, func() error {
+						if err := p.Validate(); err != nil {
+							return err
+						}
+						if createGroups && !p.Exists {
+							return p.Create()
+						}
+						return nil
+					})
+				}
+				items = append(items, item)
+				dependencies = append(dependencies, "group "+principal)
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+		operations.Add("rules "+path, func() error {
+			if f.URI == "" {
+				zap.S().Errorw("Folder does not exist", "folder", f.Path)
+				return nil
+			}
+			var target []*au.Authorization
+			for _, item := range items {
+				rule := new(au.Authorization)
+				rule.Principal = principals[item.Principal]
+				ruleOptions(rule, item.RuleOptions)
+				rule.Enabled = "true"
+				rule.Permissions = item.Permissions
+				rule.Description = au.ManagedDescription
+				if item.GrantType == "object" {
+					rule.ObjectURI = f.URI + "/**"
+				} else if item.GrantType == "conveyed" {
+					rule.ContainerURI = f.URI
+				}
+				target = append(target, rule)
+			}
+			current, err := au.List(co, "or(eq(containerUri,'"+f.URI+"'),eq(objectUri,'"+f.URI+"/**'))")
+			if err != nil {
+				return err
+			}
+			return reconcile(current, target, func(rule *au.Authorization) bool {
+				return (rule.Type != "grant" && !rule.Managed()) || (managedOnly && !rule.Managed())
+			}, "Removing authorization rule not described by the pattern", "folder", f.Path)
+		}, dependencies...)
+	}
+	fails.execute(&operations)
+	return nil
+}
+
+func init() {
+	ipapCmd.AddCommand(ipapSyncCmd)
+	ipapSyncCmd.Flags().BoolP("create-groups", "g", false, "create missing custom groups")
+	ipapSyncCmd.Flags().BoolP("create-folders", "f", false, "create missing SAS Viya content folders")
+	ipapSyncCmd.Flags().BoolP("managed-only", "m", false, "only remove authorization rules enabled by goViyaAuth")
+}
@@ -4,13 +4,16 @@
 package cmd
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 
 	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
-	fi "github.com/sassoftware/sas-viya-authorization-model/file"
 	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
 	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	ta "github.com/sassoftware/sas-viya-authorization-model/task"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -21,53 +24,99 @@ var matrixApplyCmd = &cobra.Command{
 	Short: "Apply Matrix",
 	Long:  `Apply a SAS Viya Platform Capability Matrix [matrix].`,
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		new(lo.Log).New()
 		createGroups, _ := cmd.Flags().GetBool("create-groups")
 		zap.S().Infow("Applying a SAS Viya Platform Capability Matrix", "matrix", args[0], "create-groups", createGroups)
-		co := new(co.Connection)
-		co.Connect()
-		fi := new(fi.File)
-		fi.Path = args[0]
-		fi.Schema = []string{"URI", "Principal", "Permissions"}
-		fi.Type = "csv"
-		fi.Read()
-		principals := make(map[string]*pr.Principal)
-		for _, item := range fi.Content.([][]string)[1:] {
-			zap.S().Infow("Granting SAS Viya Platform Capability", "item", item)
-			var principal string = item[1]
-			if _, exists := principals[principal]; !exists {
-				principals[principal] = new(pr.Principal)
-				principals[principal].ID = principal
-				principals[principal].Name = principal
-				principals[principal].Connection = co
-				if principal == "authenticatedUsers" {
-					principals[principal].Type = principal
-					principals[principal].Exists = true
-				} else {
-					principals[principal].Type = "group"
-					principals[principal].Validate()
-				}
-			}
-			if createGroups && !principals[principal].Exists {
-				principals[principal].Create()
+		rows, err := mo.ReadMatrix(args[0])
+		if err != nil {
+			return err
+		}
+		if err := lintModel(mo.Files{Matrix: rows}); err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		if err := applyMatrix(co, rows, createGroups, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// applyMatrix enables the authorization rules of a capability matrix
+func applyMatrix(co *co.Connection, rows []mo.CapabilityRow, createGroups bool, fails *failures) error {
+	var operations ta.Graph
+	principals := make(map[string]*pr.Principal)
+	for i, row := range rows {
+		var principal string = row.Principal
+		if _, exists := principals[principal]; !exists {
+			p := new(pr.Principal)
+			p.ID = principal
+			p.Name = principal
+			p.Connection = co
+			principals[principal] = p
+			if principal == "authenticatedUsers" {
+				p.Type = principal
+				p.Exists = true
+			} else {
+				p.Type = "group"
 			}
-			if item[0] != "" {
-				au := new(au.Authorization)
-				au.Principal = principals[principal]
-				au.Type = "grant"
-				au.Enabled = "true"
-				au.Permissions = strings.Split(item[2], ",")
-				au.Description = "Automatically enabled by goViyaAuth"
-				au.ObjectURI = item[0]
-				au.Validate()
-				if au.IDs == nil {
-					au.Enable()
+			operations.Add("group "+principal, func() error {
+				if err := p.Validate(); err != nil {
+					return err
 				}
-			}
+				if createGroups && !p.Exists {
+					return p.Create()
+				}
+				return nil
+			})
 		}
-		co.Disconnect()
-	},
+		if row.URI != "" {
+			p := principals[principal]
+			row := row
+			operations.Add("rule "+strconv.Itoa(i), func() error {
+				zap.S().Infow("Granting SAS Viya Platform Capability", "uri", row.URI, "principal", row.Principal, "permissions", row.Permissions)
+				rule := new(au.Authorization)
+				rule.Principal = p
+				ruleOptions(rule, row.RuleOptions)
+				rule.Enabled = "true"
+				rule.Permissions = row.Permissions
+				rule.Description = au.ManagedDescription
+				rule.ObjectURI = row.URI
+				comparison, err := rule.Compare()
+				if err != nil {
+					return err
+				}
+				switch comparison.State {
+				case au.Missing:
+					return rule.Enable()
+				case au.Differs:
+					return fmt.Errorf("authorization rule %s of %s on %s differs from the matrix in %s, use matrix sync to update it", comparison.IDs[0], row.Principal, row.URI, strings.Join(comparison.Differences, ", "))
+				}
+				return nil
+			}, "group "+principal)
+		}
+	}
+	fails.execute(&operations)
+	return nil
+}
+
+// ruleOptions sets the type, condition, media type, expiration and reason of a model row on an authorization rule
+func ruleOptions(rule *au.Authorization, options mo.RuleOptions) {
+	rule.Type = options.RuleType()
+	rule.Condition = options.Condition
+	rule.MediaType = options.MediaType
+	rule.ExpirationTimeStamp = options.ExpirationTimestamp
+	rule.Reason = options.Reason
 }
 
 func init() {
@@ -4,11 +4,14 @@
 package cmd
 
 import (
+	"strconv"
+
 	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
-	fi "github.com/sassoftware/sas-viya-authorization-model/file"
 	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
 	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	ta "github.com/sassoftware/sas-viya-authorization-model/task"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -19,50 +22,80 @@ var matrixRemoveCmd = &cobra.Command{
 	Short: "Remove Matrix",
 	Long:  `Remove a SAS Viya Platform Capability Matrix [matrix].`,
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		new(lo.Log).New()
 		deleteGroups, _ := cmd.Flags().GetBool("delete-groups")
 		zap.S().Infow("Removing a SAS Viya Platform Capability Matrix", "matrix", args[0], "delete-groups", deleteGroups)
-		co := new(co.Connection)
-		co.Connect()
-		fi := new(fi.File)
-		fi.Path = args[0]
-		fi.Schema = []string{"URI", "Principal", "Permissions"}
-		fi.Type = "csv"
-		fi.Read()
-		principals := make(map[string]*pr.Principal)
-		for _, item := range fi.Content.([][]string)[1:] {
-			zap.S().Infow("Removing SAS Viya Platform Capability", "item", item)
-			var principal string = item[1]
-			if _, exists := principals[principal]; !exists {
-				principals[principal] = new(pr.Principal)
-				principals[principal].ID = principal
-				principals[principal].Name = principal
-				principals[principal].Connection = co
-				if principal == "authenticatedUsers" {
-					principals[principal].Type = principal
-					principals[principal].Exists = true
-				} else {
-					principals[principal].Type = "group"
-					principals[principal].Validate()
-				}
-			}
-			if deleteGroups && principals[principal].Exists {
-				principals[principal].Delete()
+		rows, err := mo.ReadMatrix(args[0])
+		if err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		if err := removeMatrix(co, rows, deleteGroups, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// removeMatrix deletes the authorization rules of a capability matrix
+func removeMatrix(co *co.Connection, rows []mo.CapabilityRow, deleteGroups bool, fails *failures) error {
+	var operations ta.Graph
+	principals := make(map[string]*pr.Principal)
+	for i, row := range rows {
+		var principal string = row.Principal
+		if _, exists := principals[principal]; !exists {
+			p := new(pr.Principal)
+			p.ID = principal
+			p.Name = principal
+			p.Connection = co
+			principals[principal] = p
+			if principal == "authenticatedUsers" {
+				p.Type = principal
+				p.Exists = true
+			} else {
+				p.Type = "group"
 			}
-			if item[0] != "" {
-				au := new(au.Authorization)
-				au.Principal = principals[principal]
-				au.Type = "grant"
-				au.ObjectURI = item[0]
-				au.Validate()
-				if au.IDs != nil {
-					au.Delete()
+			operations.Add("group "+principal, func() error {
+				if err := p.Validate(); err != nil {
+					return err
 				}
-			}
+				if deleteGroups && p.Exists {
+					return p.Delete()
+				}
+				return nil
+			})
 		}
-		co.Disconnect()
-	},
+		if row.URI != "" {
+			p := principals[principal]
+			row := row
+			operations.Add("rule "+strconv.Itoa(i), func() error {
+				zap.S().Infow("Removing SAS Viya Platform Capability", "uri", row.URI, "principal", row.Principal, "permissions", row.Permissions)
+				rule := new(au.Authorization)
+				rule.Principal = p
+				ruleOptions(rule, row.RuleOptions)
+				rule.ObjectURI = row.URI
+				if err := rule.Validate(); err != nil {
+					return err
+				}
+				if rule.IDs != nil {
+					return rule.Delete()
+				}
+				return nil
+			}, "group "+principal)
+		}
+	}
+	fails.execute(&operations)
+	return nil
 }
 
 func init() {
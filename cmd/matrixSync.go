@@ -0,0 +1,165 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+
+	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	ta "github.com/sassoftware/sas-viya-authorization-model/task"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// matrixSyncCmd represents the matrixSync command
+var matrixSyncCmd = &cobra.Command{
+	Use:   "sync [matrix]",
+	Short: "Sync Matrix (apply and/or remove automatically)",
+	Long:  `Synchronize the authorization rules of a SAS Viya Platform Capability Matrix [matrix]. Grants on the listed URIs that are not part of the matrix are removed and missing grants are added.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		createGroups, _ := cmd.Flags().GetBool("create-groups")
+		managedOnly, _ := cmd.Flags().GetBool("managed-only")
+		syncPrincipals, _ := cmd.Flags().GetBool("principals")
+		protected, _ := cmd.Flags().GetStringSlice("protect")
+		zap.S().Infow("Synchronizing a SAS Viya Platform Capability Matrix (applying and/or removing automatically)", "matrix", args[0], "create-groups", createGroups, "managed-only", managedOnly, "principals", syncPrincipals, "protect", protected)
+		rows, err := mo.ReadMatrix(args[0])
+		if err != nil {
+			return err
+		}
+		if err := lintModel(mo.Files{Matrix: rows}); err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		if err := syncMatrix(co, rows, createGroups, managedOnly, syncPrincipals, protected, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// isProtected reports whether an authorization rule belongs to a protected principal or principal type
+func isProtected(rule *au.Authorization, protected []string) bool {
+	for _, principal := range protected {
+		if strings.EqualFold(principal, rule.Principal.ID) || strings.EqualFold(principal, rule.Principal.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncMatrix synchronizes the authorization rules of capability URIs with a matrix
+func syncMatrix(co *co.Connection, rows []mo.CapabilityRow, createGroups, managedOnly, syncPrincipals bool, protected []string, fails *failures) error {
+	var operations ta.Graph
+	principals := make(map[string]*pr.Principal)
+	items := make(map[string][]mo.CapabilityRow)
+	dependencies := make(map[string][]string)
+	var uris, ids []string
+	for _, row := range rows {
+		var principal string = row.Principal
+		if _, exists := principals[principal]; !exists {
+			p := new(pr.Principal)
+			p.ID = principal
+			p.Name = principal
+			p.Connection = co
+			principals[principal] = p
+			ids = append(ids, principal)
+			if principal == "authenticatedUsers" {
+				p.Type = principal
+				p.Exists = true
+			} else {
+				p.Type = "group"
+			}
+			operations.Add("group "+principal, func() error {
+				if err := p.Validate(); err != nil {
+					return err
+				}
+				if createGroups && !p.Exists {
+					return p.Create()
+				}
+				return nil
+			})
+		}
+		if row.URI != "" {
+			if _, exists := items[row.URI]; !exists {
+				uris = append(uris, row.URI)
+			}
+			items[row.URI] = append(items[row.URI], row)
+			dependencies[row.URI] = append(dependencies[row.URI], "group "+principal)
+		}
+	}
+	for _, uri := range uris {
+		uri := uri
+		operations.Add("rules "+uri, func() error {
+			var target []*au.Authorization
+			for _, row := range items[uri] {
+				rule := new(au.Authorization)
+				rule.Principal = principals[row.Principal]
+				ruleOptions(rule, row.RuleOptions)
+				rule.Enabled = "true"
+				rule.Permissions = row.Permissions
+				rule.Description = au.ManagedDescription
+				rule.ObjectURI = uri
+				target = append(target, rule)
+			}
+			current, err := au.List(co, "eq(objectUri,'"+uri+"')")
+			if err != nil {
+				return err
+			}
+			return reconcile(current, target, func(rule *au.Authorization) bool {
+				return (rule.Type != "grant" && !rule.Managed()) || (managedOnly && !rule.Managed()) || isProtected(rule, protected)
+			}, "Removing authorization rule not described by the matrix", "uri", uri)
+		}, dependencies[uri]...)
+	}
+	if syncPrincipals {
+		for _, id := range ids {
+			p := principals[id]
+			operations.Add("rules principal "+id, func() error {
+				var filter string = "eq(principal,'" + p.ID + "')"
+				if p.Type != "group" {
+					filter = "eq(principalType,'" + p.Type + "')"
+				}
+				current, err := au.List(co, filter)
+				if err != nil {
+					return err
+				}
+				// only rules on capability URIs are described by the matrix, folder rules belong to IPAPs
+				for _, rule := range current {
+					if _, listed := items[rule.ObjectURI]; listed || !rule.Capability() || (rule.Type != "grant" && !rule.Managed()) || (managedOnly && !rule.Managed()) || isProtected(rule, protected) {
+						continue
+					}
+					zap.S().Infow("Removing authorization rule on a URI not listed in the matrix", "uri", rule.ObjectURI, "principal", rule.Principal.ID, "principalType", rule.Principal.Type, "permissions", rule.Permissions)
+					if err := rule.Delete(); err != nil {
+						return err
+					}
+				}
+				return nil
+			}, "group "+id)
+		}
+	}
+	fails.execute(&operations)
+	return nil
+}
+
+func init() {
+	matrixCmd.AddCommand(matrixSyncCmd)
+	matrixSyncCmd.Flags().BoolP("create-groups", "g", false, "create missing custom groups")
+	matrixSyncCmd.Flags().BoolP("managed-only", "m", false, "only remove authorization rules enabled by goViyaAuth")
+	matrixSyncCmd.Flags().BoolP("principals", "p", false, "also remove grants of the listed principals on capability URIs that are not part of the matrix")
+	matrixSyncCmd.Flags().StringSlice("protect", []string{"SASAdministrators"}, "principals whose authorization rules are never removed")
+}
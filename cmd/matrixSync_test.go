@@ -0,0 +1,38 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+
+	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	vt "github.com/sassoftware/sas-viya-authorization-model/viyatest"
+)
+
+func TestSyncMatrixPrincipals(t *testing.T) {
+	v := vt.New()
+	v.AddGroup("HR", "Human Resources", "")
+	hr := v.AddFolder("/Projects/HR")
+	folder := v.AddRule(vt.Rule{Principal: "HR", PrincipalType: "group", Type: "grant", Permissions: []string{"read"}, ObjectURI: hr + "/**", Description: au.ManagedDescription, Enabled: true})
+	conveyed := v.AddRule(vt.Rule{Principal: "HR", PrincipalType: "group", Type: "grant", Permissions: []string{"read"}, ContainerURI: hr, Description: au.ManagedDescription, Enabled: true})
+	v.AddRule(vt.Rule{Principal: "HR", PrincipalType: "group", Type: "grant", Permissions: []string{"read"}, ObjectURI: "/SASEnvironmentManager/**", Description: au.ManagedDescription, Enabled: true})
+	c, err := v.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	rows := []mo.CapabilityRow{{URI: "/SASDrive/**", Principal: "HR", Permissions: []string{"read"}}}
+	var fails failures
+	if err := syncMatrix(c, rows, false, true, true, []string{"SASAdministrators"}, &fails); err != nil || fails.err() != nil {
+		t.Fatalf("Expected: %v, Returned: %v (%v).", nil, err, fails.err())
+	}
+	// the rules of the IPAP on the folder survive, the grant on the capability URI outside of the matrix is removed
+	rules := v.Rules()
+	if len(rules) != 3 {
+		t.Fatalf("Expected: %v, Returned: %v.", 3, rules)
+	}
+	if rules[0].ID != folder || rules[1].ID != conveyed || rules[2].ObjectURI != "/SASDrive/**" {
+		t.Errorf("Expected: %v, Returned: %v.", []string{folder, conveyed, "/SASDrive/**"}, rules)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// modelCmd represents the model command
+var modelCmd = &cobra.Command{
+	Use:   "model",
+	Short: "SAS Viya Authorization Model",
+	Long:  `Apply, Remove, Sync or Plan a complete authorization model (groups, capability matrix, IPAP and DAP) defined in a single YAML or JSON file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+	},
+}
+
+// step is a part of the model processed by one of the concept commands
+type step struct {
+	concept string
+	run     func() error
+}
+
+// runSteps runs the steps of a model command in order. Steps are separated, so that e.g. all custom groups exist
+// before authorization rules refer to them
+func runSteps(steps []step) error {
+	for _, s := range steps {
+		zap.S().Infow("Processing model concept", "concept", s.concept)
+		if err := s.run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncModel synchronizes all concepts of a model in the order groups, matrix, IPAP and DAP
+func syncModel(cmd *cobra.Command, co *co.Connection, m *mo.Model, fails *failures) error {
+	createGroups, _ := cmd.Flags().GetBool("create-groups")
+	createFolders, _ := cmd.Flags().GetBool("create-folders")
+	createCASLIBs, _ := cmd.Flags().GetBool("create-caslibs")
+	deleteGroups, _ := cmd.Flags().GetBool("delete-groups")
+	managedOnly, _ := cmd.Flags().GetBool("managed-only")
+	syncPrincipals, _ := cmd.Flags().GetBool("principals")
+	protected, _ := cmd.Flags().GetStringSlice("protect")
+	ipapPatterns, ipapFolders := m.IPAPRows()
+	dapPatterns, dapCASLIBs := m.DAPRows()
+	return runSteps([]step{
+		{"groups", func() error {
+			return syncGroups(co, m.GroupRows(), deleteGroups, fails)
+		}},
+		{"matrix", func() error {
+			return syncMatrix(co, m.MatrixRows(), createGroups, managedOnly, syncPrincipals, protected, fails)
+		}},
+		{"ipap", func() error {
+			return syncIPAP(co, ipapPatterns, ipapFolders, createGroups, createFolders, managedOnly, fails)
+		}},
+		{"dap", func() error {
+			return syncDAP(co, dapPatterns, dapCASLIBs, createGroups, createCASLIBs, fails)
+		}},
+	})
+}
+
+// syncFlags adds the flags of syncModel to a command
+func syncFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("create-groups", "g", false, "create missing custom groups referenced by the matrix, IPAP or DAP")
+	cmd.Flags().BoolP("create-folders", "f", false, "create missing SAS Viya content folders")
+	cmd.Flags().BoolP("create-caslibs", "c", false, "create missing CASLIBs")
+	cmd.Flags().BoolP("delete-groups", "d", false, "delete custom groups that are not part of the model")
+	cmd.Flags().BoolP("managed-only", "m", false, "only remove authorization rules enabled by goViyaAuth")
+	cmd.Flags().BoolP("principals", "p", false, "also remove grants of the matrix principals on object URIs that are not part of the matrix")
+	cmd.Flags().StringSlice("protect", []string{"SASAdministrators"}, "principals whose authorization rules are never removed")
+}
+
+func init() {
+	rootCmd.AddCommand(modelCmd)
+}
@@ -0,0 +1,71 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// modelApplyCmd represents the modelApply command
+var modelApplyCmd = &cobra.Command{
+	Use:   "apply [model]",
+	Short: "Apply Model",
+	Long:  `Apply a complete SAS Viya authorization model [model]: custom groups first, followed by the platform capability matrix, the IPAP and the DAP.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		createGroups, _ := cmd.Flags().GetBool("create-groups")
+		createFolders, _ := cmd.Flags().GetBool("create-folders")
+		createCASLIBs, _ := cmd.Flags().GetBool("create-caslibs")
+		overwritePattern, _ := cmd.Flags().GetBool("overwrite-pattern")
+		zap.S().Infow("Applying a SAS Viya authorization model", "model", args[0], "create-groups", createGroups, "create-folders", createFolders, "create-caslibs", createCASLIBs, "overwrite-pattern", overwritePattern)
+		m, err := mo.Read(args[0])
+		if err != nil {
+			return err
+		}
+		if err := lintModel(m.Files()); err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		ipapPatterns, ipapFolders := m.IPAPRows()
+		dapPatterns, dapCASLIBs := m.DAPRows()
+		if err := runSteps([]step{
+			{"groups", func() error {
+				return applyGroups(co, m.GroupRows(), &fails)
+			}},
+			{"matrix", func() error {
+				return applyMatrix(co, m.MatrixRows(), createGroups, &fails)
+			}},
+			{"ipap", func() error {
+				return applyIPAP(co, ipapPatterns, ipapFolders, createGroups, createFolders, overwritePattern, &fails)
+			}},
+			{"dap", func() error {
+				return applyDAP(co, dapPatterns, dapCASLIBs, createGroups, createCASLIBs, &fails)
+			}},
+		}); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+func init() {
+	modelCmd.AddCommand(modelApplyCmd)
+	modelApplyCmd.Flags().BoolP("create-groups", "g", false, "create missing custom groups referenced by the matrix, IPAP or DAP")
+	modelApplyCmd.Flags().BoolP("create-folders", "f", false, "create missing SAS Viya content folders")
+	modelApplyCmd.Flags().BoolP("create-caslibs", "c", false, "create missing CASLIBs")
+	modelApplyCmd.Flags().BoolP("overwrite-pattern", "o", false, "overwrite an existing IPAP")
+}
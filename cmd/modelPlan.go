@@ -0,0 +1,50 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// modelPlanCmd represents the modelPlan command
+var modelPlanCmd = &cobra.Command{
+	Use:   "plan [model]",
+	Short: "Plan Model",
+	Long:  `Print the changes a sync of a complete SAS Viya authorization model [model] would make, without applying them. Equivalent to model sync --plan.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		zap.S().Infow("Computing plan for a SAS Viya authorization model", "model", args[0])
+		m, err := mo.Read(args[0])
+		if err != nil {
+			return err
+		}
+		if err := lintModel(m.Files()); err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		co.Plan = new(pl.Plan)
+		var fails failures
+		if err := syncModel(cmd, co, m, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+func init() {
+	modelCmd.AddCommand(modelPlanCmd)
+	syncFlags(modelPlanCmd)
+}
@@ -0,0 +1,65 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// modelRemoveCmd represents the modelRemove command
+var modelRemoveCmd = &cobra.Command{
+	Use:   "remove [model]",
+	Short: "Remove Model",
+	Long:  `Remove a complete SAS Viya authorization model [model] in reverse order: the DAP first, followed by the IPAP, the platform capability matrix and finally the custom groups.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		deleteFolders, _ := cmd.Flags().GetBool("delete-folders")
+		membersOnly, _ := cmd.Flags().GetBool("members")
+		zap.S().Infow("Removing a SAS Viya authorization model", "model", args[0], "delete-folders", deleteFolders, "members", membersOnly)
+		m, err := mo.Read(args[0])
+		if err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		ipapPatterns, ipapFolders := m.IPAPRows()
+		dapPatterns, dapCASLIBs := m.DAPRows()
+		// custom groups are only deleted by the last step, so that their rules can still be found before
+		if err := runSteps([]step{
+			{"dap", func() error {
+				return removeDAP(co, dapPatterns, dapCASLIBs, false, &fails)
+			}},
+			{"ipap", func() error {
+				return removeIPAP(co, ipapPatterns, ipapFolders, false, deleteFolders, &fails)
+			}},
+			{"matrix", func() error {
+				return removeMatrix(co, m.MatrixRows(), false, &fails)
+			}},
+			{"groups", func() error {
+				return removeGroups(co, m.GroupRows(), membersOnly, &fails)
+			}},
+		}); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+func init() {
+	modelCmd.AddCommand(modelRemoveCmd)
+	modelRemoveCmd.Flags().BoolP("delete-folders", "f", false, "delete listed SAS Viya content folders recursively. WARNING: Also deletes non-empty folders!")
+	modelRemoveCmd.Flags().BoolP("members", "m", false, "remove only the members of each group instead of the groups")
+}
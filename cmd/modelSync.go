@@ -0,0 +1,49 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// modelSyncCmd represents the modelSync command
+var modelSyncCmd = &cobra.Command{
+	Use:   "sync [model]",
+	Short: "Sync Model (apply and/or remove automatically)",
+	Long:  `Synchronize a SAS Viya environment with a complete authorization model [model]: custom groups first, followed by the platform capability matrix, the IPAP and the DAP.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		zap.S().Infow("Synchronizing a SAS Viya authorization model (applying and/or removing automatically)", "model", args[0])
+		m, err := mo.Read(args[0])
+		if err != nil {
+			return err
+		}
+		if err := lintModel(m.Files()); err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		startPlan(cmd, co)
+		var fails failures
+		if err := syncModel(cmd, co, m, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+func init() {
+	modelCmd.AddCommand(modelSyncCmd)
+	syncFlags(modelSyncCmd)
+}
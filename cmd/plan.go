@@ -0,0 +1,60 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	jo "github.com/sassoftware/sas-viya-authorization-model/journal"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// startPlan switches the connection into plan mode if requested, otherwise the changes are recorded in the journal
+func startPlan(cmd *cobra.Command, c *co.Connection) {
+	if planMode, _ := cmd.Flags().GetBool("plan"); planMode {
+		zap.S().Infow("Computing plan, no changes will be applied")
+		c.Plan = new(pl.Plan)
+		return
+	}
+	if path := viper.GetString("journal"); path != "" {
+		c.Journal = &jo.Journal{Path: path}
+	}
+}
+
+// finishPlan prints the computed plan and optionally writes it as JSON. The text is printed to stderr if the JSON is
+// written to stdout, so that the JSON can be piped
+func finishPlan(cmd *cobra.Command, c *co.Connection) error {
+	if c.Plan == nil {
+		return nil
+	}
+	output, _ := cmd.Flags().GetString("plan-output")
+	if output == "-" {
+		c.Plan.WriteText(os.Stderr)
+		if err := c.Plan.WriteJSON(os.Stdout); err != nil {
+			return fmt.Errorf("writing plan: %w", err)
+		}
+		return nil
+	}
+	c.Plan.WriteText(os.Stdout)
+	if output == "" {
+		return nil
+	}
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("writing plan: %w", err)
+	}
+	if err := c.Plan.WriteJSON(f); err != nil {
+		f.Close()
+		return fmt.Errorf("writing plan %s: %w", output, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing plan %s: %w", output, err)
+	}
+	return nil
+}
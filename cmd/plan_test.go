@@ -0,0 +1,22 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
+	"github.com/spf13/cobra"
+)
+
+func TestFinishPlanOutput(t *testing.T) {
+	cmd := new(cobra.Command)
+	cmd.Flags().String("plan-output", "missing/plan.json", "")
+	c := &co.Connection{Plan: new(pl.Plan)}
+	c.Plan.Add("create", "group", "HR", nil)
+	if err := finishPlan(cmd, c); err == nil {
+		t.Errorf("Expected: %v, Returned: %v.", "error writing plan", err)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	po "github.com/sassoftware/sas-viya-authorization-model/policy"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// lintModel evaluates the configured policy file against the model rows, or the snapshot rows of restore and promote,
+// before any change is made, so that a model violating a policy is never applied. The policies lint the model rather
+// than the planned changes: grants deleted by sync commands and grants in SAS Viya outside of the model are not checked
+func lintModel(files mo.Files) error {
+	var path string = viper.GetString("policy")
+	if path == "" {
+		return nil
+	}
+	p, err := po.Read(path)
+	if err != nil {
+		return err
+	}
+	if violations := p.Evaluate(files); len(violations) > 0 {
+		writeDiagnostics(os.Stdout, violations)
+		return &exitError{
+			code: exitPolicy,
+			err:  fmt.Errorf("%d policy violation(s), no changes were made", len(violations)),
+		}
+	}
+	zap.S().Infow("Model complies with all policies", "policy", path, "policies", len(p.Policies))
+	return nil
+}
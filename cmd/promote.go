@@ -0,0 +1,126 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+
+	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	sn "github.com/sassoftware/sas-viya-authorization-model/snapshot"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// promoteCmd represents the promote command
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Promote the authorization state of one environment to another",
+	Long:  `Apply the differences between the custom groups, memberships, folders, authorization rules and CAS access controls of the SAS Viya environment of the --from profile and the environment of the --to profile to the latter. Folders are matched by path, so rules on folders with different URIs are promoted as well. Rules on other content, e.g. reports, are left unchanged.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		p, err := newPromotion(cmd)
+		if err != nil {
+			return err
+		}
+		defer disconnect(p.target)
+		if err := lintModel(restoreFiles(p.source, p.source.BaseURL, p.parts)); err != nil {
+			return err
+		}
+		startPlan(cmd, p.target)
+		var fails failures
+		if err := restoreSnapshot(p.target, p.source, p.parts, p.deleteGroups, p.keep, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, p.target); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// promotion of the authorization state of a source environment to a target environment
+type promotion struct {
+	source       *sn.Snapshot
+	target       *co.Connection
+	parts        map[string]bool
+	deleteGroups bool
+	keep         func(rule *au.Authorization) bool
+}
+
+// newPromotion connects to the source and target environments of the flags
+func newPromotion(cmd *cobra.Command) (*promotion, error) {
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	include, _ := cmd.Flags().GetStringSlice("include")
+	exclude, _ := cmd.Flags().GetStringSlice("exclude-folders")
+	deleteGroups, _ := cmd.Flags().GetBool("delete-groups")
+	zap.S().Infow("Comparing the authorization state of two SAS Viya environments", "from", from, "to", to, "include", include, "exclude-folders", exclude, "delete-groups", deleteGroups)
+	if from == "" || to == "" {
+		return nil, errors.New("--from and --to need to be provided")
+	}
+	if from == to {
+		return nil, errors.New("--from and --to need to be different profiles")
+	}
+	parts, err := restoreParts(include)
+	if err != nil {
+		return nil, err
+	}
+	source := newConnection(from)
+	if err := source.Connect(); err != nil {
+		return nil, err
+	}
+	defer disconnect(source)
+	target := newConnection(to)
+	if err := target.Connect(); err != nil {
+		return nil, err
+	}
+	p, err := promote(source, target, parts, exclude, deleteGroups)
+	if err != nil {
+		disconnect(target)
+		return nil, err
+	}
+	return p, nil
+}
+
+// promote takes a snapshot of the source environment for a promotion to the target environment. Rules on content
+// other than folders, e.g. on reports, are neither promoted nor deleted in the target environment, as the IDs in their
+// URIs differ between environments
+func promote(source, target *co.Connection, parts map[string]bool, exclude []string, deleteGroups bool) (*promotion, error) {
+	s, err := sn.Take(source)
+	if err != nil {
+		return nil, err
+	}
+	s.Exclude(exclude)
+	s.ExcludeContent()
+	excluded, err := sn.Excluded(target, exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &promotion{
+		source:       s,
+		target:       target,
+		parts:        parts,
+		deleteGroups: deleteGroups,
+		keep: func(rule *au.Authorization) bool {
+			return sn.OnFolder(rule, excluded) || sn.OnContent(rule)
+		},
+	}, nil
+}
+
+// promotionFlags adds the flags shared by diff and promote
+func promotionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("from", "", "sas-viya CLI profile of the source environment")
+	cmd.Flags().String("to", "", "sas-viya CLI profile of the target environment")
+	cmd.Flags().StringSlice("include", []string{"groups", "folders", "rules", "caslibs"}, "parts of the authorization state to compare")
+	cmd.Flags().StringSlice("exclude-folders", []string{"/Users"}, "folder trees to skip")
+	cmd.Flags().BoolP("delete-groups", "g", false, "include custom groups that only exist in the target environment")
+}
+
+func init() {
+	rootCmd.AddCommand(promoteCmd)
+	promotionFlags(promoteCmd)
+}
@@ -0,0 +1,61 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	vt "github.com/sassoftware/sas-viya-authorization-model/viyatest"
+)
+
+func TestPromote(t *testing.T) {
+	from := vt.New()
+	from.AddGroup("HR", "Human Resources", "")
+	projects := from.AddFolder("/Projects")
+	from.AddRule(vt.Rule{Principal: "HR", PrincipalType: "group", Type: "grant", Permissions: []string{"read"}, ObjectURI: projects + "/**", Enabled: true})
+	from.AddRule(vt.Rule{Principal: "HR", PrincipalType: "group", Type: "grant", Permissions: []string{"read"}, ObjectURI: "/SASDrive/**", Enabled: true})
+	from.AddRule(vt.Rule{Principal: "HR", PrincipalType: "group", Type: "grant", Permissions: []string{"read"}, ObjectURI: "/reports/reports/00000000-0000-4000-8000-000000000101", Enabled: true})
+	to := vt.New()
+	to.AddFolder("/Archive")
+	to.AddGroup("HR", "Human Resources", "")
+	report := vt.Rule{Principal: "HR", PrincipalType: "group", Type: "grant", Permissions: []string{"read", "update"}, ObjectURI: "/reports/reports/00000000-0000-4000-8000-000000000201", Enabled: true}
+	to.AddRule(report)
+	source, err := from.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	target, err := to.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	parts, _ := restoreParts([]string{"groups", "folders", "rules", "caslibs"})
+	p, err := promote(source, target, parts, []string{"/Users"}, false)
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	var fails failures
+	if err := restoreSnapshot(p.target, p.source, p.parts, p.deleteGroups, p.keep, &fails); err != nil || fails.err() != nil {
+		t.Fatalf("Expected: %v, Returned: %v (%v).", nil, err, fails.err())
+	}
+	// the rule on the folder is promoted to the URI of the folder in the target environment, while the rules on
+	// reports of either environment are left unchanged
+	var folder string
+	for _, f := range to.Folders() {
+		if f.Path == "/Projects" {
+			folder = f.URI
+		}
+	}
+	if folder == "" || folder == projects {
+		t.Fatalf("Expected: %v, Returned: %v.", "a different folder URI", folder)
+	}
+	var returned []string
+	for _, rule := range to.Rules() {
+		returned = append(returned, rule.ObjectURI)
+	}
+	expected := []string{report.ObjectURI, folder + "/**", "/SASDrive/**"}
+	if !reflect.DeepEqual(expected, returned) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
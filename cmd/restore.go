@@ -0,0 +1,192 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+
+	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	fo "github.com/sassoftware/sas-viya-authorization-model/folder"
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	sn "github.com/sassoftware/sas-viya-authorization-model/snapshot"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore [snapshot]",
+	Short: "Restore the authorization state of a snapshot",
+	Long:  `Reconcile a SAS Viya environment back to the authorization state of a [snapshot]: missing custom groups, memberships, folders and CASLIBs are created, surplus memberships are removed, and the authorization rules and direct CAS access controls are synchronized with the snapshot. Folders, CASLIBs and content created after the snapshot are kept.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		include, _ := cmd.Flags().GetStringSlice("include")
+		deleteGroups, _ := cmd.Flags().GetBool("delete-groups")
+		zap.S().Infow("Restoring the SAS Viya authorization state of a snapshot", "snapshot", args[0], "include", include, "delete-groups", deleteGroups)
+		parts, err := restoreParts(include)
+		if err != nil {
+			return err
+		}
+		s, err := sn.Read(args[0])
+		if err != nil {
+			return err
+		}
+		zap.S().Infow("Read snapshot", "created", s.Created, "baseURL", s.BaseURL, "groups", len(s.Groups), "folders", len(s.Folders), "rules", len(s.Rules), "CASLIBs", len(s.CASLIBs))
+		if err := lintModel(restoreFiles(s, args[0], parts)); err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		if s.BaseURL != co.BaseURL {
+			zap.S().Warnw("The snapshot was taken of a different SAS Viya environment", "snapshot", s.BaseURL, "baseURL", co.BaseURL)
+		}
+		startPlan(cmd, co)
+		var fails failures
+		if err := restoreSnapshot(co, s, parts, deleteGroups, keepNone, &fails); err != nil {
+			return err
+		}
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// restoreParts validates the parts of a snapshot to restore
+func restoreParts(include []string) (map[string]bool, error) {
+	parts := make(map[string]bool)
+	for _, part := range include {
+		switch part {
+		case "groups", "folders", "rules", "caslibs":
+			parts[part] = true
+		default:
+			return nil, fmt.Errorf("unknown part %q, expected groups, folders, rules or caslibs", part)
+		}
+	}
+	return parts, nil
+}
+
+// restoreFiles returns the model rows of the parts of a snapshot that are restored, so that the policies are evaluated
+// against the grants that are written
+func restoreFiles(s *sn.Snapshot, source string, parts map[string]bool) mo.Files {
+	files := s.Files(source)
+	if !parts["groups"] {
+		files.Groups = nil
+	}
+	if !parts["rules"] {
+		files.Matrix, files.IPAPPatterns, files.IPAPFolders = nil, nil, nil
+	}
+	if !parts["caslibs"] {
+		files.DAPPatterns, files.DAPCASLIBs = nil, nil
+	}
+	return files
+}
+
+// keepNone keeps no current authorization rule that is not part of the snapshot
+func keepNone(rule *au.Authorization) bool {
+	return false
+}
+
+// restoreSnapshot reconciles the custom groups, folders, authorization rules and CASLIBs with a snapshot. Groups and
+// folders are restored first, as the rules and access controls refer to them. Current rules that are not part of the
+// snapshot are deleted unless kept
+func restoreSnapshot(co *co.Connection, s *sn.Snapshot, parts map[string]bool, deleteGroups bool, keep func(rule *au.Authorization) bool, fails *failures) error {
+	if parts["groups"] {
+		if err := syncGroups(co, s.GroupRows(), deleteGroups, fails); err != nil {
+			return err
+		}
+	}
+	if parts["folders"] || parts["rules"] {
+		uris := restoreFolders(co, s, parts["folders"], fails)
+		if parts["rules"] {
+			if err := restoreRules(co, s, uris, keep, fails); err != nil {
+				return err
+			}
+		}
+	}
+	if parts["caslibs"] {
+		restoreCASLIBs(co, s, fails)
+	}
+	return nil
+}
+
+// restoreFolders resolves the current URI of every snapshot folder by its path, creating missing folders if requested,
+// and returns the current URIs by snapshot URI
+func restoreFolders(co *co.Connection, s *sn.Snapshot, create bool, fails *failures) map[string]string {
+	uris := make(map[string]string)
+	folders := make(map[string]*fo.Folder)
+	for _, folder := range s.Folders {
+		f := &fo.Folder{Path: folder.Path, Parent: folders[path.Dir(folder.Path)], Connection: co}
+		folders[f.Path] = f
+		if fails.add(f.Validate()) {
+			continue
+		}
+		if !f.Exists && create && fails.add(f.Create()) {
+			continue
+		}
+		if f.Exists {
+			uris[folder.URI] = f.URI
+		}
+	}
+	return uris
+}
+
+// restoreRules synchronizes the authorization rules of every object and container URI with the snapshot, so that a
+// failure only affects the rules of a single URI
+func restoreRules(co *co.Connection, s *sn.Snapshot, uris map[string]string, keep func(rule *au.Authorization) bool, fails *failures) error {
+	current, err := au.List(co, "")
+	if err != nil {
+		return err
+	}
+	// rules are reconciled by their object and container URI
+	var keys [][2]string
+	currentRules := make(map[[2]string][]*au.Authorization)
+	targetRules := make(map[[2]string][]*au.Authorization)
+	for _, rule := range current {
+		key := [2]string{rule.ObjectURI, rule.ContainerURI}
+		if _, exists := currentRules[key]; !exists {
+			keys = append(keys, key)
+		}
+		currentRules[key] = append(currentRules[key], rule)
+	}
+	for _, rule := range s.Authorizations(co, uris) {
+		key := [2]string{rule.ObjectURI, rule.ContainerURI}
+		_, listed := currentRules[key]
+		if _, added := targetRules[key]; !listed && !added {
+			keys = append(keys, key)
+		}
+		targetRules[key] = append(targetRules[key], rule)
+	}
+	for _, key := range keys {
+		fails.add(reconcile(currentRules[key], targetRules[key], keep, "Deleting authorization rule that is not part of the snapshot", "objectUri", key[0], "containerUri", key[1]))
+	}
+	return nil
+}
+
+// restoreCASLIBs creates the missing CASLIBs of a snapshot and synchronizes the direct CAS access controls of all
+func restoreCASLIBs(co *co.Connection, s *sn.Snapshot, fails *failures) {
+	for _, caslib := range s.CASLIBs {
+		lib := caslib.LIB(co)
+		if fails.add(lib.Validate()) {
+			continue
+		}
+		if !lib.Exists && fails.add(lib.Create()) {
+			continue
+		}
+		fails.add(lib.Sync())
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().StringSlice("include", []string{"groups", "folders", "rules", "caslibs"}, "parts of the snapshot to restore")
+	restoreCmd.Flags().BoolP("delete-groups", "g", false, "delete custom groups that are not part of the snapshot")
+}
@@ -0,0 +1,138 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	ca "github.com/sassoftware/sas-viya-authorization-model/cas"
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	jo "github.com/sassoftware/sas-viya-authorization-model/journal"
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// rollbackCmd represents the rollback command
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [journal]",
+	Short: "Roll back the changes of a run",
+	Long:  `Roll back the changes recorded in a [journal] by an earlier apply, sync or remove run, also if that run stopped halfway. The changes are reverted one by one from the last to the first. Changes that cannot be reverted are reported and the rollback continues with the earlier changes.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		zap.S().Infow("Rolling back the changes of a run", "journal", args[0])
+		entries, err := jo.Read(args[0])
+		if err != nil {
+			return err
+		}
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		// the rollback itself is not recorded in a journal
+		if planMode, _ := cmd.Flags().GetBool("plan"); planMode {
+			zap.S().Infow("Computing plan, no changes will be applied")
+			co.Plan = new(pl.Plan)
+		}
+		var fails failures
+		rollback(co, entries, &fails)
+		if err := finishPlan(cmd, co); err != nil {
+			return err
+		}
+		return fails.err()
+	},
+}
+
+// rollback reverts the journal entries from the last to the first, as later changes may depend on earlier ones. The
+// new IDs of resources that are created again are kept by their former IDs for the earlier entries
+func rollback(co *co.Connection, entries []jo.Entry, fails *failures) {
+	ids := make(map[string]string)
+	for i := len(entries) - 1; i >= 0; i-- {
+		fails.add(revert(co, entries[i], ids))
+	}
+}
+
+// revert a single journal entry, sending its request to the new IDs of resources that were created again
+func revert(c *co.Connection, e jo.Entry, ids map[string]string) error {
+	zap.S().Infow("Reverting change", "action", e.Action, "resource", e.Resource, "target", e.Target, "time", e.Time)
+	if e.State != nil {
+		var controls []ca.Control
+		if err := json.Unmarshal(e.State, &controls); err != nil {
+			return fmt.Errorf("reverting %s of %s %s: %w", e.Action, e.Resource, e.Target, err)
+		}
+		lib := &ca.LIB{Name: e.Target, Connection: c}
+		return lib.Restore(controls)
+	}
+	if e.Inverse == nil {
+		return fmt.Errorf("%s of %s %s cannot be rolled back", e.Action, e.Resource, e.Target)
+	}
+	r := e.Inverse
+	if c.Plan != nil {
+		c.Plan.Add(r.Action, e.Resource, e.Target, map[string]interface{}{"method": r.Method, "path": r.Path})
+		return nil
+	}
+	path, query, body := replaced(r, ids)
+	if r.Session {
+		query = append(append([][]string{}, query...), []string{"sessionId", c.CASSession})
+	}
+	var header http.Header
+	if r.IfMatch {
+		_, current, _, err := c.CallWithHeader("GET", path, "", "", query, nil, nil)
+		if err != nil {
+			return fmt.Errorf("reverting %s of %s %s: %w", e.Action, e.Resource, e.Target, err)
+		}
+		header = http.Header{"If-Match": {current.Get("ETag")}}
+	}
+	response, _, _, err := c.CallWithHeader(r.Method, path, r.ContentType, "", query, body, header)
+	if err != nil {
+		if r.Method == "DELETE" && co.IsStatus(err, http.StatusNotFound) {
+			zap.S().Infow("Change was already reverted", "action", e.Action, "resource", e.Resource, "target", e.Target)
+			return nil
+		}
+		return fmt.Errorf("reverting %s of %s %s: %w", e.Action, e.Resource, e.Target, err)
+	}
+	if r.Replaces != "" {
+		result, _ := response.(map[string]interface{})
+		if id, ok := result["id"].(string); ok {
+			ids[r.Replaces] = id
+		}
+	}
+	return nil
+}
+
+// replaced returns the path, query and body of a request with the IDs of resources that were created again replaced
+// by their new IDs, i.e. the ID at the end of the path or of a query value and the id of the body
+func replaced(r *jo.Request, ids map[string]string) (path string, query [][]string, body []byte) {
+	replace := func(uri string) string {
+		i := strings.LastIndex(uri, "/")
+		if id, exists := ids[uri[i+1:]]; exists {
+			return uri[:i+1] + id
+		}
+		return uri
+	}
+	path, body = replace(r.Path), r.Body
+	for _, parameter := range r.Query {
+		query = append(query, []string{parameter[0], replace(parameter[1])})
+	}
+	var resource map[string]interface{}
+	if path != r.Path && json.Unmarshal(r.Body, &resource) == nil {
+		if _, exists := resource["id"]; exists {
+			resource["id"] = path[strings.LastIndex(path, "/")+1:]
+			if encoded, err := json.Marshal(resource); err == nil {
+				body = encoded
+			}
+		}
+	}
+	return path, query, body
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+}
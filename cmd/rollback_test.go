@@ -0,0 +1,105 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
+	jo "github.com/sassoftware/sas-viya-authorization-model/journal"
+	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	vt "github.com/sassoftware/sas-viya-authorization-model/viyatest"
+)
+
+func TestRollbackDeleteGroup(t *testing.T) {
+	v := vt.New()
+	v.AddUser("alice", "Alice")
+	v.AddGroup("per001", "Persona: Business User", "")
+	v.AddGroup("HR", `Human "Resources"`, "")
+	v.AddGroup("Sales", "Sales", "")
+	v.AddMember("HR", "user", "alice")
+	v.AddMember("HR", "group", "Sales")
+	v.AddMember("per001", "group", "HR")
+	c, err := v.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	c.Journal = &jo.Journal{Path: "test.journal"}
+	defer os.Remove("test.journal")
+	groups, members, parents := v.Groups(), v.Members("HR"), v.Members("per001")
+	g := &pr.Principal{ID: "HR", Type: "group", Name: `Human "Resources"`, Exists: true, Connection: c}
+	if err := g.Delete(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	c.Journal.Close()
+	entries, err := jo.Read("test.journal")
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	c.Journal = nil
+	var fails failures
+	rollback(c, entries, &fails)
+	if err := fails.err(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	// the group is created again with its name before its members and parent groups are restored
+	if !reflect.DeepEqual(groups, v.Groups()) {
+		t.Errorf("Expected: %v, Returned: %v.", groups, v.Groups())
+	}
+	restored := v.Members("HR")
+	for _, list := range [][]vt.Member{members, restored} {
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	}
+	if !reflect.DeepEqual(members, restored) {
+		t.Errorf("Expected: %v, Returned: %v.", members, restored)
+	}
+	if !reflect.DeepEqual(parents, v.Members("per001")) {
+		t.Errorf("Expected: %v, Returned: %v.", parents, v.Members("per001"))
+	}
+}
+
+func TestRollbackUpdateDeleteRule(t *testing.T) {
+	v := vt.New()
+	v.AddGroup("HR", "Human Resources", "")
+	v.AddRule(vt.Rule{Principal: "HR", PrincipalType: "group", Type: "grant", Permissions: []string{"read"}, ObjectURI: "/SASDrive/**", Enabled: true})
+	c, err := v.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	c.Journal = &jo.Journal{Path: "test.journal"}
+	defer os.Remove("test.journal")
+	rules := v.Rules()
+	current, err := au.List(c, "")
+	if err != nil || len(current) != 1 {
+		t.Fatalf("Expected: %v, Returned: %v (%v).", 1, current, err)
+	}
+	// the rule is updated and then deleted, so that the rollback creates it again with a new ID before it reverts the
+	// update
+	rule := current[0]
+	rule.Permissions = []string{"read", "update"}
+	if err := rule.Update(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if err := rule.Delete(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	c.Journal.Close()
+	entries, err := jo.Read("test.journal")
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	c.Journal = nil
+	var fails failures
+	rollback(c, entries, &fails)
+	if err := fails.err(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	restored := v.Rules()
+	if len(restored) != 1 || restored[0].ID == rules[0].ID || !reflect.DeepEqual(rules[0].Permissions, restored[0].Permissions) {
+		t.Errorf("Expected: %v, Returned: %v.", rules, restored)
+	}
+}
@@ -4,6 +4,8 @@
 package cmd
 
 import (
+	"errors"
+	"os"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -18,15 +20,22 @@ var profile string
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:   "goviyaauth",
-	Short: "Manage SAS Viya Authorization Concepts",
-	Long:  `Manage all authorization concepts of a SAS Viya environment.`,
+	Use:          "goviyaauth",
+	Short:        "Manage SAS Viya Authorization Concepts",
+	Long:         `Manage all authorization concepts of a SAS Viya environment.`,
+	SilenceUsage: true,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	rootCmd.Execute()
+	if err := rootCmd.Execute(); err != nil {
+		var exit *exitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
+		os.Exit(exitFailure)
+	}
 }
 
 func init() {
@@ -34,6 +43,14 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file location (default is $HOME/.sas/gva.json)")
 	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "sas-viya CLI profile (default is Default)")
 	rootCmd.PersistentFlags().Bool("insecure", false, "allow TLS connections without validating the server certificates (default is false)")
+	rootCmd.PersistentFlags().Bool("plan", false, "compute and print the changes without applying them")
+	rootCmd.PersistentFlags().String("plan-output", "", "write the computed plan as JSON to a file (use - for stdout)")
+	rootCmd.PersistentFlags().Int("parallel", 1, "number of operations to run concurrently")
+	viper.BindPFlag("parallel", rootCmd.PersistentFlags().Lookup("parallel"))
+	rootCmd.PersistentFlags().String("policy", "", "policy file the model of every apply and sync command needs to comply with")
+	viper.BindPFlag("policy", rootCmd.PersistentFlags().Lookup("policy"))
+	rootCmd.PersistentFlags().String("journal", "", "file to record the changes in, so that they can be rolled back (default is gva-<timestamp>.journal)")
+	viper.BindPFlag("journal", rootCmd.PersistentFlags().Lookup("journal"))
 }
 
 // initConfig reads in config file and ENV variables if set, otherwise reverts to defaults.
@@ -65,6 +82,13 @@ func initConfig() {
 	viper.SetDefault("pw", "")
 	viper.SetDefault("clientid", "sas.cli")
 	viper.SetDefault("clientsecret", "")
+	viper.SetDefault("granttype", "")
+	viper.SetDefault("retries", 3)
+	viper.SetDefault("retrywait", "1s")
+	viper.SetDefault("retrymaxwait", "30s")
+	viper.SetDefault("ratelimit", 0)
+	viper.SetDefault("policy", "")
+	viper.SetDefault("journal", "gva-"+t.Format("2006-01-02-150405")+".journal")
 	if profile != "" {
 		viper.SetDefault("profile", profile)
 	} else {
@@ -0,0 +1,113 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	ta "github.com/sassoftware/sas-viya-authorization-model/task"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Exit codes of the CLI
+const (
+	// exitFailure indicates the command could not run, e.g. due to connection or file errors
+	exitFailure = 1
+	// exitPartial indicates one or more individual operations failed while the run continued
+	exitPartial = 2
+	// exitDrift indicates the SAS Viya environment differs from the model files
+	exitDrift = 3
+	// exitPolicy indicates the model files violate a policy, so no changes were made
+	exitPolicy = 4
+)
+
+// exitError carries the exit code of a failed command
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// failures aggregates the errors of individual operations so that a run can continue past them
+type failures struct {
+	errs []error
+}
+
+// add logs and records an error and reports whether one occurred
+func (f *failures) add(err error) bool {
+	if err == nil {
+		return false
+	}
+	zap.S().Errorw("Operation failed", "error", err)
+	f.errs = append(f.errs, err)
+	return true
+}
+
+// execute runs the operations of a command on the configured number of parallel workers
+func (f *failures) execute(g *ta.Graph) {
+	var workers int = viper.GetInt("parallel")
+	zap.S().Debugw("Executing operations", "operations", g.Len(), "parallel", workers)
+	for _, err := range g.Run(workers) {
+		f.add(err)
+	}
+}
+
+// err summarizes all recorded errors
+func (f *failures) err() error {
+	if len(f.errs) == 0 {
+		return nil
+	}
+	return &exitError{
+		code: exitPartial,
+		err:  fmt.Errorf("%d operation(s) failed, first error: %w", len(f.errs), f.errs[0]),
+	}
+}
+
+// newConnection returns a connection configured by the flags, environment variables and configuration file. A profile
+// other than the configured one selects another environment, to which a configured base URL does not apply
+func newConnection(profile string) *co.Connection {
+	options := co.Options{
+		BaseURL:       viper.GetString("baseurl"),
+		Profile:       viper.GetString("profile"),
+		Home:          viper.GetString("home"),
+		CASServer:     viper.GetString("casserver"),
+		User:          viper.GetString("user"),
+		Password:      viper.GetString("pw"),
+		ClientID:      viper.GetString("clientid"),
+		ClientSecret:  viper.GetString("clientsecret"),
+		GrantType:     viper.GetString("granttype"),
+		InsecureTLS:   viper.GetString("validtls") == "false",
+		Retries:       viper.GetInt("retries"),
+		RetryWait:     viper.GetDuration("retrywait"),
+		RetryMaxWait:  viper.GetDuration("retrymaxwait"),
+		RateLimit:     viper.GetFloat64("ratelimit"),
+		ResponseLimit: viper.GetInt("responselimit"),
+	}
+	if profile != "" {
+		options.Profile = profile
+		options.BaseURL = ""
+	}
+	return co.New(options)
+}
+
+// disconnect from SAS Viya, logging failures as they no longer affect the outcome of a run
+func disconnect(c *co.Connection) {
+	if c.Journal != nil {
+		if err := c.Journal.Close(); err != nil {
+			zap.S().Errorw("Error when closing journal", "path", c.Journal.Path, "error", err)
+		}
+	}
+	if err := c.Disconnect(); err != nil {
+		zap.S().Errorw("Error when disconnecting from SAS Viya", "error", err)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"time"
+
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	sn "github.com/sassoftware/sas-viya-authorization-model/snapshot"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Take a snapshot of the authorization state",
+	Long:  `Take a snapshot of the custom groups and their members, the folder tree, all authorization rules and the direct CAS access controls of all global CASLIBs of a SAS Viya environment. The snapshot is written as a versioned, gzip compressed JSON archive that can be restored with the restore command. Nothing is changed.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			output = "gva-snapshot-" + time.Now().Format("2006-01-02-150405") + ".json.gz"
+		}
+		zap.S().Infow("Taking a snapshot of the SAS Viya authorization state", "output", output)
+		co := newConnection("")
+		if err := co.Connect(); err != nil {
+			return err
+		}
+		defer disconnect(co)
+		s, err := sn.Take(co)
+		if err != nil {
+			return err
+		}
+		if err := s.Write(output); err != nil {
+			return err
+		}
+		zap.S().Infow("Wrote snapshot", "path", output)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.Flags().StringP("output", "o", "", "file to write the snapshot to (default is gva-snapshot-<timestamp>.json.gz)")
+}
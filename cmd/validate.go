@@ -0,0 +1,139 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	lo "github.com/sassoftware/sas-viya-authorization-model/log"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the model files offline",
+	Long:  `Check the model files (groups, matrix, IPAP and DAP, or a single model file) without connecting to SAS Viya for missing values, references to undefined patterns, unknown permissions, duplicate rows, folders whose parent folder is not listed and group nesting cycles. Every problem is printed as path:line:column: severity: message. The command exits with code 1 if an error is found.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		new(lo.Log).New()
+		model, _ := cmd.Flags().GetString("model")
+		groups, _ := cmd.Flags().GetString("groups")
+		matrix, _ := cmd.Flags().GetString("matrix")
+		ipapPattern, _ := cmd.Flags().GetString("ipap-pattern")
+		ipapFolders, _ := cmd.Flags().GetString("ipap-folders")
+		dapPattern, _ := cmd.Flags().GetString("dap-pattern")
+		dapCASLIBs, _ := cmd.Flags().GetString("dap-caslibs")
+		createFolders, _ := cmd.Flags().GetBool("create-folders")
+		zap.S().Infow("Validating the model files", "model", model, "groups", groups, "matrix", matrix, "ipap-pattern", ipapPattern, "ipap-folders", ipapFolders, "dap-pattern", dapPattern, "dap-caslibs", dapCASLIBs, "create-folders", createFolders)
+		if (ipapPattern == "") != (ipapFolders == "") {
+			return errors.New("--ipap-pattern and --ipap-folders need to be provided together")
+		}
+		if (dapPattern == "") != (dapCASLIBs == "") {
+			return errors.New("--dap-pattern and --dap-caslibs need to be provided together")
+		}
+		if model != "" && (groups != "" || matrix != "" || ipapPattern != "" || dapPattern != "") {
+			return errors.New("--model cannot be combined with the other model files")
+		}
+		if model == "" && groups == "" && matrix == "" && ipapPattern == "" && dapPattern == "" {
+			return errors.New("at least one model file needs to be provided")
+		}
+		var files mo.Files
+		var diagnostics []mo.Diagnostic
+		// every file is read completely, so that all of its problems are reported at once
+		var found []mo.Diagnostic
+		var err error
+		if model != "" {
+			var m *mo.Model
+			if m, found, err = mo.Load(model); err != nil {
+				return err
+			}
+			files = m.Files()
+			diagnostics = append(diagnostics, found...)
+		}
+		if groups != "" {
+			if files.Groups, found, err = mo.LoadGroups(groups); err != nil {
+				return err
+			}
+			diagnostics = append(diagnostics, found...)
+		}
+		if matrix != "" {
+			if files.Matrix, found, err = mo.LoadMatrix(matrix); err != nil {
+				return err
+			}
+			diagnostics = append(diagnostics, found...)
+		}
+		if ipapPattern != "" {
+			if files.IPAPPatterns, found, err = mo.LoadIPAPPatterns(ipapPattern); err != nil {
+				return err
+			}
+			diagnostics = append(diagnostics, found...)
+			if files.IPAPFolders, found, err = mo.LoadIPAPFolders(ipapFolders); err != nil {
+				return err
+			}
+			diagnostics = append(diagnostics, found...)
+		}
+		if dapPattern != "" {
+			if files.DAPPatterns, found, err = mo.LoadDAPPatterns(dapPattern); err != nil {
+				return err
+			}
+			diagnostics = append(diagnostics, found...)
+			if files.DAPCASLIBs, found, err = mo.LoadDAPCASLIBs(dapCASLIBs); err != nil {
+				return err
+			}
+			diagnostics = append(diagnostics, found...)
+		}
+		diagnostics = append(diagnostics, mo.Check(files, createFolders)...)
+		if errs := writeDiagnostics(os.Stdout, diagnostics); errs > 0 {
+			return &exitError{
+				code: exitFailure,
+				err:  fmt.Errorf("validation failed with %d error(s)", errs),
+			}
+		}
+		return nil
+	},
+}
+
+// writeDiagnostics writes the diagnostics ordered by file, line and column and returns the number of errors
+func writeDiagnostics(w io.Writer, diagnostics []mo.Diagnostic) int {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Location, diagnostics[j].Location
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Row != b.Row {
+			return a.Row < b.Row
+		}
+		return diagnostics[i].Column < diagnostics[j].Column
+	})
+	var errs int
+	for _, d := range diagnostics {
+		fmt.Fprintln(w, d.String())
+		if d.Severity == mo.Error {
+			errs++
+		}
+	}
+	return errs
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().String("model", "", "model file (YAML or JSON) to validate")
+	validateCmd.Flags().String("groups", "", "groups file to validate")
+	validateCmd.Flags().String("matrix", "", "platform capability matrix file to validate")
+	validateCmd.Flags().String("ipap-pattern", "", "IPAP pattern file to validate")
+	validateCmd.Flags().String("ipap-folders", "", "IPAP folders file to validate")
+	validateCmd.Flags().String("dap-pattern", "", "DAP pattern file to validate")
+	validateCmd.Flags().String("dap-caslibs", "", "DAP CASLIBs file to validate")
+	validateCmd.Flags().BoolP("create-folders", "f", false, "validate that missing folders can be created, which requires parent folders to be listed first")
+}
@@ -0,0 +1,28 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package connection
+
+import "net/http"
+
+// Client sends the requests of a connection to SAS Logon Manager and the SAS Viya REST APIs used by the domain
+// packages: identities, authorization, folders, casManagement and casAccessManagement. *http.Client is a Client, other
+// implementations can serve the requests without a network, e.g. the in-memory fake of package viyatest.
+//
+// There is deliberately no interface per REST API, e.g. of identities or authorization: the domain packages keep
+// calling the REST APIs through a Connection, and a fake Client serves those same requests, so that end-to-end tests
+// cover the requests sent to a live SAS Viya environment
+type Client interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// clientTransport sends the requests of an HTTP client through a Client, so that OAuth 2.0 token requests use the
+// Client as well
+type clientTransport struct {
+	client Client
+}
+
+// RoundTrip sends a single request through the Client
+func (t clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.client.Do(req)
+}
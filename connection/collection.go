@@ -0,0 +1,132 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package connection
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// Collection iterates over all items of a paginated application/vnd.sas.collection resource
+type Collection struct {
+	connection *Connection
+	path       string
+	query      [][]string
+	page       []interface{}
+	index      int
+	start      int
+	done       bool
+	item       map[string]interface{}
+	err        error
+}
+
+// Collection returns an iterator over every item of the collection at path, following its next links
+func (c *Connection) Collection(path string, query [][]string) *Collection {
+	return &Collection{
+		connection: c,
+		path:       path,
+		query:      query,
+	}
+}
+
+// Next advances to the next item, requesting further pages as required. It returns false once all
+// items have been consumed or an error occurred
+func (it *Collection) Next() bool {
+	for it.index >= len(it.page) {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+	it.item, _ = it.page[it.index].(map[string]interface{})
+	it.index++
+	return true
+}
+
+// Item returns the current item
+func (it *Collection) Item() map[string]interface{} {
+	return it.item
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *Collection) Err() error {
+	return it.err
+}
+
+// All returns every remaining item of the collection
+func (it *Collection) All() ([]map[string]interface{}, error) {
+	var items []map[string]interface{}
+	for it.Next() {
+		items = append(items, it.Item())
+	}
+	return items, it.Err()
+}
+
+// fetch requests the next page of the collection
+func (it *Collection) fetch() {
+	zap.S().Debugw("Retrieving collection page", "path", it.path, "start", it.start)
+	response, _, err := it.connection.Call("GET", it.path, "", "", it.query, nil)
+	if err != nil {
+		it.err = fmt.Errorf("listing %s: %w", it.path, err)
+		return
+	}
+	result, _ := response.(map[string]interface{})
+	items, ok := result["items"].([]interface{})
+	if !ok {
+		it.err = fmt.Errorf("listing %s: %w", it.path, ErrUnexpectedResponse)
+		return
+	}
+	it.page = items
+	it.index = 0
+	it.start += len(items)
+	if next := link(result, "next"); next != "" {
+		href, err := url.Parse(next)
+		if err != nil {
+			it.err = fmt.Errorf("following next link %q: %w", next, err)
+			return
+		}
+		it.path = href.Path
+		it.query = nil
+		var keys []string
+		for key := range href.Query() {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			it.query = append(it.query, []string{key, href.Query().Get(key)})
+		}
+	} else if count, ok := result["count"].(float64); ok && len(items) > 0 && float64(it.start) < count {
+		it.query = setQuery(it.query, "start", strconv.Itoa(it.start))
+	} else {
+		it.done = true
+	}
+}
+
+// link returns the href of the link with the given relation
+func link(result map[string]interface{}, rel string) string {
+	links, _ := result["links"].([]interface{})
+	for _, l := range links {
+		m, _ := l.(map[string]interface{})
+		if m["rel"] == rel {
+			href, _ := m["href"].(string)
+			return href
+		}
+	}
+	return ""
+}
+
+// setQuery replaces or appends a query parameter
+func setQuery(query [][]string, key, value string) [][]string {
+	var updated [][]string
+	for _, q := range query {
+		if q[0] != key {
+			updated = append(updated, q)
+		}
+	}
+	return append(updated, []string{key, value})
+}
@@ -0,0 +1,82 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package connection
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCollectionNextLink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		switch req.URL.Query().Get("start") {
+		case "":
+			rw.Write([]byte(`{"count": 3, "start": 0, "limit": 2, "items": [{"id": "group1"}, {"id": "group2"}], "links": [{"rel": "next", "method": "GET", "href": "/identities/groups?providerId=local&start=2&limit=2"}]}`))
+		case "2":
+			if req.URL.Query().Get("providerId") != "local" {
+				t.Errorf("Expected: %v, Returned: %v.", "local", req.URL.Query().Get("providerId"))
+			}
+			rw.Write([]byte(`{"count": 3, "start": 2, "limit": 2, "items": [{"id": "group3"}], "links": [{"rel": "prev", "method": "GET", "href": "/identities/groups?providerId=local&start=0&limit=2"}]}`))
+		default:
+			t.Errorf("Unexpected page requested: %s.", req.URL.String())
+		}
+	}))
+	defer server.Close()
+	c := new(Connection)
+	c.BaseURL = server.URL
+	items, err := c.Collection("/identities/groups", [][]string{{"providerId", "local"}, {"limit", "2"}}).All()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	var returned []string
+	for _, item := range items {
+		returned = append(returned, item["id"].(string))
+	}
+	expected := []string{"group1", "group2", "group3"}
+	if !reflect.DeepEqual(returned, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
+
+func TestCollectionStart(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		rw.Header().Set("Content-Type", "application/json")
+		if req.URL.Query().Get("start") == "1" {
+			rw.Write([]byte(`{"count": 2, "items": [{"id": "rule2"}]}`))
+		} else {
+			rw.Write([]byte(`{"count": 2, "items": [{"id": "rule1"}]}`))
+		}
+	}))
+	defer server.Close()
+	c := new(Connection)
+	c.BaseURL = server.URL
+	items, err := c.Collection("/authorization/rules", [][]string{{"limit", "1"}}).All()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if len(items) != 2 || requests != 2 {
+		t.Errorf("Expected: %v, Returned: %v.", 2, len(items))
+	}
+}
+
+func TestCollectionError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	c := new(Connection)
+	c.BaseURL = server.URL
+	it := c.Collection("/identities/groups", nil)
+	if it.Next() {
+		t.Errorf("Expected: %v, Returned: %v.", false, true)
+	}
+	if !IsStatus(it.Err(), 403) {
+		t.Errorf("Expected: %v, Returned: %v.", 403, it.Err())
+	}
+}
@@ -5,15 +5,21 @@ package connection
 
 import (
 	"bytes"
-	"context"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sassoftware/sas-viya-authorization-model/file"
-	"github.com/spf13/viper"
+	jo "github.com/sassoftware/sas-viya-authorization-model/journal"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 )
@@ -26,34 +32,60 @@ type Connection struct {
 	CASServer   string
 	Connected   bool
 	Count       int64
+	Plan        *pl.Plan
+	Journal     *jo.Journal
+	options     Options
+	token       *oauth2.Token
+	grant       string
+	client      *http.Client
+	limiter     *limiter
+	setup       sync.Once
+	mutex       sync.Mutex
 }
 
 // Connect to SAS Viya
-func (c *Connection) Connect() {
+func (c *Connection) Connect() error {
 	zap.S().Debugw("Connecting to SAS Viya")
 	if !c.Connected {
-		c.CASServer = viper.GetString("casserver")
-		c.getBaseURL()
-		c.getAccessToken()
-		c.getCASSession()
+		c.CASServer = c.casServer()
+		if err := c.getBaseURL(); err != nil {
+			return err
+		}
+		if err := c.getAccessToken(); err != nil {
+			return err
+		}
+		if err := c.getCASSession(); err != nil {
+			return err
+		}
 		c.Connected = true
 		zap.S().Debugw("Connected to SAS Viya")
 	}
+	return nil
 }
 
 // Call the SAS Viya REST API
-func (c *Connection) Call(method, path, contenttype, accepttype string, query [][]string, body []byte) (response interface{}, status int) {
+func (c *Connection) Call(method, path, contenttype, accepttype string, query [][]string, body []byte) (response interface{}, status int, err error) {
+	response, _, status, err = c.CallWithHeader(method, path, contenttype, accepttype, query, body, nil)
+	return response, status, err
+}
+
+// CallWithHeader calls the SAS Viya REST API with additional request headers and also returns the response headers,
+// e.g. to send the ETag of a resource as If-Match when updating it
+func (c *Connection) CallWithHeader(method, path, contenttype, accepttype string, query [][]string, body []byte, header http.Header) (response interface{}, responseHeader http.Header, status int, err error) {
 	if contenttype == "" {
 		contenttype = "application/json"
 	}
 	if accepttype == "" {
 		accepttype = "application/json"
 	}
-	bodyReader := bytes.NewReader(body)
+	if c.Plan != nil && method != "GET" && !c.isSessionCall(path) {
+		zap.S().Errorw("Refusing to send a mutating request in plan mode", "method", method, "path", path)
+		return nil, nil, 0, fmt.Errorf("%s %s: %w", method, path, ErrPlanMode)
+	}
 	zap.S().Debugw("Calling SAS Viya REST API")
 	url, err := url.ParseRequestURI(c.BaseURL)
 	if err != nil {
-		zap.S().Fatalw("Error encoding Base URL", "baseurl", c.BaseURL, "error", err)
+		return nil, nil, 0, fmt.Errorf("encoding base URL %q: %w", c.BaseURL, err)
 	}
 	url.Path = path
 	if query != nil {
@@ -65,51 +97,144 @@ func (c *Connection) Call(method, path, contenttype, accepttype string, query []
 	}
 	var urlencode string = url.String()
 	zap.S().Debugw("Encoded URL components", "urlencode", urlencode)
-	req, err := http.NewRequest(method, urlencode, bodyReader)
-	req.Close = true
-	req.Header.Add("Authorization", "bearer "+c.AccessToken)
-	req.Header.Add("Content-type", contenttype)
-	req.Header.Add("Accept", accepttype)
-	tr := &http.Transport{}
-	if viper.GetString("validtls") == "false" {
-		tr = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	if _, err := c.renew(""); err != nil {
+		return nil, nil, 0, err
+	}
+	resp, token, err := c.do(method, urlencode, contenttype, accepttype, body, header)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		zap.S().Infow("OAuth Access Token was rejected", "method", method, "path", path)
+		resend, renewErr := c.renew(token)
+		if renewErr != nil {
+			resp.Body.Close()
+			return nil, nil, http.StatusUnauthorized, renewErr
+		}
+		if resend {
+			resp.Body.Close()
+			resp, _, err = c.do(method, urlencode, contenttype, accepttype, body, header)
 		}
 	}
-	client := &http.Client{Transport: tr}
-	resp, err := client.Do(req)
-	c.Count++
 	if err != nil {
-		zap.S().Fatalw("Error communicating with REST API", "error", err)
+		return nil, nil, 0, fmt.Errorf("communicating with REST API %s %s: %w", method, path, err)
 	}
+	defer resp.Body.Close()
 	status = resp.StatusCode
-	err = json.NewDecoder(resp.Body).Decode(&response)
-	if err != nil {
-		zap.S().Debugw("Issue unmarshalling JSON response", "error", err)
+	responseHeader = resp.Header
+	if decodeErr := json.NewDecoder(resp.Body).Decode(&response); decodeErr != nil {
+		zap.S().Debugw("Issue unmarshalling JSON response", "error", decodeErr)
 	}
-	defer resp.Body.Close()
 	if (400 <= resp.StatusCode) && (resp.StatusCode <= 599) {
 		zap.S().Debugw("Error code contained in REST response", "status", resp.StatusCode, "response", response)
-	} else {
-		zap.S().Debugw("Successful REST response", "status", resp.StatusCode, "response", response)
+		return response, responseHeader, status, newAPIError(method, path, status, response)
 	}
-	return
+	zap.S().Debugw("Successful REST response", "status", resp.StatusCode, "response", response)
+	return response, responseHeader, status, nil
+}
+
+// do sends a request, retrying transient failures with exponential backoff, and returns the response with the OAuth
+// Access Token it was sent with
+func (c *Connection) do(method, urlencode, contenttype, accepttype string, body []byte, header http.Header) (*http.Response, string, error) {
+	var retries int = c.options.Retries
+	wait, maxWait := c.retryWait()
+	for attempt := 0; ; attempt++ {
+		c.httpClient()
+		c.limiter.wait()
+		token := c.bearer()
+		resp, err := c.send(method, urlencode, contenttype, accepttype, body, header, token)
+		if attempt >= retries || !retryable(method, resp, err) {
+			return resp, token, err
+		}
+		delay := backoff(attempt, wait, maxWait)
+		if after := retryAfter(resp); after > delay {
+			delay = after
+		}
+		if err != nil {
+			zap.S().Warnw("Retrying SAS Viya REST API request", "method", method, "url", urlencode, "attempt", attempt+1, "delay", delay, "error", err)
+		} else {
+			zap.S().Warnw("Retrying SAS Viya REST API request", "method", method, "url", urlencode, "attempt", attempt+1, "delay", delay, "status", resp.StatusCode)
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		time.Sleep(delay)
+	}
+}
+
+// send a single request with an OAuth Access Token to the SAS Viya REST API
+func (c *Connection) send(method, urlencode, contenttype, accepttype string, body []byte, header http.Header, token string) (*http.Response, error) {
+	req, err := http.NewRequest(method, urlencode, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Add("Authorization", "bearer "+token)
+	req.Header.Add("Content-type", contenttype)
+	req.Header.Add("Accept", accepttype)
+	resp, err := c.httpClient().Do(req)
+	atomic.AddInt64(&c.Count, 1)
+	return resp, err
+}
+
+// httpClient returns the HTTP client reused by all requests of the connection
+func (c *Connection) httpClient() *http.Client {
+	c.setup.Do(func() {
+		if client, ok := c.options.Client.(*http.Client); ok {
+			c.client = client
+		} else if c.options.Client != nil {
+			c.client = &http.Client{Transport: clientTransport{c.options.Client}}
+		} else {
+			tr := http.DefaultTransport.(*http.Transport).Clone()
+			tr.MaxIdleConnsPerHost = 16
+			if c.options.InsecureTLS {
+				tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			}
+			c.client = &http.Client{Transport: tr}
+		}
+		c.limiter = newLimiter(c.options.RateLimit)
+	})
+	return c.client
 }
 
 // Disconnect from SAS Viya
-func (c *Connection) Disconnect() {
+func (c *Connection) Disconnect() error {
 	zap.S().Debugw("Disconnecting from SAS Viya")
 	if c.Connected {
-		c.destroyCASSession()
+		err := c.destroyCASSession()
 		c.Connected = false
 		zap.S().Debugw("Disconnected from SAS Viya", "Total API Calls", c.Count)
+		return err
 	}
+	return nil
 }
 
-// getBaseURL returns the user's saved SAS Viya environment base URL
-func (c *Connection) getBaseURL() {
-	if viper.GetString("baseurl") != "" {
-		c.BaseURL = viper.GetString("baseurl")
+// Record a change in the journal of the connection, if any, with the request reverting it
+func (c *Connection) Record(action, resource, target string, inverse *jo.Request) error {
+	if c.Journal == nil {
+		return nil
+	}
+	return c.Journal.Record(action, resource, target, inverse)
+}
+
+// RecordState records a change in the journal of the connection, if any, with the state before the change
+func (c *Connection) RecordState(action, resource, target string, state interface{}) error {
+	if c.Journal == nil {
+		return nil
+	}
+	return c.Journal.RecordState(action, resource, target, state)
+}
+
+// isSessionCall reports whether the request only manages the CAS session of this connection
+func (c *Connection) isSessionCall(path string) bool {
+	return strings.HasPrefix(path, "/casManagement/servers/"+c.CASServer+"/sessions") ||
+		strings.HasPrefix(path, "/casAccessManagement/servers/"+c.CASServer+"/admUser/assumeRole")
+}
+
+// getBaseURL returns the configured or the user's saved SAS Viya environment base URL
+func (c *Connection) getBaseURL() error {
+	if c.options.BaseURL != "" {
+		c.BaseURL = c.options.BaseURL
 	} else {
 		zap.S().Debugw("Retrieving SAS Viya environment base URL")
 		// config of SAS Viya connection
@@ -121,76 +246,86 @@ func (c *Connection) getBaseURL() {
 		}
 		var conf config
 		f := new(file.File)
-		f.Path = viper.GetString("home") + "/.sas/config.json"
+		f.Path = c.home() + "/.sas/config.json"
 		f.Content = conf
 		f.Type = "json"
-		f.Read()
-		c.BaseURL = f.Content.(map[string]interface{})[viper.GetString("profile")].(map[string]interface{})["sas-endpoint"].(string)
+		if err := f.Read(); err != nil {
+			return fmt.Errorf("reading sas-viya CLI configuration: %w", err)
+		}
+		endpoint, ok := profileValue(f.Content, c.profile(), "sas-endpoint")
+		if !ok {
+			return fmt.Errorf("profile %q has no sas-endpoint in %s", c.profile(), f.Path)
+		}
+		c.BaseURL = endpoint
 	}
-	zap.S().Debugw("Retrieved SAS Viya environment base URL", "profile", viper.GetString("profile"), "baseurl", c.BaseURL)
+	zap.S().Debugw("Retrieved SAS Viya environment base URL", "profile", c.profile(), "baseurl", c.BaseURL)
+	return nil
 }
 
 // getAccessToken either obtains a new or returns the user's existing OAuth Access Token
-func (c *Connection) getAccessToken() {
-	if viper.GetString("user") != "" && viper.GetString("pw") != "" && c.BaseURL != "" {
-		zap.S().Debugw("Retrieving OAuth Access Token")
-		config := &oauth2.Config{
-			ClientID:     viper.GetString("clientid"),
-			ClientSecret: viper.GetString("clientsecret"),
-			Endpoint: oauth2.Endpoint{
-				AuthURL:  c.BaseURL + "/SASLogon/oauth/authorize",
-				TokenURL: c.BaseURL + "/SASLogon/oauth/token",
-			},
-		}
-		tr := &http.Transport{}
-		if viper.GetString("validtls") == "false" {
-			tr = &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			}
-		}
-		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: tr})
-		token, err := config.PasswordCredentialsToken(ctx, viper.GetString("user"), viper.GetString("pw"))
-		if err != nil {
-			zap.S().Fatalw("OAuth Access Token cannot be acquired", "err", err)
-		}
-		c.AccessToken = token.AccessToken
+func (c *Connection) getAccessToken() error {
+	zap.S().Debugw("Retrieving OAuth Access Token")
+	var token *oauth2.Token
+	var err error
+	if c.options.GrantType == "client_credentials" && c.BaseURL != "" {
+		c.grant = "client_credentials"
+		token, err = c.clientCredentialsToken()
+	} else if c.options.User != "" && c.options.Password != "" && c.BaseURL != "" {
+		c.grant = "password"
+		token, err = c.oauthConfig().PasswordCredentialsToken(c.oauthContext(), c.options.User, c.options.Password)
 	} else {
-		zap.S().Debugw("Retrieving OAuth Access Token")
-		// credential for OAuth authentication
-		type credentials struct {
-			Profile struct {
-				AccessToken  string `json:"access-token"`
-				Expiry       string `json:"expiry"`
-				RefreshToken string `json:"refresh-token"`
-			} `json:"Default"`
-		}
-		var cred credentials
-		f := new(file.File)
-		f.Path = viper.GetString("home") + "/.sas/credentials.json"
-		f.Content = cred
-		f.Type = "json"
-		f.Read()
-		expiry, _ := time.Parse(time.RFC3339, f.Content.(map[string]interface{})[viper.GetString("profile")].(map[string]interface{})["expiry"].(string))
-		if time.Now().After(expiry) {
-			zap.S().Fatalw("OAuth Access Token expired. Please refresh using the 'sas-viya auth login' command", "expiry", expiry)
-		}
-		c.AccessToken = f.Content.(map[string]interface{})[viper.GetString("profile")].(map[string]interface{})["access-token"].(string)
+		c.grant = "refresh_token"
+		token, err = c.readCredentials()
+	}
+	if err != nil {
+		return fmt.Errorf("acquiring OAuth Access Token: %w", err)
 	}
-	zap.S().Debugw("Retrieved OAuth Access Token")
+	c.token = token
+	c.AccessToken = token.AccessToken
+	zap.S().Debugw("Retrieved OAuth Access Token", "grant", c.grant, "expiry", token.Expiry)
+	return nil
 }
 
 // getCASSession creates a CAS Session
-func (c *Connection) getCASSession() {
+func (c *Connection) getCASSession() error {
 	zap.S().Debugw("Creating CAS session")
-	resp, _ := c.Call("POST", "/casManagement/servers/"+c.CASServer+"/sessions", "", "", nil, nil)
-	c.CASSession = resp.(map[string]interface{})["id"].(string)
+	resp, _, err := c.Call("POST", "/casManagement/servers/"+c.CASServer+"/sessions", "", "", nil, nil)
+	if err != nil {
+		return fmt.Errorf("creating CAS session: %w", err)
+	}
+	session, _ := resp.(map[string]interface{})
+	id, ok := session["id"].(string)
+	if !ok {
+		return fmt.Errorf("creating CAS session: %w", ErrUnexpectedResponse)
+	}
+	c.CASSession = id
 	zap.S().Debugw("Elevating privileges for CAS session", "session", c.CASSession)
-	c.Call("PUT", "/casAccessManagement/servers/"+c.CASServer+"/admUser/assumeRole/superUser", "", "", [][]string{{"sessionId", c.CASSession}}, nil)
+	if _, _, err := c.Call("PUT", "/casAccessManagement/servers/"+c.CASServer+"/admUser/assumeRole/superUser", "", "", [][]string{{"sessionId", c.CASSession}}, nil); err != nil {
+		return fmt.Errorf("elevating privileges for CAS session: %w", err)
+	}
 	zap.S().Debugw("Created CAS session", "session", c.CASSession)
+	return nil
 }
 
 // destroyCASSession destroys a CAS Session
-func (c *Connection) destroyCASSession() {
+func (c *Connection) destroyCASSession() error {
 	zap.S().Debugw("Destroying CAS session", "session", c.CASSession)
-	c.Call("DELETE", "/casManagement/servers/"+c.CASServer+"/sessions/"+c.CASSession, "", "", nil, nil)
+	if _, _, err := c.Call("DELETE", "/casManagement/servers/"+c.CASServer+"/sessions/"+c.CASSession, "", "", nil, nil); err != nil {
+		return fmt.Errorf("destroying CAS session: %w", err)
+	}
+	return nil
+}
+
+// profileValue looks up a string property of a sas-viya CLI profile
+func profileValue(content interface{}, profile, key string) (string, bool) {
+	profiles, ok := content.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	properties, ok := profiles[profile].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	value, ok := properties[key].(string)
+	return value, ok
 }
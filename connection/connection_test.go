@@ -4,67 +4,72 @@
 package connection
 
 import (
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 
-	"github.com/spf13/viper"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
+	"golang.org/x/oauth2"
 )
 
 func TestGetBaseURL1(t *testing.T) {
 	var expected string = "http://0.0.0.0"
-	viper.Set("baseurl", expected)
-	c := new(Connection)
+	c := New(Options{BaseURL: expected})
 	c.getBaseURL()
 	var returned string = c.BaseURL
 	if returned != expected {
 		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
 	}
-	viper.Set("baseurl", "")
 }
 
 func TestGetBaseURL2(t *testing.T) {
-	viper.Set("home", "test")
-	viper.Set("profile", "Default")
 	write := []byte(`{"Default": {"ansi-colors-enabled": "true", "oauth-client-id": "sas.cli", "output": "json", "sas-endpoint": "http://1.1.1.1"}}`)
 	var expected string = "http://1.1.1.1"
 	os.MkdirAll("test/.sas/", os.ModePerm)
 	ioutil.WriteFile("test/.sas/config.json", write, 0644)
-	c := new(Connection)
+	c := New(Options{Home: "test"})
 	c.getBaseURL()
 	var returned string = c.BaseURL
 	if returned != expected {
 		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
 	}
 	os.RemoveAll("test")
-	viper.Set("home", "")
 }
 
 func TestGetBaseURL3(t *testing.T) {
-	viper.Set("home", "test")
-	viper.Set("profile", "prod")
 	write := []byte(`{"Default": {"ansi-colors-enabled": "true", "oauth-client-id": "sas.cli", "output": "json", "sas-endpoint": "http://1.1.1.1"}, "prod": {"ansi-colors-enabled": "true", "oauth-client-id": "sas.cli", "output": "json", "sas-endpoint": "http://2.2.2.2"}}`)
 	var expected string = "http://2.2.2.2"
 	os.MkdirAll("test/.sas/", os.ModePerm)
 	ioutil.WriteFile("test/.sas/config.json", write, 0644)
-	c := new(Connection)
+	c := New(Options{Home: "test", Profile: "prod"})
 	c.getBaseURL()
 	var returned string = c.BaseURL
 	if returned != expected {
 		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
 	}
 	os.RemoveAll("test")
-	viper.Set("profile", "Default")
-	viper.Set("home", "")
+}
+
+func TestGetBaseURL4(t *testing.T) {
+	write := []byte(`{"Default": {"sas-endpoint": "http://1.1.1.1"}, "dev": {"sas-endpoint": "http://3.3.3.3"}, "prod": {"sas-endpoint": "http://2.2.2.2"}}`)
+	os.MkdirAll("test/.sas/", os.ModePerm)
+	ioutil.WriteFile("test/.sas/config.json", write, 0644)
+	// connections to different profiles do not affect each other
+	dev := New(Options{Home: "test", Profile: "dev"})
+	prod := New(Options{Home: "test", Profile: "prod"})
+	dev.getBaseURL()
+	prod.getBaseURL()
+	if dev.BaseURL != "http://3.3.3.3" || prod.BaseURL != "http://2.2.2.2" {
+		t.Errorf("Expected: %v, Returned: %v.", "http://3.3.3.3 http://2.2.2.2", dev.BaseURL+" "+prod.BaseURL)
+	}
+	os.RemoveAll("test")
 }
 
 func TestGetAccessToken1(t *testing.T) {
-	viper.Set("user", "user1")
-	viper.Set("pw", "password1")
-	viper.Set("validtls", "false")
-	c := new(Connection)
+	c := New(Options{User: "user1", Password: "password1", InsecureTLS: true})
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 		expected := "/SASLogon/oauth/token"
@@ -72,7 +77,7 @@ func TestGetAccessToken1(t *testing.T) {
 			t.Errorf("URL = %q; want %q", r.URL, expected)
 		}
 		headerAuth := r.Header.Get("Authorization")
-		expected = "Basic Og=="
+		expected = "Basic c2FzLmNsaTo="
 		if headerAuth != expected {
 			t.Errorf("Authorization header = %q; want %q", headerAuth, expected)
 		}
@@ -100,44 +105,34 @@ func TestGetAccessToken1(t *testing.T) {
 	if returned != expected {
 		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
 	}
-	viper.Set("user", "")
-	viper.Set("pw", "")
-	viper.Set("validtls", "")
 }
 
 func TestGetAccessToken2(t *testing.T) {
-	viper.Set("home", "test")
-	viper.Set("profile", "Default")
 	write := []byte(`{"Default": {"access-token": "testaccesstoken", "expiry": "9999-12-31T07:05:41Z", "refresh-token": "testrefreshtoken"}}`)
 	var expected string = "testaccesstoken"
 	os.MkdirAll("test/.sas/", os.ModePerm)
 	ioutil.WriteFile("test/.sas/credentials.json", write, 0644)
-	c := new(Connection)
+	c := New(Options{Home: "test"})
 	c.getAccessToken()
 	var returned string = c.AccessToken
 	if returned != expected {
 		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
 	}
 	os.RemoveAll("test")
-	viper.Set("home", "")
 }
 
 func TestGetAccessToken3(t *testing.T) {
-	viper.Set("home", "test")
-	viper.Set("profile", "prod")
 	write := []byte(`{"Default": {"access-token": "testaccesstoken", "expiry": "9999-12-31T07:05:41Z", "refresh-token": "testrefreshtoken"},"prod": {"access-token": "prodaccesstoken", "expiry": "9999-12-31T07:05:41Z", "refresh-token": "testrefreshtoken"}}`)
 	var expected string = "prodaccesstoken"
 	os.MkdirAll("test/.sas/", os.ModePerm)
 	ioutil.WriteFile("test/.sas/credentials.json", write, 0644)
-	c := new(Connection)
+	c := New(Options{Home: "test", Profile: "prod"})
 	c.getAccessToken()
 	var returned string = c.AccessToken
 	if returned != expected {
 		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
 	}
 	os.RemoveAll("test")
-	viper.Set("home", "")
-	viper.Set("profile", "Default")
 }
 
 func TestGetCASSession(t *testing.T) {
@@ -147,9 +142,7 @@ func TestGetCASSession(t *testing.T) {
 		rw.Write([]byte(`{"id": "testsessionid"}`))
 	}))
 	defer server.Close()
-	viper.Set("casserver", "test")
-	viper.Set("validtls", "false")
-	c := new(Connection)
+	c := New(Options{CASServer: "test", InsecureTLS: true})
 	c.BaseURL = server.URL
 	c.AccessToken = "testaccesstoken"
 	c.getCASSession()
@@ -166,16 +159,13 @@ func TestDestroyCASSession(t *testing.T) {
 		rw.Header().Set("Content-Type", "application/json")
 	}))
 	defer server.Close()
-	viper.Set("casserver", "test")
-	viper.Set("validtls", "false")
-	c := new(Connection)
+	c := New(Options{CASServer: "test", InsecureTLS: true})
 	c.BaseURL = server.URL
 	c.AccessToken = "testaccesstoken"
 	c.destroyCASSession()
 }
 
 func TestConnect(t *testing.T) {
-	viper.Set("home", "test")
 	write := []byte(`{"Default": {"access-token": "testaccesstoken", "expiry": "9999-12-31T07:05:41Z", "refresh-token": "testrefreshtoken"}}`)
 	os.MkdirAll("test/.sas/", os.ModePerm)
 	ioutil.WriteFile("test/.sas/credentials.json", write, 0644)
@@ -186,13 +176,12 @@ func TestConnect(t *testing.T) {
 	}))
 	write = []byte(`{"Default": {"ansi-colors-enabled": "true", "oauth-client-id": "sas.cli", "output": "json", "sas-endpoint": "` + server.URL + `"}}`)
 	ioutil.WriteFile("test/.sas/config.json", write, 0644)
-	c := new(Connection)
+	c := New(Options{Home: "test"})
 	c.Connect()
 	if !c.Connected {
 		t.Errorf("Expected: %v, Returned: %v.", true, c.Connected)
 	}
 	os.RemoveAll("test")
-	viper.Set("home", "")
 }
 
 func TestDisconnect(t *testing.T) {
@@ -201,9 +190,7 @@ func TestDisconnect(t *testing.T) {
 		rw.Header().Set("Content-Type", "application/json")
 	}))
 	defer server.Close()
-	viper.Set("casserver", "test")
-	viper.Set("validtls", "false")
-	c := new(Connection)
+	c := New(Options{CASServer: "test", InsecureTLS: true})
 	c.Connected = true
 	c.BaseURL = server.URL
 	c.AccessToken = "testaccesstoken"
@@ -212,3 +199,175 @@ func TestDisconnect(t *testing.T) {
 		t.Errorf("Expected: %v, Returned: %v.", false, c.Connected)
 	}
 }
+
+func TestCallError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(`{"errorCode": 1000, "message": "Invalid filter", "details": ["path: /identities/groups"], "httpStatusCode": 400}`))
+	}))
+	defer server.Close()
+	c := new(Connection)
+	c.BaseURL = server.URL
+	c.AccessToken = "testaccesstoken"
+	_, status, err := c.Call("GET", "/identities/groups", "", "", nil, nil)
+	if status != 400 {
+		t.Errorf("Expected: %v, Returned: %v.", 400, status)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected: %T, Returned: %v.", apiErr, err)
+	}
+	if apiErr.Message != "Invalid filter" || !IsStatus(err, 400) {
+		t.Errorf("Expected: %v, Returned: %v.", "Invalid filter", apiErr.Message)
+	}
+	var expected string = "GET /identities/groups returned status 400: Invalid filter (path: /identities/groups)"
+	if err.Error() != expected {
+		t.Errorf("Expected: %v, Returned: %v.", expected, err.Error())
+	}
+}
+
+func TestCallPlanMode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Errorf("Unexpected request in plan mode: %s %s.", req.Method, req.URL.String())
+	}))
+	defer server.Close()
+	c := new(Connection)
+	c.BaseURL = server.URL
+	c.Plan = new(pl.Plan)
+	_, _, err := c.Call("DELETE", "/identities/groups/testgroup", "", "", nil, nil)
+	if !errors.Is(err, ErrPlanMode) {
+		t.Errorf("Expected: %v, Returned: %v.", ErrPlanMode, err)
+	}
+}
+
+func TestGetAccessTokenExpired(t *testing.T) {
+	write := []byte(`{"Default": {"access-token": "testaccesstoken", "expiry": "2000-12-31T07:05:41Z", "refresh-token": "testrefreshtoken"}}`)
+	os.MkdirAll("test/.sas/", os.ModePerm)
+	ioutil.WriteFile("test/.sas/credentials.json", write, 0644)
+	c := New(Options{Home: "test"})
+	if err := c.getAccessToken(); err == nil {
+		t.Errorf("Expected an error for an expired OAuth Access Token.")
+	}
+	os.RemoveAll("test")
+}
+
+func TestGetAccessTokenRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		if req.Form.Get("grant_type") != "refresh_token" || req.Form.Get("refresh_token") != "testrefreshtoken" {
+			t.Errorf("Unexpected token request: %v.", req.Form)
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"access_token": "renewedaccesstoken", "token_type": "bearer", "expires_in": 3600, "refresh_token": "renewedrefreshtoken"}`))
+	}))
+	defer server.Close()
+	write := []byte(`{"Default": {"access-token": "testaccesstoken", "expiry": "2000-12-31T07:05:41Z", "refresh-token": "testrefreshtoken"}, "prod": {"access-token": "prodaccesstoken"}}`)
+	os.MkdirAll("test/.sas/", os.ModePerm)
+	ioutil.WriteFile("test/.sas/credentials.json", write, 0600)
+	c := New(Options{Home: "test"})
+	c.BaseURL = server.URL
+	if err := c.getAccessToken(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if c.AccessToken != "renewedaccesstoken" {
+		t.Errorf("Expected: %v, Returned: %v.", "renewedaccesstoken", c.AccessToken)
+	}
+	c2 := New(Options{Home: "test"})
+	c2.getAccessToken()
+	if c2.AccessToken != "renewedaccesstoken" {
+		t.Errorf("Expected the renewed token to be saved, Returned: %v.", c2.AccessToken)
+	}
+	token, _ := profileValue(credentialsContent(t, c), "prod", "access-token")
+	if token != "prodaccesstoken" {
+		t.Errorf("Expected: %v, Returned: %v.", "prodaccesstoken", token)
+	}
+	os.RemoveAll("test")
+}
+
+func TestGetAccessTokenClientCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		if req.Form.Get("grant_type") != "client_credentials" {
+			t.Errorf("Expected: %v, Returned: %v.", "client_credentials", req.Form.Get("grant_type"))
+		}
+		if user, pw, _ := req.BasicAuth(); user != "testclient" || pw != "testsecret" {
+			t.Errorf("Expected: %v, Returned: %v.", "testclient:testsecret", user+":"+pw)
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"access_token": "serviceaccesstoken", "token_type": "bearer", "expires_in": 3600}`))
+	}))
+	defer server.Close()
+	c := New(Options{GrantType: "client_credentials", ClientID: "testclient", ClientSecret: "testsecret"})
+	c.BaseURL = server.URL
+	if err := c.getAccessToken(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if c.AccessToken != "serviceaccesstoken" {
+		t.Errorf("Expected: %v, Returned: %v.", "serviceaccesstoken", c.AccessToken)
+	}
+}
+
+func TestCallRenewAccessToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/SASLogon/oauth/token" {
+			rw.Write([]byte(`{"access_token": "renewedaccesstoken", "token_type": "bearer", "expires_in": 3600}`))
+		} else if req.Header.Get("Authorization") != "bearer renewedaccesstoken" {
+			rw.WriteHeader(http.StatusUnauthorized)
+		} else {
+			rw.Write([]byte(`{"id": "testgroup"}`))
+		}
+	}))
+	defer server.Close()
+	c := New(Options{GrantType: "client_credentials"})
+	c.BaseURL = server.URL
+	c.grant = "client_credentials"
+	c.token = &oauth2.Token{AccessToken: "expiredaccesstoken"}
+	c.AccessToken = "expiredaccesstoken"
+	_, status, err := c.Call("GET", "/identities/groups/testgroup", "", "", nil, nil)
+	if err != nil || status != 200 {
+		t.Errorf("Expected: %v, Returned: %v (%v).", 200, status, err)
+	}
+}
+
+// clientFunc is a Client that serves requests without a network and without setting the request of its responses
+type clientFunc func(req *http.Request) (*http.Response, error)
+
+// Do serves a single request
+func (f clientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCallRenewAccessTokenClient(t *testing.T) {
+	client := clientFunc(func(req *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/SASLogon/oauth/token" {
+			rec.Write([]byte(`{"access_token": "renewedaccesstoken", "token_type": "bearer", "expires_in": 3600}`))
+		} else if req.Header.Get("Authorization") != "bearer renewedaccesstoken" {
+			rec.WriteHeader(http.StatusUnauthorized)
+		} else {
+			rec.Write([]byte(`{"id": "testgroup"}`))
+		}
+		return rec.Result(), nil
+	})
+	c := New(Options{GrantType: "client_credentials", Client: client})
+	c.BaseURL = "http://viya.example.com"
+	c.grant = "client_credentials"
+	c.token = &oauth2.Token{AccessToken: "expiredaccesstoken"}
+	c.AccessToken = "expiredaccesstoken"
+	_, status, err := c.Call("GET", "/identities/groups/testgroup", "", "", nil, nil)
+	if err != nil || status != 200 {
+		t.Errorf("Expected: %v, Returned: %v (%v).", 200, status, err)
+	}
+}
+
+// credentialsContent reads the sas-viya CLI credentials written by a test
+func credentialsContent(t *testing.T, c *Connection) interface{} {
+	f := c.credentialsFile()
+	if err := f.Read(); err != nil {
+		t.Errorf("Failed reading credentials: %s.", err)
+	}
+	return f.Content
+}
@@ -0,0 +1,65 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPlanMode is returned when a mutating request is attempted while computing a plan
+var ErrPlanMode = errors.New("mutating request refused in plan mode")
+
+// ErrUnexpectedResponse is returned when a REST response does not have the expected structure
+var ErrUnexpectedResponse = errors.New("unexpected response from SAS Viya REST API")
+
+// APIError is returned for SAS Viya REST API responses with an error status code
+type APIError struct {
+	Method  string
+	Path    string
+	Status  int
+	Message string
+	Details []string
+	Body    interface{}
+}
+
+// Error describes the failed request together with the SAS Viya error message
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s returned status %d", e.Method, e.Path, e.Status)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if len(e.Details) > 0 {
+		msg += " (" + strings.Join(e.Details, "; ") + ")"
+	}
+	return msg
+}
+
+// newAPIError extracts the message and details of a SAS Viya error body
+func newAPIError(method, path string, status int, body interface{}) *APIError {
+	e := &APIError{
+		Method: method,
+		Path:   path,
+		Status: status,
+		Body:   body,
+	}
+	if m, ok := body.(map[string]interface{}); ok {
+		if message, ok := m["message"].(string); ok {
+			e.Message = message
+		}
+		if details, ok := m["details"].([]interface{}); ok {
+			for _, detail := range details {
+				e.Details = append(e.Details, fmt.Sprint(detail))
+			}
+		}
+	}
+	return e
+}
+
+// IsStatus reports whether the error was caused by a REST response with the given status code
+func IsStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
@@ -0,0 +1,191 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sassoftware/sas-viya-authorization-model/file"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// expiryMargin is the remaining lifetime below which an OAuth Access Token is renewed before a call
+const expiryMargin = time.Minute
+
+// ErrLoginRequired is returned when the sas-viya CLI token cannot be renewed without an interactive login
+var ErrLoginRequired = errors.New("OAuth Access Token expired. Please refresh using the 'sas-viya auth login' command")
+
+// oauthConfig returns the OAuth 2.0 client registered with SAS Logon Manager
+func (c *Connection) oauthConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.clientID(),
+		ClientSecret: c.options.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  c.BaseURL + "/SASLogon/oauth/authorize",
+			TokenURL: c.BaseURL + "/SASLogon/oauth/token",
+		},
+	}
+}
+
+// oauthContext carries the HTTP client used for token requests
+func (c *Connection) oauthContext() context.Context {
+	return context.WithValue(context.Background(), oauth2.HTTPClient, c.httpClient())
+}
+
+// clientCredentialsToken obtains an OAuth Access Token for a service account
+func (c *Connection) clientCredentialsToken() (*oauth2.Token, error) {
+	config := &clientcredentials.Config{
+		ClientID:     c.clientID(),
+		ClientSecret: c.options.ClientSecret,
+		TokenURL:     c.BaseURL + "/SASLogon/oauth/token",
+	}
+	return config.Token(c.oauthContext())
+}
+
+// refreshToken exchanges a refresh token for a new OAuth Access Token
+func (c *Connection) refreshToken(refresh string) (*oauth2.Token, error) {
+	zap.S().Debugw("Refreshing OAuth Access Token")
+	return c.oauthConfig().TokenSource(c.oauthContext(), &oauth2.Token{RefreshToken: refresh}).Token()
+}
+
+// credentials serializes updates of the sas-viya CLI credentials by the connections of a process
+var credentials sync.Mutex
+
+// credentialsFile returns the location of the sas-viya CLI credentials
+func (c *Connection) credentialsFile() *file.File {
+	f := new(file.File)
+	f.Path = c.home() + "/.sas/credentials.json"
+	f.Type = "json"
+	return f
+}
+
+// readCredentials returns the token of the profile in the sas-viya CLI credentials, refreshing it if expired
+func (c *Connection) readCredentials() (*oauth2.Token, error) {
+	f := c.credentialsFile()
+	if err := f.Read(); err != nil {
+		return nil, fmt.Errorf("reading sas-viya CLI credentials: %w", err)
+	}
+	profile := c.profile()
+	token := new(oauth2.Token)
+	token.AccessToken, _ = profileValue(f.Content, profile, "access-token")
+	token.RefreshToken, _ = profileValue(f.Content, profile, "refresh-token")
+	expiryValue, _ := profileValue(f.Content, profile, "expiry")
+	expiry, err := time.Parse(time.RFC3339, expiryValue)
+	if err != nil {
+		return nil, fmt.Errorf("parsing expiry of OAuth Access Token for profile %q: %w", profile, err)
+	}
+	token.Expiry = expiry
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("profile %q has no access-token in %s", profile, f.Path)
+	}
+	if time.Now().Add(expiryMargin).Before(expiry) {
+		return token, nil
+	}
+	if token.RefreshToken == "" || c.BaseURL == "" {
+		return nil, fmt.Errorf("token expired at %s: %w", expiry, ErrLoginRequired)
+	}
+	zap.S().Infow("OAuth Access Token expired, using refresh token", "profile", profile, "expiry", expiry)
+	renewed, err := c.refreshToken(token.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("refreshing token expired at %s: %v: %w", expiry, err, ErrLoginRequired)
+	}
+	if err := c.writeCredentials(renewed); err != nil {
+		zap.S().Warnw("Renewed OAuth Access Token could not be saved", "error", err)
+	}
+	return renewed, nil
+}
+
+// writeCredentials stores a renewed token in the profile of the sas-viya CLI credentials
+func (c *Connection) writeCredentials(token *oauth2.Token) error {
+	credentials.Lock()
+	defer credentials.Unlock()
+	f := c.credentialsFile()
+	if err := f.Read(); err != nil {
+		return fmt.Errorf("reading sas-viya CLI credentials: %w", err)
+	}
+	profiles, ok := f.Content.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected content of %s", f.Path)
+	}
+	properties, ok := profiles[c.profile()].(map[string]interface{})
+	if !ok {
+		properties = make(map[string]interface{})
+		profiles[c.profile()] = properties
+	}
+	properties["access-token"] = token.AccessToken
+	properties["refresh-token"] = token.RefreshToken
+	properties["expiry"] = token.Expiry.UTC().Format(time.RFC3339)
+	zap.S().Debugw("Saving renewed OAuth Access Token", "path", f.Path, "profile", c.profile())
+	return f.Write()
+}
+
+// renewAccessToken replaces the OAuth Access Token during a run, preferring the refresh token
+func (c *Connection) renewAccessToken() error {
+	zap.S().Infow("Renewing OAuth Access Token", "grant", c.grant)
+	var token *oauth2.Token
+	var err error
+	if c.token != nil && c.token.RefreshToken != "" {
+		token, err = c.refreshToken(c.token.RefreshToken)
+		if err == nil && c.grant == "refresh_token" {
+			if err := c.writeCredentials(token); err != nil {
+				zap.S().Warnw("Renewed OAuth Access Token could not be saved", "error", err)
+			}
+		}
+	}
+	if token == nil {
+		switch c.grant {
+		case "client_credentials":
+			token, err = c.clientCredentialsToken()
+		case "password":
+			token, err = c.oauthConfig().PasswordCredentialsToken(c.oauthContext(), c.options.User, c.options.Password)
+		default:
+			err = fmt.Errorf("no refresh token available: %w", ErrLoginRequired)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("renewing OAuth Access Token: %w", err)
+	}
+	c.token = token
+	c.AccessToken = token.AccessToken
+	return nil
+}
+
+// renew replaces the OAuth Access Token if it is about to expire or, given the rejected token, if it
+// was rejected. Concurrent requests share a single renewal. It reports whether a request sent with the
+// rejected token should be repeated
+func (c *Connection) renew(rejected string) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.token == nil {
+		return false, nil
+	}
+	if rejected == "" && !c.expiring() {
+		return false, nil
+	}
+	if rejected != "" && rejected != c.AccessToken {
+		return true, nil
+	}
+	if err := c.renewAccessToken(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// bearer returns the current OAuth Access Token
+func (c *Connection) bearer() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.AccessToken
+}
+
+// expiring reports whether the OAuth Access Token is about to expire
+func (c *Connection) expiring() bool {
+	return c.token != nil && !c.token.Expiry.IsZero() && time.Now().Add(expiryMargin).After(c.token.Expiry)
+}
@@ -0,0 +1,101 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package connection
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Options configure a connection to SAS Viya. Empty options take their defaults, retries are only made if configured
+type Options struct {
+	// BaseURL of SAS Viya, by default the sas-endpoint of the profile in the sas-viya CLI configuration
+	BaseURL string
+	// Profile of the sas-viya CLI configuration and credentials, by default Default
+	Profile string
+	// Home directory containing the .sas directory of the sas-viya CLI, by default the home directory of the user
+	Home string
+	// CASServer to manage CASLIBs and CAS access controls on, by default cas-shared-default
+	CASServer string
+	// User and Password of a SAS Administrator for the OAuth 2.0 password grant
+	User     string
+	Password string
+	// ClientID and ClientSecret of the OAuth 2.0 client registered with SAS Logon Manager, by default sas.cli
+	ClientID     string
+	ClientSecret string
+	// GrantType client_credentials authenticates as the OAuth 2.0 client itself
+	GrantType string
+	// InsecureTLS allows TLS connections without validating the server certificates
+	InsecureTLS bool
+	// Retries of requests failing with a connection error or a transient status
+	Retries int
+	// RetryWait is the initial delay before a retry, by default 1s, doubled up to RetryMaxWait, by default 30s
+	RetryWait    time.Duration
+	RetryMaxWait time.Duration
+	// RateLimit is the maximum number of requests per second, unlimited if 0
+	RateLimit float64
+	// ResponseLimit is the page size of collections, by default 1000
+	ResponseLimit int
+	// Client sends the requests, by default an HTTP client. InsecureTLS does not apply to a configured Client
+	Client Client
+}
+
+// New returns a connection configured by the options, which is established by Connect
+func New(options Options) *Connection {
+	return &Connection{options: options}
+}
+
+// ResponseLimit returns the page size of collections as expected in the limit query parameter
+func (c *Connection) ResponseLimit() string {
+	if c.options.ResponseLimit <= 0 {
+		return "1000"
+	}
+	return strconv.Itoa(c.options.ResponseLimit)
+}
+
+// profile returns the sas-viya CLI profile of the connection
+func (c *Connection) profile() string {
+	if c.options.Profile == "" {
+		return "Default"
+	}
+	return c.options.Profile
+}
+
+// home returns the directory containing the .sas directory of the sas-viya CLI
+func (c *Connection) home() string {
+	if c.options.Home == "" {
+		home, _ := os.UserHomeDir()
+		return home
+	}
+	return c.options.Home
+}
+
+// casServer returns the CAS server of the connection
+func (c *Connection) casServer() string {
+	if c.options.CASServer == "" {
+		return "cas-shared-default"
+	}
+	return c.options.CASServer
+}
+
+// clientID returns the OAuth 2.0 client of the connection
+func (c *Connection) clientID() string {
+	if c.options.ClientID == "" {
+		return "sas.cli"
+	}
+	return c.options.ClientID
+}
+
+// retryWait returns the initial and maximum delay before a retry
+func (c *Connection) retryWait() (time.Duration, time.Duration) {
+	var wait, maxWait time.Duration = c.options.RetryWait, c.options.RetryMaxWait
+	if wait <= 0 {
+		wait = time.Second
+	}
+	if maxWait <= 0 {
+		maxWait = 30 * time.Second
+	}
+	return wait, maxWait
+}
@@ -0,0 +1,106 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package connection
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// retryable reports whether a failed request is worth another attempt. Idempotent methods are retried on transient
+// network errors and gateway failures. Other methods, e.g. a POST creating a resource, could have been processed
+// already, so they are only retried if the connection was refused or SAS Viya rejected the request without
+// processing it
+func retryable(method string, resp *http.Response, err error) bool {
+	var idempotent bool
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		idempotent = true
+	}
+	if err != nil {
+		var netErr net.Error
+		return errors.Is(err, syscall.ECONNREFUSED) || (idempotent && (errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, io.EOF) ||
+			errors.Is(err, io.ErrUnexpectedEOF) ||
+			(errors.As(err, &netErr) && netErr.Timeout())))
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// backoff returns the jittered, exponentially increasing delay before a retry
+func backoff(attempt int, wait, maxWait time.Duration) time.Duration {
+	delay := wait
+	for i := 0; i < attempt && delay < maxWait; i++ {
+		delay *= 2
+	}
+	if delay > maxWait {
+		delay = maxWait
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryAfter returns the delay requested by the Retry-After header of a response, if any
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// limiter spaces requests to stay below a maximum number of requests per second
+type limiter struct {
+	interval time.Duration
+	mutex    sync.Mutex
+	next     time.Time
+}
+
+// newLimiter returns a limiter for the given requests per second, or nil if unlimited
+func newLimiter(rate float64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait blocks until the next request is allowed
+func (l *limiter) wait() {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mutex.Unlock()
+	time.Sleep(delay)
+}
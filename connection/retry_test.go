@@ -0,0 +1,145 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package connection
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCallRetry(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		rw.Header().Set("Content-Type", "application/json")
+		if requests < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Write([]byte(`{"id": "test"}`))
+	}))
+	defer server.Close()
+	c := New(Options{Retries: 3, RetryWait: time.Millisecond, RetryMaxWait: 5 * time.Millisecond})
+	c.BaseURL = server.URL
+	c.AccessToken = "testaccesstoken"
+	_, status, err := c.Call("GET", "/identities/groups", "", "", nil, nil)
+	if err != nil || status != 200 {
+		t.Errorf("Expected: %v, Returned: %v (%v).", 200, status, err)
+	}
+	if requests != 3 || c.Count != 3 {
+		t.Errorf("Expected: %v, Returned: %v.", 3, requests)
+	}
+}
+
+func TestCallRetryExhausted(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		rw.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	c := New(Options{Retries: 2, RetryWait: time.Millisecond, RetryMaxWait: 5 * time.Millisecond})
+	c.BaseURL = server.URL
+	c.AccessToken = "testaccesstoken"
+	_, _, err := c.Call("GET", "/identities/groups", "", "", nil, nil)
+	if !IsStatus(err, http.StatusTooManyRequests) {
+		t.Errorf("Expected: %v, Returned: %v.", http.StatusTooManyRequests, err)
+	}
+	if requests != 3 {
+		t.Errorf("Expected: %v, Returned: %v.", 3, requests)
+	}
+}
+
+func TestCallRetryPost(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		rw.WriteHeader(http.StatusGatewayTimeout)
+	}))
+	defer server.Close()
+	c := New(Options{Retries: 2, RetryWait: time.Millisecond, RetryMaxWait: 5 * time.Millisecond})
+	c.BaseURL = server.URL
+	c.AccessToken = "testaccesstoken"
+	// the group could have been created although the gateway timed out
+	_, _, err := c.Call("POST", "/identities/groups", "application/json", "", nil, []byte(`{"id": "test"}`))
+	if !IsStatus(err, http.StatusGatewayTimeout) {
+		t.Errorf("Expected: %v, Returned: %v.", http.StatusGatewayTimeout, err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected: %v, Returned: %v.", 1, requests)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		method   string
+		status   int
+		err      error
+		expected bool
+	}{
+		{"GET", http.StatusBadGateway, nil, true},
+		{"PUT", 0, io.EOF, true},
+		{"DELETE", 0, syscall.ECONNRESET, true},
+		{"POST", http.StatusBadGateway, nil, false},
+		{"POST", 0, io.EOF, false},
+		{"PATCH", 0, syscall.ECONNRESET, false},
+		{"POST", 0, syscall.ECONNREFUSED, true},
+		{"POST", http.StatusTooManyRequests, nil, true},
+		{"POST", http.StatusServiceUnavailable, nil, true},
+		{"GET", http.StatusInternalServerError, nil, false},
+	}
+	for _, test := range tests {
+		var resp *http.Response
+		if test.err == nil {
+			resp = &http.Response{StatusCode: test.status}
+		}
+		if returned := retryable(test.method, resp, test.err); returned != test.expected {
+			t.Errorf("Expected: %v, Returned: %v (%s %d %v).", test.expected, returned, test.method, test.status, test.err)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		returned := backoff(attempt, time.Second, 5*time.Second)
+		if returned < expected/2 || returned > expected {
+			t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Retry-After", "7")
+	var expected time.Duration = 7 * time.Second
+	returned := retryAfter(resp)
+	if returned != expected {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+	resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	returned = retryAfter(resp)
+	if returned < 59*time.Minute || returned > time.Hour {
+		t.Errorf("Expected: %v, Returned: %v.", time.Hour, returned)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	if newLimiter(0) != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, newLimiter(0))
+	}
+	l := newLimiter(100)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		l.wait()
+	}
+	var expected time.Duration = 40 * time.Millisecond
+	returned := time.Since(start)
+	if returned < expected {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package drift
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
+)
+
+// Statuses of a finding
+const (
+	Missing   = "missing"
+	Extra     = "extra"
+	Divergent = "divergent"
+)
+
+// Finding describes a single difference between a model and the SAS Viya environment
+type Finding struct {
+	Model    string      `json:"model"`
+	Status   string      `json:"status"`
+	Resource string      `json:"resource"`
+	Target   string      `json:"target"`
+	Changes  []pl.Change `json:"changes"`
+}
+
+// Report collects the findings of all compared models
+type Report struct {
+	Models   []string
+	Findings []Finding
+}
+
+// Add the changes a sync of a model would make as findings. A removal and an addition on the same subject,
+// e.g. an authorization rule of a principal on a URI with other permissions, is reported as divergent
+func (r *Report) Add(model string, plan *pl.Plan) {
+	r.Models = append(r.Models, model)
+	indexes := make(map[string]int)
+	for _, c := range plan.Changes {
+		var key string = subject(c)
+		if i, exists := indexes[key]; exists {
+			r.Findings[i].Changes = append(r.Findings[i].Changes, c)
+			if r.Findings[i].Status != status(c.Action) {
+				r.Findings[i].Status = Divergent
+			}
+			continue
+		}
+		indexes[key] = len(r.Findings)
+		r.Findings = append(r.Findings, Finding{
+			Model:    model,
+			Status:   status(c.Action),
+			Resource: c.Resource,
+			Target:   c.Target,
+			Changes:  []pl.Change{c},
+		})
+	}
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		a, b := r.Findings[i], r.Findings[j]
+		if a.Model != b.Model {
+			return r.index(a.Model) < r.index(b.Model)
+		}
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		return a.Target < b.Target
+	})
+}
+
+// Drifted reports whether any differences were found
+func (r *Report) Drifted() bool {
+	return len(r.Findings) > 0
+}
+
+// Summary counts the missing, extra and divergent findings
+func (r *Report) Summary() (missing, extra, divergent int) {
+	for _, f := range r.Findings {
+		switch f.Status {
+		case Missing:
+			missing++
+		case Extra:
+			extra++
+		default:
+			divergent++
+		}
+	}
+	return
+}
+
+// WriteText writes a human readable representation of the report
+func (r *Report) WriteText(w io.Writer) {
+	if !r.Drifted() {
+		fmt.Fprintln(w, "No drift. The SAS Viya environment matches the provided definition.")
+		return
+	}
+	for _, f := range r.Findings {
+		fmt.Fprintf(w, "  %s %s %s %s\n", f.Model, f.Status, f.Resource, f.Target)
+	}
+	missing, extra, divergent := r.Summary()
+	fmt.Fprintf(w, "\nDrift: %d missing, %d extra, %d divergent.\n", missing, extra, divergent)
+}
+
+// WriteJSON writes a machine readable representation of the report
+func (r *Report) WriteJSON(w io.Writer) error {
+	missing, extra, divergent := r.Summary()
+	findings := r.Findings
+	if findings == nil {
+		findings = []Finding{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{
+		"drift":    r.Drifted(),
+		"findings": findings,
+		"summary": map[string]int{
+			"missing":   missing,
+			"extra":     extra,
+			"divergent": divergent,
+		},
+	})
+}
+
+// junitSuites is the root element of a JUnit XML report
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML with a test suite per model and a failed test case per finding.
+// A model without findings is reported as a single passed test case
+func (r *Report) WriteJUnit(w io.Writer) error {
+	report := junitSuites{Name: "drift"}
+	for _, model := range r.Models {
+		suite := junitSuite{Name: model}
+		for _, f := range r.Findings {
+			if f.Model != model {
+				continue
+			}
+			var details []string
+			for _, c := range f.Changes {
+				details = append(details, c.Action+" "+c.Resource+" "+c.Target+attributes(c))
+			}
+			suite.Cases = append(suite.Cases, junitCase{
+				Name:      f.Resource + " " + f.Target,
+				ClassName: model,
+				Failure: &junitFailure{
+					Message: f.Resource + " " + f.Target + " is " + f.Status,
+					Type:    f.Status,
+					Text:    strings.Join(details, "\n"),
+				},
+			})
+			suite.Failures++
+		}
+		if len(suite.Cases) == 0 {
+			suite.Cases = append(suite.Cases, junitCase{Name: "in sync", ClassName: model})
+		}
+		suite.Tests = len(suite.Cases)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Suites = append(report.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// index returns the position of a model in the report
+func (r *Report) index(model string) int {
+	for i, m := range r.Models {
+		if m == model {
+			return i
+		}
+	}
+	return len(r.Models)
+}
+
+// status derives the status of a finding from the action that would resolve it
+func status(action string) string {
+	switch action {
+	case "create", "add":
+		return Missing
+	case "delete", "remove":
+		return Extra
+	default:
+		return Divergent
+	}
+}
+
+// subject identifies what a change applies to, so that removals and additions on it can be matched
+func subject(c pl.Change) string {
+	var key string = c.Resource + " " + c.Target
+	for _, attribute := range []string{"identity", "group", "user"} {
+		if value, exists := c.Attributes[attribute]; exists {
+			key = key + " " + attribute + " " + fmt.Sprint(value)
+		}
+	}
+	return key
+}
+
+// attributes renders the attributes of a change on a single line
+func attributes(c pl.Change) string {
+	var keys []string
+	for key := range c.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, c.Attributes[key]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(pairs, ", ") + ")"
+}
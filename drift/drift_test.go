@@ -0,0 +1,89 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package drift
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
+)
+
+func TestAdd(t *testing.T) {
+	rules := new(pl.Plan)
+	rules.Add("delete", "rule", "per001 on /SASDrive/**", map[string]interface{}{"id": "1"})
+	rules.Add("create", "rule", "per001 on /SASDrive/**", map[string]interface{}{"type": "grant", "permissions": []string{"read"}})
+	rules.Add("create", "group", "per002", nil)
+	controls := new(pl.Plan)
+	controls.Add("remove", "accessControl", "testcas", map[string]interface{}{"identity": "group per001", "permission": "select"})
+	report := new(Report)
+	report.Add("matrix", rules)
+	report.Add("dap", controls)
+	expected := []struct {
+		model, status, resource, target string
+		changes                         int
+	}{
+		{"matrix", Missing, "group", "per002", 1},
+		{"matrix", Divergent, "rule", "per001 on /SASDrive/**", 2},
+		{"dap", Extra, "accessControl", "testcas", 1},
+	}
+	if len(report.Findings) != len(expected) {
+		t.Fatalf("Expected: %v, Returned: %v.", len(expected), len(report.Findings))
+	}
+	for i, e := range expected {
+		f := report.Findings[i]
+		if f.Model != e.model || f.Status != e.status || f.Resource != e.resource || f.Target != e.target || len(f.Changes) != e.changes {
+			t.Errorf("Expected: %v, Returned: %v.", e, f)
+		}
+	}
+	if missing, extra, divergent := report.Summary(); missing != 1 || extra != 1 || divergent != 1 {
+		t.Errorf("Expected: %v, Returned: %v.", []int{1, 1, 1}, []int{missing, extra, divergent})
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	report := new(Report)
+	report.Add("groups", new(pl.Plan))
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	var returned struct {
+		Drift    bool          `json:"drift"`
+		Findings []interface{} `json:"findings"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &returned); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if returned.Drift || returned.Findings == nil || len(returned.Findings) != 0 {
+		t.Errorf("Expected: %v, Returned: %v.", "no drift", buf.String())
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	groups := new(pl.Plan)
+	groups.Add("add", "membership", "per001", map[string]interface{}{"user": "testuser"})
+	report := new(Report)
+	report.Add("groups", groups)
+	report.Add("matrix", new(pl.Plan))
+	var buf bytes.Buffer
+	if err := report.WriteJUnit(&buf); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	var returned junitSuites
+	if err := xml.Unmarshal(buf.Bytes(), &returned); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if returned.Tests != 2 || returned.Failures != 1 || len(returned.Suites) != 2 {
+		t.Errorf("Expected: %v, Returned: %v.", "2 tests with 1 failure in 2 suites", buf.String())
+	}
+	if returned.Suites[0].Cases[0].Failure == nil || returned.Suites[0].Cases[0].Failure.Type != Missing {
+		t.Errorf("Expected: %v, Returned: %v.", Missing, returned.Suites[0].Cases[0].Failure)
+	}
+	if returned.Suites[1].Cases[0].Failure != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, returned.Suites[1].Cases[0].Failure)
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package explain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
+	ca "github.com/sassoftware/sas-viya-authorization-model/cas"
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	fo "github.com/sassoftware/sas-viya-authorization-model/folder"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	"go.uber.org/zap"
+)
+
+// Sources of a decision
+const (
+	Viya    = "SAS Viya"
+	Derived = "derived"
+)
+
+// NotGranted is the result of a permission that no rule or access control grants or prohibits
+const NotGranted = "not granted"
+
+// principal types every user inherits access from, ranked after the groups of the user
+var everybody = map[string]int{
+	"authenticatedUsers": 1000,
+	"everyone":           1001,
+}
+
+// Explanation of the effective access of a user to a URI or CASLIB
+type Explanation struct {
+	User         string        `json:"user"`
+	Target       string        `json:"target"`
+	Decisions    []Decision    `json:"decisions"`
+	Memberships  []Membership  `json:"memberships"`
+	Contributors []Contributor `json:"contributors"`
+}
+
+// Decision is the effective result of a permission, decided by SAS Viya or derived from the contributors
+type Decision struct {
+	Permission string `json:"permission"`
+	Result     string `json:"result"`
+	Source     string `json:"source"`
+}
+
+// Membership is a group the user is a direct or indirect member of, with the shortest path of nested groups
+type Membership struct {
+	Group string   `json:"group"`
+	Path  []string `json:"path"`
+}
+
+// Contributor is an authorization rule or CAS access control that applies to the user, through the user itself, a
+// group membership or a principal type such as authenticatedUsers. Rules conveyed by a folder name its path
+type Contributor struct {
+	ID            string   `json:"id,omitempty"`
+	Type          string   `json:"type"`
+	Principal     string   `json:"principal,omitempty"`
+	PrincipalType string   `json:"principalType"`
+	Permissions   []string `json:"permissions"`
+	URI           string   `json:"uri"`
+	Folder        string   `json:"folder,omitempty"`
+	Condition     string   `json:"condition,omitempty"`
+	Path          []string `json:"path"`
+	level         int
+	distance      int
+}
+
+// URI explains the effective access of a user to an object URI, e.g. a report or folder. The rules on the URI itself
+// and the rules conveyed by the folders containing it are considered
+func URI(connection *co.Connection, user, uri string) (*Explanation, error) {
+	zap.S().Debugw("Explaining effective access", "user", user, "uri", uri)
+	e := &Explanation{User: user, Target: uri}
+	paths, err := e.memberships(connection)
+	if err != nil {
+		return nil, err
+	}
+	ancestors, err := fo.Ancestors(connection, uri)
+	if err != nil {
+		return nil, err
+	}
+	var filter string = "or(eq(objectUri,'" + uri + "'),eq(objectUri,'" + uri + "/**')"
+	distances := make(map[string]int)
+	folders := make(map[string]string)
+	for i, ancestor := range ancestors {
+		filter += ",eq(containerUri,'" + ancestor.URI + "')"
+		distances[ancestor.URI] = i + 1
+		folders[ancestor.URI] = ancestor.Path
+	}
+	rules, err := au.List(connection, filter+")")
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if rule.Enabled == "false" || expired(rule.ExpirationTimeStamp) {
+			continue
+		}
+		path, level, applies := e.identity(paths, rule.Principal.Type, rule.Principal.ID)
+		if !applies {
+			continue
+		}
+		c := Contributor{
+			ID:            rule.IDs[0],
+			Type:          rule.Type,
+			PrincipalType: rule.Principal.Type,
+			Permissions:   rule.Permissions,
+			URI:           rule.ObjectURI,
+			Condition:     rule.Condition,
+			Path:          path,
+			level:         level,
+		}
+		if rule.Principal.Type == "group" || rule.Principal.Type == "user" {
+			c.Principal = rule.Principal.ID
+		}
+		if rule.ContainerURI != "" {
+			c.URI = rule.ContainerURI
+			c.Folder = folders[rule.ContainerURI]
+			c.distance = distances[rule.ContainerURI]
+		}
+		e.Contributors = append(e.Contributors, c)
+	}
+	decisions, err := au.Decisions(connection, user, uri)
+	if err != nil {
+		zap.S().Warnw("SAS Viya did not decide the effective access, deriving it from the rules", "error", err)
+	}
+	for _, permission := range mo.RulePermissions {
+		if result, decided := decisions[permission]; decided {
+			e.Decisions = append(e.Decisions, Decision{Permission: permission, Result: result, Source: Viya})
+		} else {
+			e.Decisions = append(e.Decisions, Decision{Permission: permission, Result: e.derive(permission), Source: Derived})
+		}
+	}
+	return e, nil
+}
+
+// Folder explains the effective access of a user to a folder path
+func Folder(connection *co.Connection, user, path string) (*Explanation, error) {
+	f := &fo.Folder{Path: strings.TrimSuffix(path, "/"), Connection: connection}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	if !f.Exists {
+		return nil, fmt.Errorf("explaining access to %s: %w", f.Path, fo.ErrFolderMissing)
+	}
+	e, err := URI(connection, user, f.URI)
+	if err != nil {
+		return nil, err
+	}
+	e.Target = f.Path + " (" + f.URI + ")"
+	return e, nil
+}
+
+// CASLIB explains the access of a user to a CASLIB, derived from its direct CAS access controls
+func CASLIB(connection *co.Connection, user, name string) (*Explanation, error) {
+	zap.S().Debugw("Explaining effective access", "user", user, "CASLIB", name)
+	lib := &ca.LIB{Name: name, Connection: connection}
+	if err := lib.Validate(); err != nil {
+		return nil, err
+	}
+	if !lib.Exists {
+		return nil, fmt.Errorf("explaining access to CASLIB %s: CASLIB does not exist", name)
+	}
+	e := &Explanation{User: user, Target: "CASLIB " + name}
+	paths, err := e.memberships(connection)
+	if err != nil {
+		return nil, err
+	}
+	controls, err := lib.Controls()
+	if err != nil {
+		return nil, err
+	}
+	for _, control := range controls {
+		path, level, applies := e.identity(paths, control.IdentityType, control.Identity)
+		if !applies {
+			continue
+		}
+		c := Contributor{
+			Type:          control.Type,
+			PrincipalType: control.IdentityType,
+			Permissions:   []string{control.Permission},
+			URI:           name,
+			Condition:     control.TableFilter,
+			Path:          path,
+			level:         level,
+		}
+		if control.IdentityType == "group" || control.IdentityType == "user" {
+			c.Principal = control.Identity
+		}
+		e.Contributors = append(e.Contributors, c)
+	}
+	for _, permission := range mo.CASPermissions {
+		e.Decisions = append(e.Decisions, Decision{Permission: permission, Result: e.derive(permission), Source: Derived})
+	}
+	return e, nil
+}
+
+// memberships walks the group ancestry of the user breadth first, so that every group is reached by its shortest
+// path of nested groups, and returns the paths by group
+func (e *Explanation) memberships(connection *co.Connection) (map[string][]string, error) {
+	paths := make(map[string][]string)
+	queue := []*pr.Principal{{ID: e.User, Type: "user", Connection: connection}}
+	from := map[string][]string{e.User: {e.User}}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if err := p.GetParents(); err != nil {
+			return nil, err
+		}
+		for _, parent := range p.Parents {
+			if _, seen := paths[parent.ID]; seen {
+				continue
+			}
+			path := append(append([]string{}, from[p.ID]...), parent.ID)
+			paths[parent.ID] = path
+			from[parent.ID] = path
+			e.Memberships = append(e.Memberships, Membership{Group: parent.ID, Path: path})
+			queue = append(queue, parent)
+		}
+	}
+	return paths, nil
+}
+
+// identity reports whether a principal applies to the user and returns how it reaches the user together with its
+// precedence: the user itself first, then its groups from the nearest and finally every authenticated user
+func (e *Explanation) identity(paths map[string][]string, principalType, id string) ([]string, int, bool) {
+	switch principalType {
+	case "user":
+		return []string{e.User}, 0, strings.EqualFold(id, e.User)
+	case "group":
+		path, member := paths[id]
+		return path, len(path) - 1, member
+	default:
+		level, applies := everybody[principalType]
+		return []string{e.User, principalType}, level, applies
+	}
+}
+
+// derive decides a permission from the contributors. Rules on the object itself take precedence over conveyed rules
+// and nearer folders over further ones, then the user over its groups and nearer groups over further ones. At the same
+// precedence a prohibit or deny wins over a grant
+func (e *Explanation) derive(permission string) string {
+	var decisive *Contributor
+	for i := range e.Contributors {
+		c := &e.Contributors[i]
+		if !contains(c.Permissions, permission) {
+			continue
+		}
+		if decisive == nil || c.distance < decisive.distance ||
+			(c.distance == decisive.distance && c.level < decisive.level) ||
+			(c.distance == decisive.distance && c.level == decisive.level && decisive.Type == "grant" && c.Type != "grant") {
+			decisive = c
+		}
+	}
+	if decisive == nil {
+		return NotGranted
+	}
+	return decisive.Type
+}
+
+// WriteText writes a human readable representation of the explanation
+func (e *Explanation) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Effective access of user %s to %s\n", e.User, e.Target)
+	for _, d := range e.Decisions {
+		fmt.Fprintf(w, "  %-12s %-12s (%s)\n", d.Permission, d.Result, d.Source)
+	}
+	fmt.Fprintf(w, "\nGroup memberships of %s\n", e.User)
+	if len(e.Memberships) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, m := range e.Memberships {
+		fmt.Fprintf(w, "  %s\n", strings.Join(m.Path, " > "))
+	}
+	fmt.Fprintln(w, "\nContributing rules")
+	if len(e.Contributors) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, c := range e.Contributors {
+		var principal string = c.PrincipalType
+		if c.Principal != "" {
+			principal += " " + c.Principal
+		}
+		fmt.Fprintf(w, "  %s %s to %s on %s", c.Type, strings.Join(c.Permissions, ","), principal, c.URI)
+		if c.Folder != "" {
+			fmt.Fprintf(w, " conveyed by folder %s", c.Folder)
+		}
+		if c.Condition != "" {
+			fmt.Fprintf(w, " if %s", c.Condition)
+		}
+		fmt.Fprintf(w, " via %s", strings.Join(c.Path, " > "))
+		if c.ID != "" {
+			fmt.Fprintf(w, " [%s]", c.ID)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// WriteJSON writes a machine readable representation of the explanation
+func (e *Explanation) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
+
+// expired reports whether an expiration timestamp has passed
+func expired(timestamp string) bool {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	return err == nil && t.Before(time.Now())
+}
+
+// contains checks whether a list contains a value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package explain
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+)
+
+// server simulates the identities, folders, authorization and CAS access management endpoints of SAS Viya
+func server(t *testing.T, decisions bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/identities/users/alice/memberships":
+			rw.Write([]byte(`{"count": 1, "items": [{"id": "HR", "name": "Human Resources"}]}`))
+		case "/identities/groups/HR/memberships":
+			rw.Write([]byte(`{"count": 1, "items": [{"id": "per001", "name": "Persona: Business User"}]}`))
+		case "/identities/groups/per001/memberships":
+			rw.Write([]byte(`{"count": 0, "items": []}`))
+		case "/folders/ancestors":
+			rw.Write([]byte(`{"ancestors": [{"id": "b", "name": "HR"}, {"id": "a", "name": "Projects"}]}`))
+		case "/authorization/rules":
+			rw.Write([]byte(`{"count": 5, "items": [
+				{"id": "rule1", "principalType": "authenticatedUsers", "type": "grant", "permissions": ["read"], "objectUri": "/reports/reports/1", "enabled": true},
+				{"id": "rule2", "principal": "per001", "principalType": "group", "type": "grant", "permissions": ["read", "update"], "containerUri": "/folders/folders/b", "enabled": true},
+				{"id": "rule3", "principal": "HR", "principalType": "group", "type": "prohibit", "permissions": ["update"], "containerUri": "/folders/folders/a", "enabled": true},
+				{"id": "rule4", "principal": "Finance", "principalType": "group", "type": "grant", "permissions": ["delete"], "objectUri": "/reports/reports/1", "enabled": true},
+				{"id": "rule5", "principal": "alice", "principalType": "user", "type": "prohibit", "permissions": ["read"], "objectUri": "/reports/reports/1", "enabled": false}
+			]}`))
+		case "/authorization/decisions":
+			if !decisions {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if req.URL.Query().Get("resourceUri") != "/reports/reports/1" || req.URL.Query().Get("principal") != "alice" {
+				t.Errorf("Expected: %v, Returned: %v.", "/reports/reports/1 alice", req.URL.RawQuery)
+			}
+			rw.Write([]byte(`{"explanations": [{"principal": {"name": "alice", "type": "user"}, "read": {"result": "grant"}, "update": {"result": "prohibit"}}]}`))
+		case "/casManagement/servers/cas-shared-default/caslibs":
+			rw.Write([]byte(`{"count": 1, "items": [{"name": "HRDATA"}]}`))
+		case "/casAccessManagement/servers/cas-shared-default/caslibControls/HRDATA":
+			rw.Write([]byte(`{"count": 4, "items": [
+				{"identity": "HR", "identityType": "group", "permission": "select", "type": "grant"},
+				{"identity": "per001", "identityType": "group", "permission": "readInfo", "type": "grant"},
+				{"identity": "alice", "identityType": "user", "permission": "select", "type": "deny"},
+				{"identity": "Finance", "identityType": "group", "permission": "readInfo", "type": "deny"}
+			]}`))
+		default:
+			t.Errorf("Unexpected request: %s %s.", req.Method, req.URL.String())
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func connect(url string) *co.Connection {
+	c := new(co.Connection)
+	c.BaseURL = url
+	c.AccessToken = "testaccesstoken"
+	c.CASServer = "cas-shared-default"
+	c.Connected = true
+	return c
+}
+
+func TestURI(t *testing.T) {
+	for name, test := range map[string]struct {
+		decisions bool
+		expected  []Decision
+	}{
+		"Viya": {true, []Decision{{"read", "grant", Viya}, {"update", "prohibit", Viya}, {"delete", NotGranted, Derived}}},
+		// the grant conveyed by the nearer folder HR wins over the prohibit conveyed by Projects
+		"Derived": {false, []Decision{{"read", "grant", Derived}, {"update", "grant", Derived}, {"delete", NotGranted, Derived}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := server(t, test.decisions)
+			defer s.Close()
+			e, err := URI(connect(s.URL), "alice", "/reports/reports/1")
+			if err != nil {
+				t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+			}
+			if !reflect.DeepEqual(test.expected, e.Decisions[:3]) {
+				t.Errorf("Expected: %v, Returned: %v.", test.expected, e.Decisions[:3])
+			}
+			memberships := []Membership{{"HR", []string{"alice", "HR"}}, {"per001", []string{"alice", "HR", "per001"}}}
+			if !reflect.DeepEqual(memberships, e.Memberships) {
+				t.Errorf("Expected: %v, Returned: %v.", memberships, e.Memberships)
+			}
+			var ids []string
+			for _, c := range e.Contributors {
+				ids = append(ids, c.ID)
+			}
+			if !reflect.DeepEqual([]string{"rule1", "rule2", "rule3"}, ids) {
+				t.Errorf("Expected: %v, Returned: %v.", []string{"rule1", "rule2", "rule3"}, ids)
+			}
+			var text bytes.Buffer
+			e.WriteText(&text)
+			var expected string = "grant read,update to group per001 on /folders/folders/b conveyed by folder /Projects/HR via alice > HR > per001 [rule2]"
+			if !strings.Contains(text.String(), expected) {
+				t.Errorf("Expected: %v, Returned: %v.", expected, text.String())
+			}
+		})
+	}
+}
+
+func TestCASLIB(t *testing.T) {
+	s := server(t, false)
+	defer s.Close()
+	e, err := CASLIB(connect(s.URL), "alice", "HRDATA")
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	// the deny of the user itself wins over the grant of its group
+	expected := []Decision{{"readInfo", "grant", Derived}, {"select", "deny", Derived}, {"limitedPromote", NotGranted, Derived}}
+	if !reflect.DeepEqual(expected, e.Decisions[:3]) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, e.Decisions[:3])
+	}
+	if len(e.Contributors) != 3 {
+		t.Errorf("Expected: %v, Returned: %v.", 3, len(e.Contributors))
+	}
+}
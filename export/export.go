@@ -0,0 +1,340 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package export
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
+	ca "github.com/sassoftware/sas-viya-authorization-model/cas"
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	fo "github.com/sassoftware/sas-viya-authorization-model/folder"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	"go.uber.org/zap"
+)
+
+// Schemas of the exported model CSV files
+var (
+	GroupsSchema      = mo.GroupsSchema
+	MatrixSchema      = mo.MatrixSchema
+	IPAPPatternSchema = mo.IPAPPatternSchema
+	IPAPFoldersSchema = mo.IPAPFoldersSchema
+	DAPPatternSchema  = mo.DAPPatternSchema
+	DAPCASLIBsSchema  = mo.DAPCASLIBsSchema
+)
+
+// Permissions are ordered as documented, so that identical rules and access controls result in identical patterns
+var (
+	casPermissions  = mo.CASPermissions
+	rulePermissions = mo.RulePermissions
+)
+
+// Groups exports all custom groups with their direct group and user members
+func Groups(connection *co.Connection) ([][]string, error) {
+	groups, err := pr.Groups(connection)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+	names := make(map[string]string)
+	for _, g := range groups {
+		names[g.ID] = g.Name
+	}
+	var rows [][]string = [][]string{GroupsSchema}
+	defined := make(map[string]bool)
+	var users [][]string
+	for _, g := range groups {
+		zap.S().Debugw("Exporting custom group", "id", g.ID)
+		members := connection.Collection("/identities/groups/"+g.ID+"/members", [][]string{
+			0: {
+				"limit",
+				connection.ResponseLimit(),
+			},
+		})
+		for members.Next() {
+			id, _ := members.Item()["id"].(string)
+			if members.Item()["type"] == "group" {
+				name, _ := members.Item()["name"].(string)
+				if local, exists := names[id]; exists {
+					name = local
+				}
+				rows = append(rows, []string{g.ID, id, name, ""})
+				defined[id] = true
+			} else {
+				users = append(users, []string{"", g.ID, g.Name, id})
+				defined[g.ID] = true
+			}
+		}
+		if err := members.Err(); err != nil {
+			return nil, fmt.Errorf("exporting members of custom group %s: %w", g.ID, err)
+		}
+	}
+	for _, g := range groups {
+		if !defined[g.ID] {
+			rows = append(rows, []string{"", g.ID, g.Name, ""})
+		}
+	}
+	return append(rows, users...), nil
+}
+
+// Matrix exports the grants of groups and authenticated users on object URIs outside of folders
+func Matrix(connection *co.Connection, managedOnly bool) ([][]string, error) {
+	rules, err := au.List(connection, "")
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	for _, rule := range rules {
+		if !rule.Capability() || !exportable(rule, managedOnly) {
+			continue
+		}
+		rows = append(rows, append([]string{rule.ObjectURI, principal(rule), strings.Join(order(rulePermissions, rule.Permissions), ",")}, options(rule)...))
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i][0] != rows[j][0] {
+			return rows[i][0] < rows[j][0]
+		}
+		return rows[i][1] < rows[j][1]
+	})
+	return append([][]string{MatrixSchema}, rows...), nil
+}
+
+// Folders exports the folder trees below the given root paths (all root folders if none are given) except the
+// excluded paths. Folders sharing identical rules share an IPAP. Folders without rules are only exported if they
+// are the parent of a folder with rules, so that the tree can be created again
+func Folders(connection *co.Connection, roots, exclude []string, managedOnly bool) (patterns, folders [][]string, err error) {
+	var queue []*fo.Folder
+	if len(roots) == 0 {
+		if queue, err = fo.Roots(connection); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		for _, root := range roots {
+			f := new(fo.Folder)
+			f.Path = strings.TrimSuffix(root, "/")
+			f.Connection = connection
+			if err := f.Validate(); err != nil {
+				return nil, nil, err
+			}
+			if !f.Exists {
+				return nil, nil, fmt.Errorf("exporting folder %s: %w", f.Path, fo.ErrFolderMissing)
+			}
+			queue = append(queue, f)
+		}
+	}
+	excluded := make(map[string]bool)
+	for _, path := range exclude {
+		excluded[strings.TrimSuffix(path, "/")] = true
+	}
+	var visited []*fo.Folder
+	signatures := make(map[*fo.Folder][][]string)
+	for len(queue) > 0 {
+		f := queue[0]
+		queue = queue[1:]
+		if excluded[f.Path] {
+			zap.S().Debugw("Skipping excluded folder", "path", f.Path)
+			continue
+		}
+		zap.S().Debugw("Exporting folder", "path", f.Path)
+		if err := f.GetAuthorization(); err != nil {
+			return nil, nil, err
+		}
+		var signature [][]string
+		for _, rule := range f.Authorization {
+			if !exportable(rule, managedOnly) {
+				continue
+			}
+			var grantType string = "object"
+			if rule.ContainerURI != "" {
+				grantType = "conveyed"
+			}
+			signature = append(signature, append([]string{principal(rule), grantType, strings.Join(order(rulePermissions, rule.Permissions), ",")}, options(rule)...))
+		}
+		sortRows(signature)
+		signatures[f] = signature
+		visited = append(visited, f)
+		children, err := f.Children()
+		if err != nil {
+			return nil, nil, err
+		}
+		queue = append(queue, children...)
+	}
+	required := make(map[*fo.Folder]bool)
+	for _, f := range visited {
+		if len(signatures[f]) > 0 {
+			for p := f; p != nil; p = p.Parent {
+				required[p] = true
+			}
+		}
+	}
+	sort.SliceStable(visited, func(i, j int) bool {
+		return visited[i].Path < visited[j].Path
+	})
+	var names []string
+	var sets [][][]string
+	for _, f := range visited {
+		if required[f] {
+			names = append(names, f.Path)
+			sets = append(sets, signatures[f])
+		}
+	}
+	patterns, assigned := infer("ipap", sets)
+	folders = [][]string{IPAPFoldersSchema}
+	for i, name := range names {
+		folders = append(folders, []string{name, assigned[i]})
+	}
+	return append([][]string{IPAPPatternSchema}, patterns...), folders, nil
+}
+
+// CASLIBs exports the direct grants of all global scope CASLIBs. CASLIBs sharing identical access controls share a DAP
+func CASLIBs(connection *co.Connection) (patterns, caslibs [][]string, err error) {
+	libs, err := ca.List(connection)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(libs, func(i, j int) bool {
+		return libs[i].Name < libs[j].Name
+	})
+	var exported []*ca.LIB
+	var sets [][][]string
+	for _, lib := range libs {
+		zap.S().Debugw("Exporting CASLIB", "name", lib.Name)
+		controls, err := lib.Controls()
+		if err != nil {
+			return nil, nil, err
+		}
+		permissions := make(map[string][]string)
+		var identities []string
+		for _, control := range controls {
+			if control.Type != "grant" || control.IdentityType != "group" || control.TableFilter != "" {
+				zap.S().Warnw("CAS access control cannot be represented by a DAP", "CASLIB", lib.Name, "type", control.Type, "identityType", control.IdentityType, "identity", control.Identity, "permission", control.Permission)
+				continue
+			}
+			var identity string = control.Identity
+			if identity == "*" {
+				identity = "authenticatedUsers"
+			}
+			if _, exists := permissions[identity]; !exists {
+				identities = append(identities, identity)
+			}
+			permissions[identity] = append(permissions[identity], control.Permission)
+		}
+		if len(identities) == 0 {
+			continue
+		}
+		var signature [][]string
+		for _, identity := range identities {
+			signature = append(signature, []string{identity, strings.Join(order(casPermissions, permissions[identity]), ",")})
+		}
+		sortRows(signature)
+		exported = append(exported, lib)
+		sets = append(sets, signature)
+	}
+	patterns, assigned := infer("dap", sets)
+	caslibs = [][]string{DAPCASLIBsSchema}
+	for i, lib := range exported {
+		caslibs = append(caslibs, []string{lib.Name, lib.Description, lib.Type, lib.Path, assigned[i]})
+	}
+	return append([][]string{DAPPatternSchema}, patterns...), caslibs, nil
+}
+
+// infer assigns a pattern to every rule set, reusing the pattern of identical rule sets. Empty rule sets are
+// not assigned a pattern
+func infer(prefix string, sets [][][]string) (patterns [][]string, assigned []string) {
+	known := make(map[string]string)
+	for _, set := range sets {
+		if len(set) == 0 {
+			assigned = append(assigned, "")
+			continue
+		}
+		var key []string
+		for _, row := range set {
+			key = append(key, strings.Join(row, "|"))
+		}
+		name, exists := known[strings.Join(key, "\n")]
+		if !exists {
+			name = fmt.Sprintf("%s%03d", prefix, len(known)+1)
+			known[strings.Join(key, "\n")] = name
+			for _, row := range set {
+				patterns = append(patterns, append([]string{name}, row...))
+			}
+		}
+		assigned = append(assigned, name)
+	}
+	return patterns, assigned
+}
+
+// exportable reports whether an authorization rule can be represented in the model
+func exportable(rule *au.Authorization, managedOnly bool) bool {
+	if managedOnly && !rule.Managed() {
+		return false
+	}
+	if (rule.Type != "grant" && rule.Type != "prohibit") || rule.Enabled == "false" {
+		zap.S().Debugw("Authorization rule cannot be represented in the model", "id", rule.IDs, "type", rule.Type, "enabled", rule.Enabled)
+		return false
+	}
+	if rule.Principal.Type != "group" && rule.Principal.Type != "authenticatedUsers" {
+		zap.S().Warnw("Authorization rule of principal type cannot be represented in the model", "id", rule.IDs, "principal", rule.Principal.ID, "principalType", rule.Principal.Type)
+		return false
+	}
+	return true
+}
+
+// options returns the rule columns of an authorization rule. Grants are the default and leave the Type column empty
+func options(rule *au.Authorization) []string {
+	var ruleType string = rule.Type
+	if ruleType == "grant" {
+		ruleType = ""
+	}
+	return []string{ruleType, rule.Condition, rule.MediaType, rule.ExpirationTimeStamp, rule.Reason}
+}
+
+// principal returns the principal column of an authorization rule
+func principal(rule *au.Authorization) string {
+	if rule.Principal.Type == "authenticatedUsers" {
+		return "authenticatedUsers"
+	}
+	return rule.Principal.ID
+}
+
+// order permissions as documented, followed by unknown permissions
+func order(documented, permissions []string) []string {
+	var ordered []string
+	for _, known := range documented {
+		for _, permission := range permissions {
+			if permission == known {
+				ordered = append(ordered, permission)
+				break
+			}
+		}
+	}
+	for _, permission := range permissions {
+		if !contains(documented, permission) && !contains(ordered, permission) {
+			ordered = append(ordered, permission)
+		}
+	}
+	return ordered
+}
+
+// contains reports whether a value is part of a list
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sortRows sorts rows by their columns
+func sortRows(rows [][]string) {
+	sort.Slice(rows, func(i, j int) bool {
+		return strings.Join(rows[i], "|") < strings.Join(rows[j], "|")
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package export
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+)
+
+func TestInfer(t *testing.T) {
+	sets := [][][]string{
+		{{"authenticatedUsers", "object", "read"}},
+		{{"authenticatedUsers", "object", "read"}, {"per007", "object", "read,update"}},
+		{},
+		{{"authenticatedUsers", "object", "read"}, {"per007", "object", "read,update"}},
+	}
+	patterns, assigned := infer("ipap", sets)
+	expected := [][]string{
+		{"ipap001", "authenticatedUsers", "object", "read"},
+		{"ipap002", "authenticatedUsers", "object", "read"},
+		{"ipap002", "per007", "object", "read,update"},
+	}
+	if !reflect.DeepEqual(patterns, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, patterns)
+	}
+	if !reflect.DeepEqual(assigned, []string{"ipap001", "ipap002", "", "ipap002"}) {
+		t.Errorf("Expected: %v, Returned: %v.", []string{"ipap001", "ipap002", "", "ipap002"}, assigned)
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(`{"count": 5, "items": [
+			{"id": "1", "principal": "per001", "principalType": "group", "type": "grant", "permissions": ["update", "read"], "objectUri": "/SASDrive/**", "enabled": true},
+			{"id": "2", "principalType": "authenticatedUsers", "type": "grant", "permissions": ["read"], "objectUri": "/SASDrive/**", "enabled": true},
+			{"id": "3", "principal": "per001", "principalType": "group", "type": "grant", "permissions": ["read"], "objectUri": "/folders/folders/1/**", "enabled": true},
+			{"id": "4", "principal": "per001", "principalType": "group", "type": "prohibit", "permissions": ["read"], "objectUri": "/SASVisualAnalytics/**", "enabled": true, "expirationTimestamp": "2021-12-31T23:59:59Z", "reason": "Contractor"},
+			{"id": "5", "principal": "per002", "principalType": "group", "type": "grant", "permissions": ["read"], "objectUri": "/SASDataExplorer/**", "enabled": false}
+		]}`))
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.Connected = true
+	returned, err := Matrix(co, false)
+	if err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	expected := [][]string{
+		MatrixSchema,
+		{"/SASDrive/**", "authenticatedUsers", "read", "", "", "", "", ""},
+		{"/SASDrive/**", "per001", "read,update", "", "", "", "", ""},
+		{"/SASVisualAnalytics/**", "per001", "read", "prohibit", "", "", "2021-12-31T23:59:59Z", "Contractor"},
+	}
+	if !reflect.DeepEqual(returned, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
+
+func TestCASLIBs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/casManagement/servers/default/caslibs":
+			rw.Write([]byte(`{"count": 3, "items": [
+				{"name": "testcas2", "description": "Test CAS 2", "type": "PATH", "path": "/cas/testcas2/", "scope": "global"},
+				{"name": "testcas1", "description": "Test CAS 1", "type": "PATH", "path": "/cas/testcas1/", "scope": "global"},
+				{"name": "CASUSER", "type": "PATH", "path": "/home/", "scope": "session"}
+			]}`))
+		default:
+			rw.Write([]byte(`{"count": 3, "items": [
+				{"identity": "per001", "identityType": "group", "permission": "select", "type": "grant"},
+				{"identity": "per001", "identityType": "group", "permission": "readInfo", "type": "grant"},
+				{"identity": "*", "identityType": "group", "permission": "readInfo", "type": "grant"}
+			]}`))
+		}
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.CASServer = "default"
+	co.CASSession = "testsession"
+	co.Connected = true
+	patterns, caslibs, err := CASLIBs(co)
+	if err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	expected := [][]string{
+		DAPPatternSchema,
+		{"dap001", "authenticatedUsers", "readInfo"},
+		{"dap001", "per001", "readInfo,select"},
+	}
+	if !reflect.DeepEqual(patterns, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, patterns)
+	}
+	expected = [][]string{
+		DAPCASLIBsSchema,
+		{"testcas1", "Test CAS 1", "PATH", "/cas/testcas1/", "dap001"},
+		{"testcas2", "Test CAS 2", "PATH", "/cas/testcas2/", "dap001"},
+	}
+	if !reflect.DeepEqual(caslibs, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, caslibs)
+	}
+}
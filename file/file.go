@@ -6,74 +6,399 @@ package file
 import (
 	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
 
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
 )
 
 // File object
 type File struct {
-	Path    string
-	Type    string
-	Schema  []string
-	Content interface{}
+	Path     string
+	Type     string
+	Sheet    string
+	Schema   []string
+	Optional []string
+	Content  interface{}
+	lines    []int
+	columns  []int
+}
+
+// clean removes all characters from a column name that are not letters or digits, e.g. a byte order mark
+var clean = regexp.MustCompile("[^a-zA-Z0-9]+")
+
+// Detect sets the type of a tabular file from the extension of its path. A worksheet of an Excel workbook other
+// than the first one is selected by appending #<sheet> to the path
+func (f *File) Detect() {
+	if i := strings.LastIndex(f.Path, "#"); i >= 0 && strings.EqualFold(filepath.Ext(f.Path[:i]), ".xlsx") {
+		f.Sheet = f.Path[i+1:]
+		f.Path = f.Path[:i]
+	}
+	switch strings.ToLower(filepath.Ext(f.Path)) {
+	case ".xlsx":
+		f.Type = "xlsx"
+	case ".yaml", ".yml":
+		f.Type = "yaml"
+	default:
+		f.Type = "csv"
+	}
 }
 
 // Read file
-func (f *File) Read() {
-	zap.S().Debugw("Reading file", "path", f.Path, "type", f.Type)
+func (f *File) Read() error {
+	zap.S().Debugw("Reading file", "path", f.Path, "type", f.Type, "sheet", f.Sheet)
 	switch f.Type {
 	case "csv":
-		f.readCSV()
+		return f.readCSV()
+	case "json":
+		return f.readJSON()
+	case "yaml":
+		return f.readYAML()
+	case "xlsx":
+		return f.readXLSX()
+	default:
+		return fmt.Errorf("unsupported file type %q for %s", f.Type, f.Path)
+	}
+}
+
+// Write file
+func (f *File) Write() error {
+	zap.S().Debugw("Writing file", "path", f.Path, "type", f.Type)
+	switch f.Type {
 	case "json":
-		f.readJSON()
+		return f.writeJSON()
+	case "csv":
+		return f.writeCSV()
 	default:
-		zap.S().Fatalw("Unsupported file type")
+		return fmt.Errorf("unsupported file type %q for %s", f.Type, f.Path)
+	}
+}
+
+// writeCSV replaces the CSV file with the content, whose first row needs to match the schema
+func (f *File) writeCSV() error {
+	rows, ok := f.Content.([][]string)
+	if !ok || len(rows) == 0 {
+		return fmt.Errorf("CSV file %s has no content", f.Path)
+	}
+	if !f.checkHeader() {
+		return fmt.Errorf("header row %v of %s does not match expected schema %v", rows[0], f.Path, f.Schema)
+	}
+	var mode os.FileMode = 0644
+	if info, err := os.Stat(f.Path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	osf, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+	w := csv.NewWriter(osf)
+	if err := w.WriteAll(rows); err != nil {
+		osf.Close()
+		return fmt.Errorf("marshalling CSV file %s: %w", f.Path, err)
+	}
+	if err := osf.Close(); err != nil {
+		return fmt.Errorf("writing file: %w", err)
 	}
+	return nil
+}
+
+// writeJSON replaces the JSON file with the content, keeping the permissions of an existing file
+func (f *File) writeJSON() error {
+	var mode os.FileMode = 0600
+	if info, err := os.Stat(f.Path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	body, err := json.MarshalIndent(f.Content, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling JSON file %s: %w", f.Path, err)
+	}
+	if err := ioutil.WriteFile(f.Path, append(body, '\n'), mode); err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+	return nil
 }
 
 // readJSON opens the JSON file and returns the content
-func (f *File) readJSON() {
+func (f *File) readJSON() error {
 	osf, err := os.OpenFile(f.Path, os.O_RDONLY, 0644)
 	if err != nil {
-		zap.S().Fatalw("Error when reading file", "error", err)
+		return fmt.Errorf("reading file: %w", err)
 	}
+	defer osf.Close()
 	err = json.NewDecoder(osf).Decode(&f.Content)
 	if err != nil {
-		zap.S().Fatalw("Error when unmarshalling JSON file", "error", err)
+		return fmt.Errorf("unmarshalling JSON file %s: %w", f.Path, err)
 	}
+	return nil
 }
 
-// readCSV opens the CSV file and returns the content
-func (f *File) readCSV() {
-	osf, err := os.OpenFile(f.Path, os.O_RDONLY, 0644)
+// readCSV opens the CSV file and returns the rows in the order of the schema. Blank lines and lines starting with
+// # are skipped
+func (f *File) readCSV() error {
+	body, err := ioutil.ReadFile(f.Path)
 	if err != nil {
-		zap.S().Fatalw("Error when reading file", "error", err)
+		return fmt.Errorf("reading file: %w", err)
+	}
+	var table [][]string
+	var lines []int
+	var record []string
+	var start, quotes int
+	for i, line := range strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n") {
+		if record == nil {
+			var trimmed string = strings.TrimSpace(strings.TrimPrefix(line, "\uFEFF"))
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			start = i + 1
+		}
+		record = append(record, line)
+		// a record continues on the next line as long as a quoted field is open
+		quotes += strings.Count(line, `"`)
+		if quotes%2 != 0 {
+			continue
+		}
+		fields, err := csv.NewReader(strings.NewReader(strings.Join(record, "\n"))).Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return fmt.Errorf("%s:%d:%d: %w", f.Path, start+parseErr.Line-1, parseErr.Column, parseErr.Err)
+			}
+			return fmt.Errorf("%s:%d: %w", f.Path, start, err)
+		}
+		// a row with missing or surplus fields is reported at its end instead of being padded or truncated
+		if len(table) > 0 && len(fields) != len(table[0]) {
+			return fmt.Errorf("%s:%d:%d: %w: expected %d as in the header row, found %d", f.Path, i+1, len(line)+1, csv.ErrFieldCount, len(table[0]), len(fields))
+		}
+		table = append(table, fields)
+		lines = append(lines, start)
+		record = nil
+		quotes = 0
+	}
+	if record != nil {
+		return fmt.Errorf("%s:%d: unterminated quoted field", f.Path, start)
+	}
+	if len(table) == 0 {
+		return fmt.Errorf("CSV file %s is empty", f.Path)
 	}
-	f.Content, err = csv.NewReader(osf).ReadAll()
+	return f.tabulate(table, lines)
+}
+
+// readYAML opens the YAML file, a list of rows keyed by column name, and returns the rows in the order of the schema.
+// Lists, e.g. of permissions, are joined by commas
+func (f *File) readYAML() error {
+	body, err := ioutil.ReadFile(f.Path)
 	if err != nil {
-		zap.S().Fatalw("Error when unmarshalling CSV file", "error", err)
+		return fmt.Errorf("reading file: %w", err)
 	}
-	if !f.checkHeader() {
-		zap.S().Fatalw("Header row does not match expected schema", "header", f.Content.([][]string)[0], "schema", f.Schema)
+	var records []yaml.MapSlice
+	if err := yaml.Unmarshal(body, &records); err != nil {
+		return fmt.Errorf("unmarshalling YAML file %s: %w", f.Path, err)
 	}
+	columns := make(map[string]int)
+	for i, column := range f.Schema {
+		columns[column] = i
+	}
+	unknown := make(map[string]bool)
+	var rows [][]string = [][]string{f.Schema}
+	f.columns = nil
+	f.lines = yamlLines(body, len(records))
+	for _, record := range records {
+		row := make([]string, len(f.Schema))
+		for _, item := range record {
+			var name string = clean.ReplaceAllString(fmt.Sprint(item.Key), "")
+			i, exists := columns[name]
+			if !exists {
+				if !unknown[name] {
+					zap.S().Warnw("Ignoring unknown column", "path", f.Path, "column", name)
+					unknown[name] = true
+				}
+				continue
+			}
+			row[i] = value(item.Value)
+		}
+		rows = append(rows, row)
+	}
+	f.Content = rows
+	return nil
+}
+
+// yamlLines returns the line of every row of a YAML list of rows, i.e. of the items of the top level sequence, after
+// the header row with the unknown line 0. The lines are unknown (nil) if they cannot be matched with the rows, e.g. for
+// a flow sequence
+func yamlLines(body []byte, rows int) []int {
+	var lines []int = []int{0}
+	var indent int = -1
+	for i, line := range strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n") {
+		var trimmed string = strings.TrimLeft(line, " ")
+		if trimmed != "-" && !strings.HasPrefix(trimmed, "- ") {
+			continue
+		}
+		if indent < 0 {
+			indent = len(line) - len(trimmed)
+		}
+		if len(line)-len(trimmed) == indent {
+			lines = append(lines, i+1)
+		}
+	}
+	if len(lines) != rows+1 {
+		return nil
+	}
+	return lines
+}
+
+// value renders a YAML value as the content of a column
+func value(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, value(item))
+		}
+		return strings.Join(values, ",")
+	default:
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+}
+
+// tabulate maps the columns of a table to the schema by header name, so that the columns can be in any order.
+// Optional columns may be missing and are then left empty, unknown columns are ignored. The source line of each row is
+// kept for error messages, lines may be nil if they are unknown
+func (f *File) tabulate(table [][]string, lines []int) error {
+	if len(table) == 0 {
+		return fmt.Errorf("file %s is empty", f.Path)
+	}
+	f.lines = lines
+	index := make(map[string]int)
+	for i, column := range table[0] {
+		var name string = clean.ReplaceAllString(column, "")
+		if _, exists := index[name]; !exists {
+			index[name] = i
+		}
+	}
+	optional := make(map[string]bool)
+	for _, column := range f.Optional {
+		optional[column] = true
+	}
+	f.columns = nil
+	for _, column := range f.Schema {
+		i, exists := index[column]
+		if !exists {
+			if !optional[column] {
+				return fmt.Errorf("%s: header row %v is missing column %s of expected schema %v", f.Position(0, -1), table[0], column, f.Schema)
+			}
+			i = -1
+		}
+		f.columns = append(f.columns, i)
+		delete(index, column)
+	}
+	for name := range index {
+		if name != "" {
+			zap.S().Warnw("Ignoring unknown column", "path", f.Path, "column", name)
+		}
+	}
+	var rows [][]string = [][]string{f.Schema}
+	for _, values := range table[1:] {
+		row := make([]string, len(f.columns))
+		for i, position := range f.columns {
+			if position >= 0 && position < len(values) {
+				row[i] = values[position]
+			}
+		}
+		rows = append(rows, row)
+	}
+	f.Content = rows
+	return nil
+}
+
+// Location of a row of tabular content, used to point error messages and diagnostics at the source line
+type Location struct {
+	Path    string
+	Row     int
+	Line    int
+	columns []int
+	start   int
+}
+
+// Located returns the location of a row that starts at a line and column, e.g. of an item of a YAML or JSON document
+// whose values are not in columns. All columns of the row are located at its start
+func Located(path string, line, column int) Location {
+	return Location{Path: path, Line: line, start: column}
+}
+
+// Location returns the location of a row of the content. Row 0 is the header row
+func (f *File) Location(row int) Location {
+	l := Location{Path: f.Path, Row: row, columns: f.columns}
+	if row < len(f.lines) {
+		l.Line = f.lines[row]
+	}
+	return l
+}
+
+// At returns the location of a schema column as path:line:column. A negative column omits the column, rows whose line
+// is unknown are given as path: row N
+func (l Location) At(column int) string {
+	switch {
+	case l.Line == 0 && l.Row == 0:
+		return l.Path
+	case l.Line == 0:
+		return fmt.Sprintf("%s: row %d", l.Path, l.Row)
+	case l.start > 0 && column >= 0:
+		return fmt.Sprintf("%s:%d:%d", l.Path, l.Line, l.start)
+	case column < 0 || column >= len(l.columns) || l.columns[column] < 0:
+		return fmt.Sprintf("%s:%d", l.Path, l.Line)
+	default:
+		return fmt.Sprintf("%s:%d:%d", l.Path, l.Line, l.columns[column]+1)
+	}
+}
+
+// String returns the location of the row as path:line
+func (l Location) String() string {
+	return l.At(-1)
+}
+
+// Position returns the location of a schema column in a row of the content as path:line:column for error messages.
+// Row 0 is the header row, a negative column omits the column
+func (f *File) Position(row, column int) string {
+	return f.Location(row).At(column)
+}
+
+// Records returns the rows of tabular content keyed by column name
+func (f *File) Records() []map[string]string {
+	rows, ok := f.Content.([][]string)
+	if !ok || len(rows) == 0 {
+		return nil
+	}
+	var header []string
+	for _, column := range rows[0] {
+		header = append(header, clean.ReplaceAllString(column, ""))
+	}
+	var records []map[string]string
+	for _, row := range rows[1:] {
+		record := make(map[string]string)
+		for i, column := range header {
+			if i < len(row) {
+				record[column] = row[i]
+			}
+		}
+		records = append(records, record)
+	}
+	return records
 }
 
 // checkHeader validates the file header against the provided schema
 func (f *File) checkHeader() bool {
 	var header []string
 	for _, col := range f.Content.([][]string)[0] {
-		clean, err := regexp.Compile("[^a-zA-Z0-9]+")
-		if err != nil {
-			zap.S().Errorw("Error compiling regular expression", "error", err)
-		}
 		header = append(header, clean.ReplaceAllString(col, ""))
 	}
-	if reflect.DeepEqual(header, f.Schema) {
-		return true
-	} else {
-		return false
-	}
+	return reflect.DeepEqual(header, f.Schema)
 }
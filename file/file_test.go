@@ -4,9 +4,13 @@
 package file
 
 import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -58,3 +62,191 @@ func TestReadCSV(t *testing.T) {
 	}
 	os.Remove("test.csv")
 }
+
+func TestReadErrors(t *testing.T) {
+	ioutil.WriteFile("test.csv", []byte("Col1,Col3\r\nTest1,Test2\r\n"), 0644)
+	var TestCases = []struct {
+		Name string
+		Path string
+		Type string
+	}{
+		{"Unsupported", "test.csv", "xml"},
+		{"Missing", "missing.csv", "csv"},
+		{"Header", "test.csv", "csv"},
+	}
+	for _, test := range TestCases {
+		t.Run(test.Name, func(t *testing.T) {
+			f := new(File)
+			f.Path = test.Path
+			f.Type = test.Type
+			f.Schema = []string{"Col1", "Col2"}
+			if err := f.Read(); err == nil {
+				t.Errorf("Expected an error when reading %s as %s.", test.Path, test.Type)
+			}
+		})
+	}
+	os.Remove("test.csv")
+}
+
+func TestWriteJSON(t *testing.T) {
+	f := new(File)
+	f.Path = "test.json"
+	f.Type = "json"
+	f.Content = map[string]interface{}{"Default": map[string]interface{}{"access-token": "testaccesstoken"}}
+	if err := f.Write(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	r := new(File)
+	r.Path = "test.json"
+	r.Type = "json"
+	r.Read()
+	if !reflect.DeepEqual(r.Content, f.Content) {
+		t.Errorf("Expected: %v, Returned: %v.", f.Content, r.Content)
+	}
+	os.Remove("test.json")
+}
+
+func TestWriteCSV(t *testing.T) {
+	f := new(File)
+	f.Path = "test.csv"
+	f.Type = "csv"
+	f.Schema = []string{"URI", "Principal", "Permissions"}
+	f.Content = [][]string{{"URI", "Principal", "Permissions"}, {"/SASDrive/**", "per001", "read,update"}}
+	if err := f.Write(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	r := new(File)
+	r.Path = "test.csv"
+	r.Type = "csv"
+	r.Schema = f.Schema
+	r.Read()
+	if !reflect.DeepEqual(r.Content, f.Content) {
+		t.Errorf("Expected: %v, Returned: %v.", f.Content, r.Content)
+	}
+	f.Content = [][]string{{"URI", "Principal"}}
+	if err := f.Write(); err == nil {
+		t.Errorf("Expected: %v, Returned: %v.", "error", err)
+	}
+	os.Remove("test.csv")
+}
+
+func TestReadYAML(t *testing.T) {
+	write := []byte("- Principal: per001\n  URI: /SASDrive/**\n  Permissions: [read, update]\n  Owner: Security\n- URI: /SASVisualAnalytics/**\n  Principal: authenticatedUsers\n  Permissions: read\n")
+	ioutil.WriteFile("test.yaml", write, 0644)
+	f := new(File)
+	f.Path = "test.yaml"
+	f.Schema = []string{"URI", "Principal", "Permissions"}
+	f.Detect()
+	if err := f.Read(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	expected := [][]string{
+		{"URI", "Principal", "Permissions"},
+		{"/SASDrive/**", "per001", "read,update"},
+		{"/SASVisualAnalytics/**", "authenticatedUsers", "read"},
+	}
+	if !reflect.DeepEqual(f.Content, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, f.Content)
+	}
+	if location := f.Location(2).String(); location != "test.yaml:5" {
+		t.Errorf("Expected: %v, Returned: %v.", "test.yaml:5", location)
+	}
+	os.Remove("test.yaml")
+}
+
+func TestReadCSVFieldCount(t *testing.T) {
+	ioutil.WriteFile("test.csv", []byte("Col1,Col2,Col3\n# comment\nTest1,Test2,Test3\nTest4,Test5\n"), 0644)
+	defer os.Remove("test.csv")
+	f := new(File)
+	f.Path = "test.csv"
+	f.Type = "csv"
+	f.Schema = []string{"Col1", "Col2", "Col3"}
+	err := f.Read()
+	if !errors.Is(err, csv.ErrFieldCount) || !strings.HasPrefix(err.Error(), "test.csv:4:12: ") {
+		t.Errorf("Expected: %v, Returned: %v.", "test.csv:4:12: wrong number of fields", err)
+	}
+}
+
+// writeXLSX writes a minimal Excel workbook with a shared string, an inline string and a second worksheet
+func writeXLSX(path string) error {
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="Notes" sheetId="1" r:id="rId1"/><sheet name="Matrix" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+			<si><t>` + "\uFEFF" + `Permissions</t></si><si><t>URI</t></si><si><r><t>per</t></r><r><t>001</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+			<row r="1"><c r="A1" t="inlineStr"><is><t>Notes</t></is></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><t>Principal</t></is></c><c r="D1" t="s"><v>1</v></c></row>
+			<row r="2"><c r="A2" t="inlineStr"><is><t>read</t></is></c><c r="B2" t="s"><v>2</v></c><c r="D2" t="inlineStr"><is><t>/SASDrive/**</t></is></c></row>
+			<row r="4"><c r="A4" t="inlineStr"><is><t> </t></is></c></row></sheetData></worksheet>`,
+	}
+	osf, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := zip.NewWriter(osf)
+	for name, content := range parts {
+		part, err := w.Create(name)
+		if err != nil {
+			return err
+		}
+		part.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return osf.Close()
+}
+
+func TestReadXLSX(t *testing.T) {
+	if err := writeXLSX("test.xlsx"); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	defer os.Remove("test.xlsx")
+	f := new(File)
+	f.Path = "test.xlsx#Matrix"
+	f.Schema = []string{"URI", "Principal", "Permissions"}
+	f.Detect()
+	if err := f.Read(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	expected := [][]string{
+		{"URI", "Principal", "Permissions"},
+		{"/SASDrive/**", "per001", "read"},
+	}
+	if !reflect.DeepEqual(f.Content, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, f.Content)
+	}
+	records := f.Records()
+	if len(records) != 1 || records[0]["Principal"] != "per001" {
+		t.Errorf("Expected: %v, Returned: %v.", "per001", records)
+	}
+	f.Path = "test.xlsx"
+	f.Sheet = ""
+	if err := f.Read(); err == nil {
+		t.Errorf("Expected: %v, Returned: %v.", "missing column error", err)
+	}
+}
+
+func TestColumnIndex(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected int
+	}{
+		{"A1", 0},
+		{"d2", 3},
+		{"AB12", 27},
+		{"XFD1", 16383},
+		{"XFE1", -1},
+		{"12", -1},
+		{"", -1},
+	}
+	for _, test := range tests {
+		if returned := columnIndex(test.in); returned != test.expected {
+			t.Errorf("Expected: %v, Returned: %v (%s).", test.expected, returned, test.in)
+		}
+	}
+}
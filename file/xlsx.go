@@ -0,0 +1,190 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// maxColumns of an Excel worksheet, i.e. the columns A to XFD
+const maxColumns = 16384
+
+// Parts of an Office Open XML workbook needed to read the cell values of a worksheet
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Ref   int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// text concatenates the plain text and the rich text runs of a cell
+func (t xlsxText) text() string {
+	var b strings.Builder
+	b.WriteString(t.T)
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+// readXLSX opens the Excel workbook and returns the cell values of the selected or first worksheet as rows
+func (f *File) readXLSX() error {
+	r, err := zip.OpenReader(f.Path)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+	defer r.Close()
+	parts := make(map[string]*zip.File)
+	for _, part := range r.File {
+		parts[part.Name] = part
+	}
+	var workbook xlsxWorkbook
+	if err := decodePart(parts, "xl/workbook.xml", &workbook); err != nil {
+		return fmt.Errorf("unmarshalling Excel file %s: %w", f.Path, err)
+	}
+	var relationships xlsxRelationships
+	if err := decodePart(parts, "xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return fmt.Errorf("unmarshalling Excel file %s: %w", f.Path, err)
+	}
+	var id string
+	for _, sheet := range workbook.Sheets {
+		if f.Sheet == "" || sheet.Name == f.Sheet {
+			id = sheet.ID
+			break
+		}
+	}
+	if id == "" {
+		return fmt.Errorf("Excel file %s has no worksheet %q", f.Path, f.Sheet)
+	}
+	var target string
+	for _, relationship := range relationships.Relationships {
+		if relationship.ID == id {
+			target = relationship.Target
+		}
+	}
+	// targets are relative to the workbook part unless they are absolute within the package
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+	var shared xlsxSharedStrings
+	if _, exists := parts["xl/sharedStrings.xml"]; exists {
+		if err := decodePart(parts, "xl/sharedStrings.xml", &shared); err != nil {
+			return fmt.Errorf("unmarshalling Excel file %s: %w", f.Path, err)
+		}
+	}
+	var worksheet xlsxWorksheet
+	if err := decodePart(parts, target, &worksheet); err != nil {
+		return fmt.Errorf("unmarshalling Excel file %s: %w", f.Path, err)
+	}
+	var table [][]string
+	var lines []int
+	for i, row := range worksheet.Rows {
+		var values []string
+		var empty bool = true
+		for j, cell := range row.Cells {
+			var column int = j
+			if cell.Ref != "" {
+				column = columnIndex(cell.Ref)
+			}
+			if column < 0 {
+				return fmt.Errorf("Excel file %s has an invalid cell reference %q", f.Path, cell.Ref)
+			}
+			for len(values) <= column {
+				values = append(values, "")
+			}
+			var value string
+			switch cell.Type {
+			case "s":
+				var index int
+				if _, err := fmt.Sscan(cell.Value, &index); err != nil || index < 0 || index >= len(shared.Items) {
+					return fmt.Errorf("Excel file %s refers to an unknown shared string in cell %s", f.Path, cell.Ref)
+				}
+				value = shared.Items[index].text()
+			case "inlineStr":
+				value = cell.Inline.text()
+			default:
+				value = cell.Value
+			}
+			values[column] = strings.TrimSpace(value)
+			if values[column] != "" {
+				empty = false
+			}
+		}
+		if !empty {
+			table = append(table, values)
+			if row.Ref > 0 {
+				lines = append(lines, row.Ref)
+			} else {
+				lines = append(lines, i+1)
+			}
+		}
+	}
+	return f.tabulate(table, lines)
+}
+
+// decodePart unmarshals an XML part of the workbook package
+func decodePart(parts map[string]*zip.File, name string, v interface{}) error {
+	part, exists := parts[name]
+	if !exists {
+		return fmt.Errorf("missing part %s", name)
+	}
+	r, err := part.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// columnIndex returns the zero based column of a cell reference such as AB12, or -1 if the reference does not start
+// with a column within the XFD limit of Excel
+func columnIndex(ref string) int {
+	var column int
+	for _, c := range strings.ToUpper(ref) {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		column = column*26 + int(c-'A') + 1
+		if column > maxColumns {
+			return -1
+		}
+	}
+	return column - 1
+}
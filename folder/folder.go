@@ -4,14 +4,24 @@
 package folder
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 
 	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
-	"github.com/spf13/viper"
+	jo "github.com/sassoftware/sas-viya-authorization-model/journal"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
 	"go.uber.org/zap"
 )
 
+// ErrParentMissing is returned when a nested folder is created before its parent folder
+var ErrParentMissing = errors.New("parent folder must exist first")
+
+// ErrFolderMissing is returned when an operation requires an existing folder
+var ErrFolderMissing = errors.New("folder does not exist")
+
 // Folder object
 type Folder struct {
 	Path          string
@@ -23,91 +33,284 @@ type Folder struct {
 }
 
 // Validate whether a SAS Viya custom folder exists
-func (f *Folder) Validate() {
+func (f *Folder) Validate() error {
 	zap.S().Debugw("Validating custom folder", "path", f.Path)
-	search, status := f.Connection.Call("GET", "/folders/folders/@item", "", "", [][]string{
+	search, _, err := f.Connection.Call("GET", "/folders/folders/@item", "", "", [][]string{
 		0: {
 			"path",
 			f.Path,
 		},
 		1: {
 			"limit",
-			viper.GetString("responselimit"),
+			f.Connection.ResponseLimit(),
 		},
 	}, nil)
-	if status == 404 {
+	if co.IsStatus(err, 404) {
 		zap.S().Debugw("Custom folder does not exist", "path", f.Path)
 		f.Exists = false
-	} else {
-		zap.S().Debugw("Custom folder exists", "path", f.Path)
-		f.Exists = true
-		f.URI = "/folders/folders/" + search.(map[string]interface{})["id"].(string)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("validating custom folder %s: %w", f.Path, err)
 	}
+	result, _ := search.(map[string]interface{})
+	id, ok := result["id"].(string)
+	if !ok {
+		return fmt.Errorf("validating custom folder %s: %w", f.Path, co.ErrUnexpectedResponse)
+	}
+	zap.S().Debugw("Custom folder exists", "path", f.Path)
+	f.Exists = true
+	f.URI = "/folders/folders/" + id
+	return nil
+}
+
+// ResolveParent looks up the parent of a nested folder without a known parent, e.g. as the parent is not part of the
+// model. A parent that does not exist is left unknown
+func (f *Folder) ResolveParent() error {
+	var pathElements []string = strings.Split(f.Path, "/")
+	if f.Parent != nil || len(pathElements) < 3 {
+		return nil
+	}
+	parent := &Folder{Path: strings.Join(pathElements[:len(pathElements)-1], "/"), Connection: f.Connection}
+	if err := parent.Validate(); err != nil {
+		return err
+	}
+	if parent.Exists {
+		f.Parent = parent
+	}
+	return nil
 }
 
 // Create a SAS Viya custom folder if it does not already exist and nest if required
-func (f *Folder) Create() {
+func (f *Folder) Create() error {
 	if (!f.Exists) && (f.URI == "") {
 		zap.S().Infow("Creating custom folder as it does not exist", "path", f.Path)
 		var pathElements []string = strings.Split(f.Path, "/")
 		var folderName string = pathElements[len(pathElements)-1]
-		var response interface{}
-		if len(pathElements) < 3 {
-			response, _ = f.Connection.Call("POST", "/folders/folders", "", "", [][]string{
-				0: {
-					"parentFolderUri",
-					"none",
-				},
-				1: {
-					"limit",
-					viper.GetString("responselimit"),
-				}}, []byte(`{"name": "`+folderName+`", "type": "folder"}`))
-			f.Exists = true
-		} else if f.Parent != nil {
-			response, _ = f.Connection.Call("POST", "/folders/folders", "", "", [][]string{
-				0: {
-					"parentFolderUri",
-					f.Parent.URI,
-				},
-				1: {
-					"limit",
-					viper.GetString("responselimit"),
-				}}, []byte(`{"name": "`+folderName+`", "type": "folder"}`))
+		var parentURI string = "none"
+		if len(pathElements) >= 3 {
+			if f.Parent == nil || f.Parent.URI == "" {
+				return fmt.Errorf("creating custom folder %s: %w", f.Path, ErrParentMissing)
+			}
+			parentURI = f.Parent.URI
+		}
+		if f.Connection.Plan != nil {
+			f.Connection.Plan.Add("create", "folder", f.Path, nil)
 			f.Exists = true
-		} else {
-			zap.S().Errorw("Parent folder must exist first", "path", f.Path)
+			f.URI = pl.PendingURI("/folders/folders", f.Path)
+			return nil
 		}
-		if response != nil {
-			f.URI = "/folders/folders/" + response.(map[string]interface{})["id"].(string)
+		response, _, err := f.Connection.Call("POST", "/folders/folders", "", "", [][]string{
+			0: {
+				"parentFolderUri",
+				parentURI,
+			},
+			1: {
+				"limit",
+				f.Connection.ResponseLimit(),
+			}}, body(folderName))
+		if err != nil {
+			return fmt.Errorf("creating custom folder %s: %w", f.Path, err)
 		}
+		f.Exists = true
+		result, _ := response.(map[string]interface{})
+		id, ok := result["id"].(string)
+		if !ok {
+			return fmt.Errorf("creating custom folder %s: %w", f.Path, co.ErrUnexpectedResponse)
+		}
+		f.URI = "/folders/folders/" + id
+		return f.Connection.Record("create", "folder", f.Path, &jo.Request{Action: "delete", Method: "DELETE", Path: f.URI})
 	} else {
 		zap.S().Debugw("Cannot create custom folder as it already exists", "path", f.Path)
 	}
+	return nil
 }
 
 // Delete a SAS Viya custom folder if it exists
-func (f *Folder) Delete() {
+func (f *Folder) Delete() error {
 	if (f.Exists) && (f.URI != "") {
 		zap.S().Infow("Deleting custom folder", "path", f.Path, "uri", f.URI)
-		f.Connection.Call("DELETE", f.URI, "", "", nil, nil)
+		if f.Connection.Plan != nil {
+			f.Connection.Plan.Add("delete", "folder", f.Path, map[string]interface{}{"uri": f.URI})
+		} else if _, _, err := f.Connection.Call("DELETE", f.URI, "", "", nil, nil); err != nil {
+			return fmt.Errorf("deleting custom folder %s: %w", f.Path, err)
+		} else if err := f.Connection.Record("delete", "folder", f.Path, f.recreate()); err != nil {
+			return err
+		}
 		f.Exists = false
 	} else {
 		zap.S().Debugw("Cannot delete custom folder as it does not exist", "path", f.Path)
 	}
+	return nil
 }
 
 // DeleteRecursive recursively deletes a SAS Viya custom folder path if it exists
-func (f *Folder) DeleteRecursive() {
+func (f *Folder) DeleteRecursive() error {
 	if (f.Exists) && (f.URI != "") {
 		zap.S().Infow("Recursively deleting custom folder", "path", f.Path, "uri", f.URI)
-		f.Connection.Call("DELETE", f.URI, "", "", [][]string{
+		if f.Connection.Plan != nil {
+			f.Connection.Plan.Add("delete", "folder", f.Path, map[string]interface{}{"uri": f.URI, "recursive": true})
+		} else if _, _, err := f.Connection.Call("DELETE", f.URI, "", "", [][]string{
 			0: {
 				"recursive",
 				"true",
 			},
-		}, nil)
+		}, nil); err != nil {
+			return fmt.Errorf("recursively deleting custom folder %s: %w", f.Path, err)
+		} else if err := f.Connection.Record("delete", "folder", f.Path, nil); err != nil {
+			return err
+		}
 		f.Exists = false
 	} else {
 		zap.S().Debugw("Cannot recursively delete custom folder as it does not exist", "path", f.Path)
 	}
+	return nil
+}
+
+// Roots returns all SAS Viya root folders
+func Roots(connection *co.Connection) ([]*Folder, error) {
+	zap.S().Debugw("Listing root folders")
+	items := connection.Collection("/folders/rootFolders", [][]string{
+		0: {
+			"limit",
+			connection.ResponseLimit(),
+		},
+	})
+	var roots []*Folder
+	for items.Next() {
+		id, _ := items.Item()["id"].(string)
+		name, _ := items.Item()["name"].(string)
+		if id == "" || name == "" {
+			return nil, fmt.Errorf("listing root folders: %w", co.ErrUnexpectedResponse)
+		}
+		roots = append(roots, &Folder{
+			Path:       "/" + name,
+			URI:        "/folders/folders/" + id,
+			Exists:     true,
+			Connection: connection,
+		})
+	}
+	if err := items.Err(); err != nil {
+		return nil, fmt.Errorf("listing root folders: %w", err)
+	}
+	return roots, nil
+}
+
+// Ancestors returns the folders containing a SAS Viya object or folder URI, the nearest first. An object that is not
+// a member of a folder has no ancestors
+func Ancestors(connection *co.Connection, uri string) ([]*Folder, error) {
+	zap.S().Debugw("Listing ancestor folders", "uri", uri)
+	response, _, err := connection.Call("GET", "/folders/ancestors", "", "", [][]string{
+		0: {
+			"childUri",
+			uri,
+		},
+	}, nil)
+	if co.IsStatus(err, 404) {
+		zap.S().Debugw("Object is not a member of a folder", "uri", uri)
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("listing ancestor folders of %s: %w", uri, err)
+	}
+	result, _ := response.(map[string]interface{})
+	items, ok := result["ancestors"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("listing ancestor folders of %s: %w", uri, co.ErrUnexpectedResponse)
+	}
+	var ancestors []*Folder
+	var names []string
+	for _, item := range items {
+		m, _ := item.(map[string]interface{})
+		id, _ := m["id"].(string)
+		name, _ := m["name"].(string)
+		if id == "" || name == "" {
+			return nil, fmt.Errorf("listing ancestor folders of %s: %w", uri, co.ErrUnexpectedResponse)
+		}
+		names = append(names, name)
+		ancestors = append(ancestors, &Folder{
+			URI:        "/folders/folders/" + id,
+			Exists:     true,
+			Connection: connection,
+		})
+	}
+	// the path of each ancestor consists of the names of the ancestors further up
+	for i, ancestor := range ancestors {
+		for _, name := range names[i:] {
+			ancestor.Path = "/" + name + ancestor.Path
+		}
+		if i+1 < len(ancestors) {
+			ancestor.Parent = ancestors[i+1]
+		}
+	}
+	return ancestors, nil
+}
+
+// Children returns the direct subfolders of a SAS Viya folder
+func (f *Folder) Children() ([]*Folder, error) {
+	zap.S().Debugw("Listing subfolders", "path", f.Path)
+	items := f.Connection.Collection(f.URI+"/members", [][]string{
+		0: {
+			"filter",
+			"eq(contentType,'folder')",
+		},
+		1: {
+			"limit",
+			f.Connection.ResponseLimit(),
+		},
+	})
+	var children []*Folder
+	for items.Next() {
+		uri, _ := items.Item()["uri"].(string)
+		name, _ := items.Item()["name"].(string)
+		if uri == "" || name == "" {
+			return nil, fmt.Errorf("listing subfolders of %s: %w", f.Path, co.ErrUnexpectedResponse)
+		}
+		children = append(children, &Folder{
+			Path:       f.Path + "/" + name,
+			URI:        uri,
+			Parent:     f,
+			Exists:     true,
+			Connection: f.Connection,
+		})
+	}
+	if err := items.Err(); err != nil {
+		return nil, fmt.Errorf("listing subfolders of %s: %w", f.Path, err)
+	}
+	return children, nil
+}
+
+// GetAuthorization reads the conveyed and object authorization rules of a SAS Viya folder
+func (f *Folder) GetAuthorization() error {
+	rules, err := au.List(f.Connection, "or(eq(containerUri,'"+f.URI+"'),eq(objectUri,'"+f.URI+"/**'))")
+	if err != nil {
+		return fmt.Errorf("reading authorization rules of %s: %w", f.Path, err)
+	}
+	f.Authorization = rules
+	return nil
+}
+
+// recreate returns the request creating a deleted folder again in its parent folder. Its content and authorization
+// rules are not restored. Without a known parent the folder cannot be created again
+func (f *Folder) recreate() *jo.Request {
+	var pathElements []string = strings.Split(f.Path, "/")
+	var parentURI string = "none"
+	if len(pathElements) >= 3 {
+		if f.Parent == nil || f.Parent.URI == "" {
+			return nil
+		}
+		parentURI = f.Parent.URI
+	}
+	return &jo.Request{
+		Action:   "create",
+		Method:   "POST",
+		Path:     "/folders/folders",
+		Query:    [][]string{{"parentFolderUri", parentURI}},
+		Body:     body(pathElements[len(pathElements)-1]),
+		Replaces: strings.TrimPrefix(f.URI, "/folders/folders/"),
+	}
+}
+
+// body returns a folder of the given name as sent to SAS Viya when it is created
+func body(name string) []byte {
+	body, _ := json.Marshal(map[string]string{"name": name, "type": "folder"})
+	return body
 }
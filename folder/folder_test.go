@@ -4,6 +4,7 @@
 package folder
 
 import (
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -73,21 +74,21 @@ func TestDeleteRecursive(t *testing.T) {
 func TestCreate(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		defer req.Body.Close()
-		if req.URL.String() == "/folders/folders?limit=&parentFolderUri=none" {
+		if req.URL.String() == "/folders/folders?limit=1000&parentFolderUri=none" {
 			body, err := ioutil.ReadAll(req.Body)
 			if err != nil {
 				t.Errorf("Failed reading request body: %s.", err)
 			}
-			expected := `{"name": "testfolder", "type": "folder"}`
+			expected := `{"name":"testfolder","type":"folder"}`
 			if string(body) != expected {
 				t.Errorf("res.Body = %q; want %q", string(body), expected)
 			}
-		} else if req.URL.String() == "/folders/folders?limit=&parentFolderUri=testuri" {
+		} else if req.URL.String() == "/folders/folders?limit=1000&parentFolderUri=testuri" {
 			body, err := ioutil.ReadAll(req.Body)
 			if err != nil {
 				t.Errorf("Failed reading request body: %s.", err)
 			}
-			expected := `{"name": "subfolder", "type": "folder"}`
+			expected := `{"name":"subfolder","type":"folder"}`
 			if string(body) != expected {
 				t.Errorf("res.Body = %q; want %q", string(body), expected)
 			}
@@ -118,3 +119,34 @@ func TestCreate(t *testing.T) {
 		t.Errorf("URI = %q; want %q", fo2.URI, "/folders/folders/testid")
 	}
 }
+
+func TestValidateNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusNotFound)
+		rw.Write([]byte(`{"errorCode": 11500, "message": "The folder was not found.", "httpStatusCode": 404}`))
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.Connected = true
+	fo := new(Folder)
+	fo.Connection = co
+	fo.Path = "/testfolder"
+	if err := fo.Validate(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if fo.Exists {
+		t.Errorf("Expected: %v, Returned: %v.", false, fo.Exists)
+	}
+}
+
+func TestCreateParentMissing(t *testing.T) {
+	fo := new(Folder)
+	fo.Connection = new(co.Connection)
+	fo.Path = "/testfolder/subfolder"
+	if err := fo.Create(); !errors.Is(err, ErrParentMissing) {
+		t.Errorf("Expected: %v, Returned: %v.", ErrParentMissing, err)
+	}
+}
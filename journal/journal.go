@@ -0,0 +1,130 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Request is a SAS Viya REST API request reverting a change. Requests to CAS management need the CAS session of the
+// connection rolling back the change, updates may need the current ETag of the resource. A request creating a deleted
+// resource again names the ID it replaces, as the resource gets a new ID that the requests reverting earlier changes
+// of the resource need to use instead
+type Request struct {
+	Action      string          `json:"action"`
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	ContentType string          `json:"contentType,omitempty"`
+	Query       [][]string      `json:"query,omitempty"`
+	Session     bool            `json:"session,omitempty"`
+	IfMatch     bool            `json:"ifMatch,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	Replaces    string          `json:"replaces,omitempty"`
+}
+
+// Entry records a change made to SAS Viya together with how to revert it: either a request, or the state of the
+// resource before the change for changes that cannot be reverted by a single request. An entry with neither cannot be
+// reverted
+type Entry struct {
+	Time     time.Time       `json:"time"`
+	Action   string          `json:"action"`
+	Resource string          `json:"resource"`
+	Target   string          `json:"target"`
+	Inverse  *Request        `json:"inverse,omitempty"`
+	State    json.RawMessage `json:"state,omitempty"`
+}
+
+// Journal records the changes of a run as JSON lines, so that the run can be rolled back even if it stopped halfway.
+// The file is only created with the first change and every entry is synced to disk before the next change is made
+type Journal struct {
+	Path  string
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// Record a change with the request reverting it. A nil request records a change that cannot be reverted
+func (j *Journal) Record(action, resource, target string, inverse *Request) error {
+	return j.write(Entry{Time: time.Now(), Action: action, Resource: resource, Target: target, Inverse: inverse})
+}
+
+// RecordState records a change that is reverted by restoring the state of the resource before the change
+func (j *Journal) RecordState(action, resource, target string, state interface{}) error {
+	body, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encoding journal entry for %s %s: %w", resource, target, err)
+	}
+	return j.write(Entry{Time: time.Now(), Action: action, Resource: resource, Target: target, State: body})
+}
+
+// Close the journal file
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// write appends an entry to the journal file, creating it if required
+func (j *Journal) write(e Entry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.file == nil {
+		f, err := os.OpenFile(j.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("opening journal %s: %w", j.Path, err)
+		}
+		zap.S().Infow("Recording changes in journal", "path", j.Path)
+		j.file = f
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding journal entry for %s %s: %w", e.Resource, e.Target, err)
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing journal %s: %w", j.Path, err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("writing journal %s: %w", j.Path, err)
+	}
+	return nil
+}
+
+// Read the entries of a journal file in the order the changes were made. Unreadable lines, e.g. a truncated last line
+// of a run that was killed while writing it, are skipped
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			zap.S().Warnw("Skipping unreadable journal entry", "path", path, "line", line, "error", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading journal %s: %w", path, err)
+	}
+	return entries, nil
+}
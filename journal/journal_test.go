@@ -0,0 +1,51 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package journal
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	j := &Journal{Path: "test.journal"}
+	defer os.Remove("test.journal")
+	if _, err := os.Stat("test.journal"); !os.IsNotExist(err) {
+		t.Errorf("Expected: %v, Returned: %v.", "no journal before the first change", err)
+	}
+	if err := j.Record("create", "group", "HR", &Request{Action: "delete", Method: "DELETE", Path: "/identities/groups/HR"}); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if err := j.RecordState("replace", "accessControls", "HRDATA", []map[string]string{{"identity": "HR", "permission": "select"}}); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if err := j.Record("delete", "folder", "/Projects/HR", nil); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	// a run killed while writing leaves a truncated last line
+	f, _ := os.OpenFile("test.journal", os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString(`{"time":"2021-06-01T00:00:00Z","action":"cre`)
+	f.Close()
+	entries, err := Read("test.journal")
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected: %v, Returned: %v.", 3, len(entries))
+	}
+	expected := &Request{Action: "delete", Method: "DELETE", Path: "/identities/groups/HR"}
+	if !reflect.DeepEqual(expected, entries[0].Inverse) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, entries[0].Inverse)
+	}
+	if string(entries[1].State) != `[{"identity":"HR","permission":"select"}]` {
+		t.Errorf("Expected: %v, Returned: %v.", `[{"identity":"HR","permission":"select"}]`, string(entries[1].State))
+	}
+	if entries[2].Inverse != nil || entries[2].State != nil {
+		t.Errorf("Expected: %v, Returned: %v.", "irreversible change", entries[2])
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	fi "github.com/sassoftware/sas-viya-authorization-model/file"
+)
+
+// Severities of diagnostics
+const (
+	Error   = "error"
+	Warning = "warning"
+)
+
+// Diagnostic is a problem found in a row of a model file
+type Diagnostic struct {
+	Location fi.Location
+	Column   int
+	Severity string
+	Message  string
+}
+
+// Error returns the diagnostic as path:line:column: message
+func (d Diagnostic) Error() string {
+	return d.Location.At(d.Column) + ": " + d.Message
+}
+
+// String returns the diagnostic as path:line:column: severity: message
+func (d Diagnostic) String() string {
+	return d.Location.At(d.Column) + ": " + d.Severity + ": " + d.Message
+}
+
+// Files are the rows of the model files that are checked together
+type Files struct {
+	Groups       []GroupRow
+	Matrix       []CapabilityRow
+	IPAPPatterns []IPAPRow
+	IPAPFolders  []FolderRow
+	DAPPatterns  []DAPRow
+	DAPCASLIBs   []CASLIBRow
+}
+
+// Check the model files offline for references to undefined patterns, unknown permissions, duplicate rows, folders
+// whose parent folder is not created first and group nesting cycles. Unlisted folder parents are warnings, as they
+// can exist in SAS Viya, e.g. /Projects
+func Check(files Files, createFolders bool) []Diagnostic {
+	c := new(table)
+	c.checkGroups(files.Groups)
+	seen := make(map[string]fi.Location)
+	for _, r := range files.Matrix {
+		c.checkPermissions(r.Location, 2, r.Permissions, RulePermissions, CASPermissions, "an authorization rule", "a CAS access control")
+		if r.URI != "" {
+			c.checkDuplicate(seen, r.URI+"\x00"+r.Principal+"\x00"+r.RuleType(), r.Location, 0, "%s of URI %s and principal %s", r.RuleType(), r.URI, r.Principal)
+		}
+	}
+	ipapPatterns := make(map[string]bool)
+	seen = make(map[string]fi.Location)
+	for _, r := range files.IPAPPatterns {
+		ipapPatterns[r.Pattern] = true
+		c.checkPermissions(r.Location, 3, r.Permissions, RulePermissions, CASPermissions, "an authorization rule", "a CAS access control")
+		c.checkDuplicate(seen, r.Pattern+"\x00"+r.Principal+"\x00"+r.GrantType+"\x00"+r.RuleType(), r.Location, 1, "%s of pattern %s, principal %s and grant type %s", r.RuleType(), r.Pattern, r.Principal, r.GrantType)
+	}
+	c.checkFolders(files.IPAPFolders, ipapPatterns, createFolders)
+	dapPatterns := make(map[string]bool)
+	seen = make(map[string]fi.Location)
+	for _, r := range files.DAPPatterns {
+		dapPatterns[r.Pattern] = true
+		c.checkPermissions(r.Location, 2, r.Permissions, CASPermissions, RulePermissions, "a CAS access control", "an authorization rule")
+		c.checkDuplicate(seen, r.Pattern+"\x00"+r.Principal, r.Location, 1, "pattern %s and principal %s", r.Pattern, r.Principal)
+	}
+	seen = make(map[string]fi.Location)
+	for _, r := range files.DAPCASLIBs {
+		c.checkDuplicate(seen, r.CASLIB, r.Location, 0, "CASLIB %s", r.CASLIB)
+		if !dapPatterns[r.Pattern] {
+			c.add(r.Location, 4, Error, "pattern %s is not defined", r.Pattern)
+		}
+	}
+	return c.diagnostics
+}
+
+// checkGroups reports duplicate rows, group names that differ between rows and group nesting cycles
+func (t *table) checkGroups(rows []GroupRow) {
+	seen := make(map[string]fi.Location)
+	names := make(map[string]GroupRow)
+	children := make(map[string][]GroupRow)
+	var parents []string
+	for _, r := range rows {
+		if t.checkDuplicate(seen, r.ParentGroupID+"\x00"+r.GroupID+"\x00"+r.UserID, r.Location, 1, "group %s", r.GroupID) {
+			continue
+		}
+		if r.GroupName != "" {
+			if named, exists := names[r.GroupID]; exists && named.GroupName != r.GroupName {
+				t.add(r.Location, 2, Warning, "GroupName %q of group %s differs from %q on %s", r.GroupName, r.GroupID, named.GroupName, named.Location)
+			} else if !exists {
+				names[r.GroupID] = r
+			}
+		}
+		if r.ParentGroupID != "" {
+			if _, exists := children[r.ParentGroupID]; !exists {
+				parents = append(parents, r.ParentGroupID)
+			}
+			children[r.ParentGroupID] = append(children[r.ParentGroupID], r)
+		}
+	}
+	// a depth-first search reports every nesting that leads back to a group on the current path
+	const visiting, visited = 1, 2
+	state := make(map[string]int)
+	var path []string
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = visiting
+		path = append(path, id)
+		for _, r := range children[id] {
+			switch state[r.GroupID] {
+			case visiting:
+				for i := range path {
+					if path[i] == r.GroupID {
+						t.add(r.Location, 0, Error, "group nesting cycle %s", strings.Join(append(append([]string{}, path[i:]...), r.GroupID), " > "))
+						break
+					}
+				}
+			case 0:
+				visit(r.GroupID)
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+	}
+	for _, id := range parents {
+		if state[id] == 0 {
+			visit(id)
+		}
+	}
+}
+
+// checkFolders reports duplicate folders, references to undefined patterns and folders whose parent folder is not
+// listed before them. The parent of a folder is only created first if it is listed on an earlier row, otherwise it
+// needs to exist
+func (t *table) checkFolders(rows []FolderRow, patterns map[string]bool, createFolders bool) {
+	seen := make(map[string]fi.Location)
+	for _, r := range rows {
+		var directory string = strings.TrimSuffix(r.Directory, "/")
+		if r.Pattern != "" && !patterns[r.Pattern] {
+			t.add(r.Location, 1, Error, "pattern %s is not defined", r.Pattern)
+		}
+		if _, exists := seen[directory]; !exists {
+			if i := strings.LastIndex(directory, "/"); i > 0 {
+				if _, listed := seen[directory[:i]]; !listed {
+					if createFolders {
+						t.add(r.Location, 0, Warning, "parent folder %s is not listed before folder %s, so it needs to exist to create the folder", directory[:i], directory)
+					} else {
+						t.add(r.Location, 0, Warning, "parent folder %s is not listed, folder %s needs to exist", directory[:i], directory)
+					}
+				}
+			}
+		}
+		t.checkDuplicate(seen, directory, r.Location, 0, "folder %s", directory)
+	}
+}
+
+// checkDuplicate reports a row whose key was already seen on an earlier row and returns whether it is a duplicate
+func (t *table) checkDuplicate(seen map[string]fi.Location, key string, location fi.Location, column int, format string, a ...interface{}) bool {
+	if earlier, exists := seen[key]; exists {
+		t.add(location, column, Error, "duplicate row for %s, first defined on %s", fmt.Sprintf(format, a...), earlier)
+		return true
+	}
+	seen[key] = location
+	return false
+}
+
+// checkPermissions reports permissions that are not documented for the kind of rule. Permissions of the other kind
+// are called out, as authorization rules and CAS access controls are easily confused
+func (t *table) checkPermissions(location fi.Location, column int, permissions, documented, other []string, kind, otherKind string) {
+	for _, permission := range permissions {
+		switch {
+		case contains(documented, permission):
+		case contains(other, permission):
+			t.add(location, column, Error, "permission %s is %s permission, not %s permission", permission, otherKind, kind)
+		default:
+			t.add(location, column, Error, "unknown permission %s for %s, expected one of %s", permission, kind, strings.Join(documented, ", "))
+		}
+	}
+}
+
+// contains checks whether a list contains a value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
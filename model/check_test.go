@@ -0,0 +1,92 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCheckSample(t *testing.T) {
+	var files Files
+	files.Groups, _ = ReadGroups("../sample/sample_groups.csv")
+	files.Matrix, _ = ReadMatrix("../sample/sample_matrix.csv")
+	files.IPAPPatterns, _ = ReadIPAPPatterns("../sample/sample_ipap_pattern.csv")
+	files.IPAPFolders, _ = ReadIPAPFolders("../sample/sample_ipap_folders.csv")
+	files.DAPPatterns, _ = ReadDAPPatterns("../sample/sample_dap_pattern.csv")
+	files.DAPCASLIBs, _ = ReadDAPCASLIBs("../sample/sample_dap_caslibs.csv")
+	if diagnostics := Check(files, true); len(diagnostics) != 0 {
+		t.Errorf("Expected: %v, Returned: %v.", nil, diagnostics)
+	}
+}
+
+func TestLoadDiagnostics(t *testing.T) {
+	ioutil.WriteFile("test.csv", []byte("ParentGroupID,GroupID,GroupName,UserID\n,per001,Persona,\nper001,,Persona,\n,,Persona,Hamish\n"), 0644)
+	defer os.Remove("test.csv")
+	rows, diagnostics, err := LoadGroups("test.csv")
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("Expected: %v, Returned: %v.", 1, len(rows))
+	}
+	expected := []string{"test.csv:3:2: error: GroupID is required", "test.csv:4:2: error: GroupID is required"}
+	var returned []string
+	for _, d := range diagnostics {
+		returned = append(returned, d.String())
+	}
+	if !reflect.DeepEqual(expected, returned) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	write := map[string]string{
+		"test_groups.csv":  "ParentGroupID,GroupID,GroupName,UserID\nper002,per001,Persona: Business User,\nper001,per002,Persona: Administrator,\nper001,per002,Persona: Administrator,\n,per003,Persona: Viewer,\n,per003,Persona: Viewers,Hamish\n",
+		"test_matrix.csv":  "URI,Principal,Permissions\n/SASDrive/**,per001,\"read,select\"\n/SASDrive/**,per001,reed\n",
+		"test_ipap.csv":    "Pattern,Principal,GrantType,Permissions\nipap1,per001,object,read\nipap1,per001,object,\"read,update\"\n",
+		"test_folders.csv": "Directory,Pattern\n/Test/Sub,ipap1\n/Test,ipap2\n/Test/,\n",
+		"test_dap.csv":     "Pattern,Principal,Permissions\ndap1,per001,\"readInfo,read\"\n",
+		"test_caslibs.csv": "CASLIB,Pattern\ntestcas1,dap1\ntestcas2,dap2\n",
+	}
+	for name, content := range write {
+		ioutil.WriteFile(name, []byte(content), 0644)
+		defer os.Remove(name)
+	}
+	var files Files
+	files.Groups, _ = ReadGroups("test_groups.csv")
+	files.Matrix, _ = ReadMatrix("test_matrix.csv")
+	files.IPAPPatterns, _ = ReadIPAPPatterns("test_ipap.csv")
+	files.IPAPFolders, _ = ReadIPAPFolders("test_folders.csv")
+	files.DAPPatterns, _ = ReadDAPPatterns("test_dap.csv")
+	files.DAPCASLIBs, _ = ReadDAPCASLIBs("test_caslibs.csv")
+	expected := []string{
+		"test_groups.csv:4:2: error: duplicate row for group per002, first defined on test_groups.csv:3",
+		"test_groups.csv:6:3: warning: GroupName \"Persona: Viewers\" of group per003 differs from \"Persona: Viewer\" on test_groups.csv:5",
+		"test_groups.csv:3:1: error: group nesting cycle per002 > per001 > per002",
+		"test_matrix.csv:2:3: error: permission select is a CAS access control permission, not an authorization rule permission",
+		"test_matrix.csv:3:3: error: unknown permission reed for an authorization rule, expected one of read, update, delete, create, secure, add, remove",
+		"test_matrix.csv:3:1: error: duplicate row for grant of URI /SASDrive/** and principal per001, first defined on test_matrix.csv:2",
+		"test_ipap.csv:3:2: error: duplicate row for grant of pattern ipap1, principal per001 and grant type object, first defined on test_ipap.csv:2",
+		"test_folders.csv:2:1: warning: parent folder /Test is not listed before folder /Test/Sub, so it needs to exist to create the folder",
+		"test_folders.csv:3:2: error: pattern ipap2 is not defined",
+		"test_folders.csv:4:1: error: duplicate row for folder /Test, first defined on test_folders.csv:3",
+		"test_dap.csv:2:3: error: permission read is an authorization rule permission, not a CAS access control permission",
+		"test_caslibs.csv:3:2: error: pattern dap2 is not defined",
+	}
+	var returned []string
+	for _, d := range Check(files, true) {
+		returned = append(returned, d.String())
+	}
+	if !reflect.DeepEqual(expected, returned) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+	for _, d := range Check(files, false) {
+		if d.Location.Line == 2 && d.Location.Path == "test_folders.csv" && d.Severity != Warning {
+			t.Errorf("Expected: %v, Returned: %v.", Warning, d.Severity)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	fi "github.com/sassoftware/sas-viya-authorization-model/file"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// Model describes all authorization concepts of a SAS Viya environment in a single file
+type Model struct {
+	Groups    []Group      `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Matrix    []Capability `json:"matrix,omitempty" yaml:"matrix,omitempty"`
+	IPAP      *IPAP        `json:"ipap,omitempty" yaml:"ipap,omitempty"`
+	DAP       *DAP         `json:"dap,omitempty" yaml:"dap,omitempty"`
+	path      string
+	positions map[string]position
+}
+
+// Group is a custom group with its direct members
+type Group struct {
+	ID      string  `json:"id" yaml:"id"`
+	Name    string  `json:"name,omitempty" yaml:"name,omitempty"`
+	Members Members `json:"members,omitempty" yaml:"members,omitempty"`
+}
+
+// Members of a custom group
+type Members struct {
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Users  []string `json:"users,omitempty" yaml:"users,omitempty"`
+}
+
+// Capability grants a principal permissions on an object URI of the platform capability matrix
+type Capability struct {
+	URI         string   `json:"uri" yaml:"uri"`
+	Principal   string   `json:"principal" yaml:"principal"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+	RuleOptions `yaml:",inline"`
+}
+
+// IPAP describes the Information Product Access Patterns and the folders they are applied to
+type IPAP struct {
+	Patterns map[string][]FolderGrant `json:"patterns,omitempty" yaml:"patterns,omitempty"`
+	Folders  []Folder                 `json:"folders,omitempty" yaml:"folders,omitempty"`
+}
+
+// FolderGrant grants a principal permissions on a folder (object) or its content (conveyed)
+type FolderGrant struct {
+	Principal   string   `json:"principal" yaml:"principal"`
+	GrantType   string   `json:"grantType" yaml:"grantType"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+	RuleOptions `yaml:",inline"`
+}
+
+// Folder assigns an IPAP to a folder. Folders without a pattern are only created
+type Folder struct {
+	Directory string `json:"directory" yaml:"directory"`
+	Pattern   string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+}
+
+// DAP describes the Data Access Patterns and the CASLIBs they are applied to
+type DAP struct {
+	Patterns map[string][]Control `json:"patterns,omitempty" yaml:"patterns,omitempty"`
+	CASLIBs  []CASLIB             `json:"caslibs,omitempty" yaml:"caslibs,omitempty"`
+}
+
+// Control grants a principal CAS permissions on a CASLIB
+type Control struct {
+	Principal   string   `json:"principal" yaml:"principal"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+}
+
+// CASLIB assigns a DAP to a CASLIB
+type CASLIB struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Type        string `json:"type,omitempty" yaml:"type,omitempty"`
+	Path        string `json:"path,omitempty" yaml:"path,omitempty"`
+	Pattern     string `json:"pattern" yaml:"pattern"`
+}
+
+// Read a model file. Files with a .yaml or .yml extension are read as YAML, all others as JSON. Unknown keys are
+// rejected, so that typos do not silently drop parts of the model
+func Read(path string) (*Model, error) {
+	m, _, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Load reads a model file and returns diagnostics for missing and invalid values instead of failing on the first
+// one. References to undefined patterns and duplicate groups are left to Check, as for the rows of the other model
+// files
+func Load(path string) (*Model, []Diagnostic, error) {
+	zap.S().Debugw("Reading model file", "path", path)
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading file: %w", err)
+	}
+	m := new(Model)
+	m.path = path
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.UnmarshalStrict(body, m); err != nil {
+			return nil, nil, fmt.Errorf("unmarshalling YAML file %s: %w", path, err)
+		}
+		m.positions = yamlPositions(body)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(m); err != nil {
+			return nil, nil, fmt.Errorf("unmarshalling JSON file %s: %w", path, err)
+		}
+		m.positions = jsonPositions(body)
+	}
+	return m, m.diagnostics(), nil
+}
+
+// Validate the model for missing identifiers and references to undefined patterns and return the first problem
+func (m *Model) Validate() error {
+	return firstError(append(m.diagnostics(), m.references()...), nil)
+}
+
+// diagnostics reports missing and invalid values of the model, located like the columns of the other model files
+func (m *Model) diagnostics() []Diagnostic {
+	t := new(table)
+	for i, g := range m.Groups {
+		if g.ID == "" {
+			t.add(m.location("/groups/%d", i), 1, Error, "id is required")
+		}
+	}
+	for i, c := range m.Matrix {
+		var location fi.Location = m.location("/matrix/%d", i)
+		if c.URI == "" || c.Principal == "" || len(c.Permissions) == 0 {
+			t.add(location, 0, Error, "uri, principal and permissions are required")
+		} else if _, err := c.RuleOptions.validate(); err != nil {
+			t.add(location, 3, Error, "%s", err)
+		}
+	}
+	if m.IPAP != nil {
+		for _, name := range m.IPAP.names() {
+			for i, g := range m.IPAP.Patterns[name] {
+				var location fi.Location = m.location("/ipap/patterns/%s/%d", name, i)
+				if g.Principal == "" || len(g.Permissions) == 0 {
+					t.add(location, 1, Error, "principal and permissions are required")
+				} else if g.GrantType != "object" && g.GrantType != "conveyed" {
+					t.add(location, 2, Error, "grantType %q is invalid, expected object or conveyed", g.GrantType)
+				} else if _, err := g.RuleOptions.validate(); err != nil {
+					t.add(location, 4, Error, "%s", err)
+				}
+			}
+		}
+		for i, f := range m.IPAP.Folders {
+			if f.Directory == "" {
+				t.add(m.location("/ipap/folders/%d", i), 0, Error, "directory is required")
+			}
+		}
+	}
+	if m.DAP != nil {
+		for _, name := range m.DAP.names() {
+			for i, c := range m.DAP.Patterns[name] {
+				if c.Principal == "" || len(c.Permissions) == 0 {
+					t.add(m.location("/dap/patterns/%s/%d", name, i), 1, Error, "principal and permissions are required")
+				}
+			}
+		}
+		for i, c := range m.DAP.CASLIBs {
+			if c.Name == "" {
+				t.add(m.location("/dap/caslibs/%d", i), 0, Error, "name is required")
+			}
+		}
+	}
+	return t.diagnostics
+}
+
+// references reports groups that are defined more than once and references to undefined patterns
+func (m *Model) references() []Diagnostic {
+	t := new(table)
+	groups := make(map[string]fi.Location)
+	for i, g := range m.Groups {
+		t.checkDuplicate(groups, g.ID, m.location("/groups/%d", i), 1, "group %s", g.ID)
+	}
+	if m.IPAP != nil {
+		for i, f := range m.IPAP.Folders {
+			if _, exists := m.IPAP.Patterns[f.Pattern]; !exists && f.Pattern != "" {
+				t.add(m.location("/ipap/folders/%d", i), 1, Error, "pattern %s is not defined", f.Pattern)
+			}
+		}
+	}
+	if m.DAP != nil {
+		for i, c := range m.DAP.CASLIBs {
+			if _, exists := m.DAP.Patterns[c.Pattern]; !exists {
+				t.add(m.location("/dap/caslibs/%d", i), 4, Error, "pattern %s is not defined", c.Pattern)
+			}
+		}
+	}
+	return t.diagnostics
+}
+
+// GroupRows returns the custom groups as rows of a groups file. Every group is defined by its own row, followed by a
+// row per member group and member user
+func (m *Model) GroupRows() []GroupRow {
+	names := make(map[string]string)
+	for _, g := range m.Groups {
+		names[g.ID] = g.Name
+		if g.Name == "" {
+			names[g.ID] = g.ID
+		}
+	}
+	var rows, users []GroupRow
+	for i, g := range m.Groups {
+		rows = append(rows, GroupRow{GroupID: g.ID, GroupName: names[g.ID], Location: m.location("/groups/%d", i)})
+	}
+	for i, g := range m.Groups {
+		for j, member := range g.Members.Groups {
+			var name string = member
+			if defined, exists := names[member]; exists {
+				name = defined
+			}
+			rows = append(rows, GroupRow{ParentGroupID: g.ID, GroupID: member, GroupName: name, Location: m.location("/groups/%d/members/groups/%d", i, j)})
+		}
+		for j, user := range g.Members.Users {
+			users = append(users, GroupRow{GroupID: g.ID, GroupName: names[g.ID], UserID: user, Location: m.location("/groups/%d/members/users/%d", i, j)})
+		}
+	}
+	return append(rows, users...)
+}
+
+// MatrixRows returns the platform capability matrix as rows of a matrix file
+func (m *Model) MatrixRows() []CapabilityRow {
+	var rows []CapabilityRow
+	for i, c := range m.Matrix {
+		rows = append(rows, CapabilityRow{URI: c.URI, Principal: c.Principal, Permissions: c.Permissions, RuleOptions: c.RuleOptions, Location: m.location("/matrix/%d", i)})
+	}
+	return rows
+}
+
+// IPAPRows returns the IPAPs and folders as rows of the IPAP pattern and folders files
+func (m *Model) IPAPRows() (patterns []IPAPRow, folders []FolderRow) {
+	if m.IPAP == nil {
+		return nil, nil
+	}
+	for _, name := range m.IPAP.names() {
+		for i, g := range m.IPAP.Patterns[name] {
+			patterns = append(patterns, IPAPRow{Pattern: name, Principal: g.Principal, GrantType: g.GrantType, Permissions: g.Permissions, RuleOptions: g.RuleOptions, Location: m.location("/ipap/patterns/%s/%d", name, i)})
+		}
+	}
+	for i, f := range m.IPAP.Folders {
+		folders = append(folders, FolderRow{Directory: f.Directory, Pattern: f.Pattern, Location: m.location("/ipap/folders/%d", i)})
+	}
+	return patterns, folders
+}
+
+// DAPRows returns the DAPs and CASLIBs as rows of the DAP pattern and CASLIBs files
+func (m *Model) DAPRows() (patterns []DAPRow, caslibs []CASLIBRow) {
+	if m.DAP == nil {
+		return nil, nil
+	}
+	for _, name := range m.DAP.names() {
+		for i, c := range m.DAP.Patterns[name] {
+			patterns = append(patterns, DAPRow{Pattern: name, Principal: c.Principal, Permissions: c.Permissions, Location: m.location("/dap/patterns/%s/%d", name, i)})
+		}
+	}
+	for i, c := range m.DAP.CASLIBs {
+		caslibs = append(caslibs, CASLIBRow{CASLIB: c.Name, Description: c.Description, Type: c.Type, Path: c.Path, Pattern: c.Pattern, Location: m.location("/dap/caslibs/%d", i)})
+	}
+	return patterns, caslibs
+}
+
+// location returns the location of a row derived from the value of the model at a path, e.g. /ipap/folders/0. Values
+// whose position is unknown, e.g. in a YAML flow sequence, are located at the closest enclosing value
+func (m *Model) location(format string, a ...interface{}) fi.Location {
+	for path := fmt.Sprintf(format, a...); path != ""; path = path[:strings.LastIndex(path, "/")] {
+		if p, exists := m.positions[path]; exists {
+			return fi.Located(m.path, p.line, p.column)
+		}
+	}
+	return fi.Location{Path: m.path}
+}
+
+// names returns the names of the IPAPs in order
+func (i *IPAP) names() []string {
+	var names []string
+	for name := range i.Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// names returns the names of the DAPs in order
+func (d *DAP) names() []string {
+	var names []string
+	for name := range d.Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Files returns the rows of all concepts of the model
+func (m *Model) Files() Files {
+	var files Files
+	files.Groups = m.GroupRows()
+	files.Matrix = m.MatrixRows()
+	files.IPAPPatterns, files.IPAPFolders = m.IPAPRows()
+	files.DAPPatterns, files.DAPCASLIBs = m.DAPRows()
+	return files
+}
@@ -0,0 +1,161 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadSample(t *testing.T) {
+	m, err := Read("../sample/sample_model.yaml")
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	ipapPatterns, ipapFolders := m.IPAPRows()
+	dapPatterns, dapCASLIBs := m.DAPRows()
+	matrix, _ := ReadMatrix("../sample/sample_matrix.csv")
+	if !reflect.DeepEqual(unlocated(matrix), unlocated(m.MatrixRows())) {
+		t.Errorf("Expected: %v, Returned: %v.", matrix, m.MatrixRows())
+	}
+	patterns, _ := ReadIPAPPatterns("../sample/sample_ipap_pattern.csv")
+	if !reflect.DeepEqual(unlocated(patterns), unlocated(ipapPatterns)) {
+		t.Errorf("Expected: %v, Returned: %v.", patterns, ipapPatterns)
+	}
+	folders, _ := ReadIPAPFolders("../sample/sample_ipap_folders.csv")
+	if !reflect.DeepEqual(unlocated(folders), unlocated(ipapFolders)) {
+		t.Errorf("Expected: %v, Returned: %v.", folders, ipapFolders)
+	}
+	controls, _ := ReadDAPPatterns("../sample/sample_dap_pattern.csv")
+	if !reflect.DeepEqual(unlocated(controls), unlocated(dapPatterns)) {
+		t.Errorf("Expected: %v, Returned: %v.", controls, dapPatterns)
+	}
+	caslibs, _ := ReadDAPCASLIBs("../sample/sample_dap_caslibs.csv")
+	if !reflect.DeepEqual(unlocated(caslibs), unlocated(dapCASLIBs)) {
+		t.Errorf("Expected: %v, Returned: %v.", caslibs, dapCASLIBs)
+	}
+}
+
+func TestGroupRows(t *testing.T) {
+	write := []byte(`{"groups": [
+		{"id": "per007", "name": "Persona: Administrator", "members": {"groups": ["per001"], "users": ["Hamish"]}},
+		{"id": "per001", "name": "Persona: Business User"}
+	]}`)
+	ioutil.WriteFile("test.json", write, 0644)
+	defer os.Remove("test.json")
+	m, err := Read("test.json")
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	expected := []GroupRow{
+		{GroupID: "per007", GroupName: "Persona: Administrator"},
+		{GroupID: "per001", GroupName: "Persona: Business User"},
+		{ParentGroupID: "per007", GroupID: "per001", GroupName: "Persona: Business User"},
+		{GroupID: "per007", GroupName: "Persona: Administrator", UserID: "Hamish"},
+	}
+	if returned := m.GroupRows(); !reflect.DeepEqual(expected, unlocated(returned)) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	for name, write := range map[string]string{
+		"unknown key":       "groups:\n  - id: per001\n    member: [per002]\n",
+		"undefined pattern": "ipap:\n  folders:\n    - {directory: /Test, pattern: ipap1}\n",
+		"grant type":        "ipap:\n  patterns:\n    ipap1:\n      - {principal: per001, grantType: container, permissions: [read]}\n",
+		"rule type":         "matrix:\n  - {uri: /SASDrive/**, principal: per001, permissions: [read], type: deny}\n",
+	} {
+		ioutil.WriteFile("test.yaml", []byte(write), 0644)
+		if _, err := Read("test.yaml"); err == nil {
+			t.Errorf("Expected: %v, Returned: %v.", name+" error", err)
+		}
+	}
+	os.Remove("test.yaml")
+}
+
+func TestReadRows(t *testing.T) {
+	write := []byte("# capability matrix\r\nOwner,Principal,URI,Permissions\r\n\r\nSecurity,per001,/SASDrive/**,\"read, update\"\r\n# viewers\r\nSecurity,per002,/SASVisualAnalytics/**,read\r\n")
+	ioutil.WriteFile("test.csv", write, 0644)
+	defer os.Remove("test.csv")
+	returned, err := ReadMatrix("test.csv")
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	expected := []CapabilityRow{
+		{URI: "/SASDrive/**", Principal: "per001", Permissions: []string{"read", "update"}},
+		{URI: "/SASVisualAnalytics/**", Principal: "per002", Permissions: []string{"read"}},
+	}
+	if !reflect.DeepEqual(expected, unlocated(returned)) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+	if location := returned[1].Location.At(2); location != "test.csv:6:4" {
+		t.Errorf("Expected: %v, Returned: %v.", "test.csv:6:4", location)
+	}
+	ioutil.WriteFile("test.csv", []byte("Pattern,Principal,GrantType,Permissions\n# comment\nipap1,per001,object,read\nipap1,per002,container,read\n"), 0644)
+	if _, err := ReadIPAPPatterns("test.csv"); err == nil || err.Error() != `test.csv:4:3: GrantType "container" is invalid, expected object or conveyed` {
+		t.Errorf("Expected: %v, Returned: %v.", "test.csv:4:3", err)
+	}
+	ioutil.WriteFile("test.csv", []byte("URI,Principal,Permissions,Type,ExpirationTimestamp,Reason\n/SASDrive/**,per001,read,prohibit,2021-12-31T23:59:59Z,Contractor\n"), 0644)
+	capabilities, err := ReadMatrix("test.csv")
+	options := RuleOptions{Type: "prohibit", ExpirationTimestamp: "2021-12-31T23:59:59Z", Reason: "Contractor"}
+	if err != nil || len(capabilities) != 1 || capabilities[0].RuleOptions != options || capabilities[0].RuleType() != "prohibit" {
+		t.Errorf("Expected: %v, Returned: %v (%v).", options, capabilities, err)
+	}
+	ioutil.WriteFile("test.csv", []byte("URI,Principal,Permissions,Type\n/SASDrive/**,per001,read,deny\n"), 0644)
+	if _, err := ReadMatrix("test.csv"); err == nil || err.Error() != `test.csv:2:4: Type "deny" is invalid, expected grant or prohibit` {
+		t.Errorf("Expected: %v, Returned: %v.", "test.csv:2:4", err)
+	}
+	ioutil.WriteFile("test.csv", []byte("Pattern,Principal,GrantType,Permissions,ExpirationTimestamp\nipap1,per001,object,read,2021-12-31\n"), 0644)
+	if _, err := ReadIPAPPatterns("test.csv"); err == nil || !strings.HasPrefix(err.Error(), "test.csv:2:5: ExpirationTimestamp") {
+		t.Errorf("Expected: %v, Returned: %v.", "test.csv:2:5", err)
+	}
+	ioutil.WriteFile("test.csv", []byte("GroupName,GroupID\nPersona,\n"), 0644)
+	if _, err := ReadGroups("test.csv"); err == nil || err.Error() != "test.csv:2:2: GroupID is required" {
+		t.Errorf("Expected: %v, Returned: %v.", "test.csv:2:2", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	for name, write := range map[string]string{
+		"test.yaml": "groups:\n  - id: per001\n    members:\n      users: [Hamish]\n  - name: Persona\nipap:\n  patterns:\n    ipap1:\n    - principal: per001\n      grantType: container\n      permissions: [read]\n  folders:\n  - {directory: /Test, pattern: ipap2}\n",
+		"test.json": "{\"groups\": [\n  {\"id\": \"per001\", \"members\": {\"users\": [\"Hamish\"]}},\n  {\"name\": \"Persona\"}\n], \"ipap\": {\"patterns\": {\"ipap1\": [\n  {\"principal\": \"per001\", \"grantType\": \"container\", \"permissions\": [\"read\"]}\n]}, \"folders\": [\n  {\"directory\": \"/Test\", \"pattern\": \"ipap2\"}\n]}}\n",
+	} {
+		ioutil.WriteFile(name, []byte(write), 0644)
+		defer os.Remove(name)
+		m, diagnostics, err := Load(name)
+		if err != nil {
+			t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+		}
+		diagnostics = append(diagnostics, Check(m.Files(), false)...)
+		var returned []string
+		for _, d := range diagnostics {
+			returned = append(returned, d.String())
+		}
+		expected := map[string][]string{
+			"test.yaml": {"test.yaml:5:5: error: id is required", "test.yaml:9:7: error: grantType \"container\" is invalid, expected object or conveyed", "test.yaml:13:5: error: pattern ipap2 is not defined"},
+			"test.json": {"test.json:3:3: error: id is required", "test.json:5:3: error: grantType \"container\" is invalid, expected object or conveyed", "test.json:7:3: error: pattern ipap2 is not defined"},
+		}[name]
+		if !reflect.DeepEqual(expected, returned) {
+			t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+		}
+		if rows := m.GroupRows(); len(rows) != 3 || rows[2].Location.String() != name+":"+map[string]string{"test.yaml": "4", "test.json": "2"}[name] {
+			t.Errorf("Expected: %v, Returned: %v.", "location of user Hamish", rows)
+		}
+	}
+}
+
+// unlocated returns a copy of typed rows without their locations, so that rows from different files can be compared
+func unlocated(rows interface{}) interface{} {
+	v := reflect.ValueOf(rows)
+	copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(copied, v)
+	for i := 0; i < copied.Len(); i++ {
+		location := copied.Index(i).FieldByName("Location")
+		location.Set(reflect.Zero(location.Type()))
+	}
+	return copied.Interface()
+}
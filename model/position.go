@@ -0,0 +1,145 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// position of a value in a model file as line and column
+type position struct {
+	line   int
+	column int
+}
+
+// jsonPositions returns the position of every value of a JSON document by its path, e.g. /ipap/folders/0. The
+// positions of a document that cannot be decoded are incomplete
+func jsonPositions(body []byte) map[string]position {
+	positions := make(map[string]position)
+	dec := json.NewDecoder(bytes.NewReader(body))
+	var walk func(path string) error
+	walk = func(path string) error {
+		// the value starts after the separators that follow the previous token
+		var start int = int(dec.InputOffset())
+		for start < len(body) && strings.ContainsRune(" \t\r\n,:", rune(body[start])) {
+			start++
+		}
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var line int = 1 + bytes.Count(body[:start], []byte("\n"))
+		positions[path] = position{line: line, column: start - bytes.LastIndexByte(body[:start], '\n')}
+		switch token {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if err := walk(path + "/" + fmt.Sprint(key)); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if err := walk(path + "/" + strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		}
+		return err
+	}
+	walk("")
+	return positions
+}
+
+// yamlPositions returns the position of the keys and sequence items of a YAML document by their path, e.g.
+// /ipap/folders/0. Only block collections are followed, the content of flow collections and block scalars is skipped
+func yamlPositions(body []byte) map[string]position {
+	positions := make(map[string]position)
+	// a node is a key or sequence item that is followed by the nodes indented below it
+	type node struct {
+		indent int
+		path   string
+		item   bool
+		items  int
+	}
+	var stack []*node = []*node{{indent: -1}}
+	var scalar int = -1
+	for i, line := range strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n") {
+		var text string = strings.TrimLeft(line, " ")
+		var column int = len(line) - len(text)
+		if scalar >= 0 && (column > scalar || text == "") {
+			continue
+		}
+		scalar = -1
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(line, "---") || strings.HasPrefix(line, "...") {
+			continue
+		}
+		for text != "" {
+			if text == "-" || strings.HasPrefix(text, "- ") {
+				for top := stack[len(stack)-1]; top.indent > column || (top.indent == column && top.item); top = stack[len(stack)-1] {
+					stack = stack[:len(stack)-1]
+				}
+				parent := stack[len(stack)-1]
+				var rest string = strings.TrimLeft(text[1:], " ")
+				item := &node{indent: column, path: parent.path + "/" + strconv.Itoa(parent.items), item: true}
+				parent.items++
+				column += len(text) - len(rest)
+				positions[item.path] = position{line: i + 1, column: column + 1}
+				stack = append(stack, item)
+				text = rest
+				continue
+			}
+			key, value, ok := yamlKey(text)
+			if !ok {
+				break
+			}
+			for stack[len(stack)-1].indent >= column {
+				stack = stack[:len(stack)-1]
+			}
+			k := &node{indent: column, path: stack[len(stack)-1].path + "/" + key}
+			positions[k.path] = position{line: i + 1, column: column + 1}
+			stack = append(stack, k)
+			if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+				scalar = column
+			}
+			break
+		}
+	}
+	return positions
+}
+
+// yamlKey splits a line of a block mapping into its key and value, unquoting the key
+func yamlKey(text string) (key, value string, ok bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		key, text = text[1:end+1], text[end+2:]
+		if text != ":" && !strings.HasPrefix(text, ": ") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(text[1:]), true
+	}
+	if strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") || strings.HasPrefix(text, "#") {
+		return "", "", false
+	}
+	if strings.HasSuffix(text, ":") && !strings.Contains(text, ": ") {
+		return strings.TrimSuffix(text, ":"), "", true
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:]), true
+}
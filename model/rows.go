@@ -0,0 +1,331 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	fi "github.com/sassoftware/sas-viya-authorization-model/file"
+)
+
+// GroupRow nests a custom group in a parent group, names it or adds a user to it
+type GroupRow struct {
+	ParentGroupID string
+	GroupID       string
+	GroupName     string
+	UserID        string
+	Location      fi.Location
+}
+
+// CapabilityRow grants a principal permissions on an object URI. A row without a URI only refers to the principal
+type CapabilityRow struct {
+	URI         string
+	Principal   string
+	Permissions []string
+	RuleOptions
+	Location fi.Location
+}
+
+// IPAPRow is an entry of an Information Product Access Pattern
+type IPAPRow struct {
+	Pattern     string
+	Principal   string
+	GrantType   string
+	Permissions []string
+	RuleOptions
+	Location fi.Location
+}
+
+// RuleOptions are the optional attributes of an authorization rule. Rules without a type are grants, prohibits deny
+// the permissions instead. The condition and media type scope the rule, the expiration timestamp (RFC 3339) limits it
+// in time and the reason documents it
+type RuleOptions struct {
+	Type                string `json:"type,omitempty" yaml:"type,omitempty"`
+	Condition           string `json:"condition,omitempty" yaml:"condition,omitempty"`
+	MediaType           string `json:"mediaType,omitempty" yaml:"mediaType,omitempty"`
+	ExpirationTimestamp string `json:"expirationTimestamp,omitempty" yaml:"expirationTimestamp,omitempty"`
+	Reason              string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// FolderRow assigns an IPAP to a folder. Folders without a pattern are only created
+type FolderRow struct {
+	Directory string
+	Pattern   string
+	Location  fi.Location
+}
+
+// DAPRow is an entry of a Data Access Pattern
+type DAPRow struct {
+	Pattern     string
+	Principal   string
+	Permissions []string
+	Location    fi.Location
+}
+
+// CASLIBRow assigns a DAP to a CASLIB
+type CASLIBRow struct {
+	CASLIB      string
+	Description string
+	Type        string
+	Path        string
+	Pattern     string
+	Location    fi.Location
+}
+
+// ReadGroups reads a groups file
+func ReadGroups(path string) ([]GroupRow, error) {
+	rows, diagnostics, err := LoadGroups(path)
+	if err := firstError(diagnostics, err); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// LoadGroups reads a groups file and returns diagnostics for invalid rows instead of failing on the first one
+func LoadGroups(path string) ([]GroupRow, []Diagnostic, error) {
+	t, err := load(path, GroupsSchema, []string{"ParentGroupID", "GroupName", "UserID"}, []string{"GroupID"})
+	if err != nil {
+		return nil, nil, err
+	}
+	var groups []GroupRow
+	for _, r := range t.rows {
+		groups = append(groups, GroupRow{ParentGroupID: r.values[0], GroupID: r.values[1], GroupName: r.values[2], UserID: r.values[3], Location: r.location})
+	}
+	return groups, t.diagnostics, nil
+}
+
+// ReadMatrix reads a platform capability matrix file
+func ReadMatrix(path string) ([]CapabilityRow, error) {
+	rows, diagnostics, err := LoadMatrix(path)
+	if err := firstError(diagnostics, err); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// LoadMatrix reads a platform capability matrix file and returns diagnostics for invalid rows instead of failing on
+// the first one
+func LoadMatrix(path string) ([]CapabilityRow, []Diagnostic, error) {
+	t, err := load(path, MatrixSchema, RuleColumns, []string{"Principal"})
+	if err != nil {
+		return nil, nil, err
+	}
+	var capabilities []CapabilityRow
+	for _, r := range t.rows {
+		if r.values[0] != "" && r.values[2] == "" {
+			t.add(r.location, 2, Error, "Permissions are required for URI %s", r.values[0])
+			continue
+		}
+		options, valid := t.ruleOptions(r, 3)
+		if !valid {
+			continue
+		}
+		capabilities = append(capabilities, CapabilityRow{URI: r.values[0], Principal: r.values[1], Permissions: Permissions(r.values[2]), RuleOptions: options, Location: r.location})
+	}
+	return capabilities, t.diagnostics, nil
+}
+
+// ReadIPAPPatterns reads an IPAP pattern file
+func ReadIPAPPatterns(path string) ([]IPAPRow, error) {
+	rows, diagnostics, err := LoadIPAPPatterns(path)
+	if err := firstError(diagnostics, err); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// LoadIPAPPatterns reads an IPAP pattern file and returns diagnostics for invalid rows instead of failing on the
+// first one
+func LoadIPAPPatterns(path string) ([]IPAPRow, []Diagnostic, error) {
+	t, err := load(path, IPAPPatternSchema, RuleColumns, IPAPPatternSchema[:4])
+	if err != nil {
+		return nil, nil, err
+	}
+	var patterns []IPAPRow
+	for _, r := range t.rows {
+		if r.values[2] != "object" && r.values[2] != "conveyed" {
+			t.add(r.location, 2, Error, "GrantType %q is invalid, expected object or conveyed", r.values[2])
+			continue
+		}
+		options, valid := t.ruleOptions(r, 4)
+		if !valid {
+			continue
+		}
+		patterns = append(patterns, IPAPRow{Pattern: r.values[0], Principal: r.values[1], GrantType: r.values[2], Permissions: Permissions(r.values[3]), RuleOptions: options, Location: r.location})
+	}
+	return patterns, t.diagnostics, nil
+}
+
+// ReadIPAPFolders reads an IPAP folders file
+func ReadIPAPFolders(path string) ([]FolderRow, error) {
+	rows, diagnostics, err := LoadIPAPFolders(path)
+	if err := firstError(diagnostics, err); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// LoadIPAPFolders reads an IPAP folders file and returns diagnostics for invalid rows instead of failing on the first
+// one
+func LoadIPAPFolders(path string) ([]FolderRow, []Diagnostic, error) {
+	t, err := load(path, IPAPFoldersSchema, []string{"Pattern"}, []string{"Directory"})
+	if err != nil {
+		return nil, nil, err
+	}
+	var folders []FolderRow
+	for _, r := range t.rows {
+		folders = append(folders, FolderRow{Directory: r.values[0], Pattern: r.values[1], Location: r.location})
+	}
+	return folders, t.diagnostics, nil
+}
+
+// ReadDAPPatterns reads a DAP pattern file
+func ReadDAPPatterns(path string) ([]DAPRow, error) {
+	rows, diagnostics, err := LoadDAPPatterns(path)
+	if err := firstError(diagnostics, err); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// LoadDAPPatterns reads a DAP pattern file and returns diagnostics for invalid rows instead of failing on the first
+// one
+func LoadDAPPatterns(path string) ([]DAPRow, []Diagnostic, error) {
+	t, err := load(path, DAPPatternSchema, nil, DAPPatternSchema)
+	if err != nil {
+		return nil, nil, err
+	}
+	var patterns []DAPRow
+	for _, r := range t.rows {
+		patterns = append(patterns, DAPRow{Pattern: r.values[0], Principal: r.values[1], Permissions: Permissions(r.values[2]), Location: r.location})
+	}
+	return patterns, t.diagnostics, nil
+}
+
+// ReadDAPCASLIBs reads a DAP CASLIBs file
+func ReadDAPCASLIBs(path string) ([]CASLIBRow, error) {
+	rows, diagnostics, err := LoadDAPCASLIBs(path)
+	if err := firstError(diagnostics, err); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// LoadDAPCASLIBs reads a DAP CASLIBs file and returns diagnostics for invalid rows instead of failing on the first
+// one
+func LoadDAPCASLIBs(path string) ([]CASLIBRow, []Diagnostic, error) {
+	t, err := load(path, DAPCASLIBsSchema, []string{"Description", "Type", "Path"}, []string{"CASLIB", "Pattern"})
+	if err != nil {
+		return nil, nil, err
+	}
+	var caslibs []CASLIBRow
+	for _, r := range t.rows {
+		caslibs = append(caslibs, CASLIBRow{CASLIB: r.values[0], Description: r.values[1], Type: r.values[2], Path: r.values[3], Pattern: r.values[4], Location: r.location})
+	}
+	return caslibs, t.diagnostics, nil
+}
+
+// RuleType returns the type of the authorization rule, which defaults to grant
+func (o RuleOptions) RuleType() string {
+	if o.Type == "" {
+		return "grant"
+	}
+	return o.Type
+}
+
+// validate checks the type and the expiration timestamp and returns the offset of an invalid column from the Type
+// column
+func (o RuleOptions) validate() (int, error) {
+	if o.Type != "" && o.Type != "grant" && o.Type != "prohibit" {
+		return 0, fmt.Errorf("Type %q is invalid, expected grant or prohibit", o.Type)
+	}
+	if o.ExpirationTimestamp != "" {
+		if _, err := time.Parse(time.RFC3339, o.ExpirationTimestamp); err != nil {
+			return 3, fmt.Errorf("ExpirationTimestamp %q is invalid, expected an RFC 3339 timestamp such as 2021-12-31T23:59:59Z", o.ExpirationTimestamp)
+		}
+	}
+	return 0, nil
+}
+
+// Permissions splits a comma separated list of permissions
+func Permissions(list string) []string {
+	var permissions []string
+	for _, permission := range strings.Split(list, ",") {
+		if permission = strings.TrimSpace(permission); permission != "" {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// table holds the valid rows of a model file and the diagnostics of the invalid ones
+type table struct {
+	rows        []row
+	diagnostics []Diagnostic
+}
+
+// row holds the values of a model file row in the order of the schema
+type row struct {
+	values   []string
+	location fi.Location
+}
+
+// add records a diagnostic for a schema column of a row
+func (t *table) add(location fi.Location, column int, severity, format string, a ...interface{}) {
+	t.diagnostics = append(t.diagnostics, Diagnostic{Location: location, Column: column, Severity: severity, Message: fmt.Sprintf(format, a...)})
+}
+
+// load reads a CSV, YAML or Excel model file. Rows without a value in a required column are recorded as diagnostics
+// and left out, all other rows are returned in the order of the schema without the header row
+func load(path string, schema, optional, required []string) (*table, error) {
+	f := new(fi.File)
+	f.Path = path
+	f.Schema = schema
+	f.Optional = optional
+	f.Detect()
+	if err := f.Read(); err != nil {
+		return nil, err
+	}
+	t := new(table)
+rows:
+	for i, values := range f.Content.([][]string)[1:] {
+		var location fi.Location = f.Location(i + 1)
+		for c, column := range schema {
+			for _, r := range required {
+				if column == r && strings.TrimSpace(values[c]) == "" {
+					t.add(location, c, Error, "%s is required", column)
+					continue rows
+				}
+			}
+		}
+		t.rows = append(t.rows, row{values: values, location: location})
+	}
+	return t, nil
+}
+
+// ruleOptions returns the attributes of an authorization rule from the rule columns starting at the Type column of a
+// row and records a diagnostic if they are invalid
+func (t *table) ruleOptions(r row, column int) (RuleOptions, bool) {
+	options := RuleOptions{Type: r.values[column], Condition: r.values[column+1], MediaType: r.values[column+2], ExpirationTimestamp: r.values[column+3], Reason: r.values[column+4]}
+	if offset, err := options.validate(); err != nil {
+		t.add(r.location, column+offset, Error, "%s", err)
+		return options, false
+	}
+	return options, true
+}
+
+// firstError returns the error of reading a model file or its first diagnostic with error severity
+func firstError(diagnostics []Diagnostic, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, d := range diagnostics {
+		if d.Severity == Error {
+			return d
+		}
+	}
+	return nil
+}
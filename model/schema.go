@@ -0,0 +1,23 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package model
+
+// Schemas of the model CSV files as validated when reading them
+var (
+	GroupsSchema      = []string{"ParentGroupID", "GroupID", "GroupName", "UserID"}
+	MatrixSchema      = []string{"URI", "Principal", "Permissions", "Type", "Condition", "MediaType", "ExpirationTimestamp", "Reason"}
+	IPAPPatternSchema = []string{"Pattern", "Principal", "GrantType", "Permissions", "Type", "Condition", "MediaType", "ExpirationTimestamp", "Reason"}
+	IPAPFoldersSchema = []string{"Directory", "Pattern"}
+	DAPPatternSchema  = []string{"Pattern", "Principal", "Permissions"}
+	DAPCASLIBsSchema  = []string{"CASLIB", "Description", "Type", "Path", "Pattern"}
+)
+
+// RuleColumns are the optional columns of the matrix and IPAP pattern files with the attributes of authorization rules
+var RuleColumns = []string{"Type", "Condition", "MediaType", "ExpirationTimestamp", "Reason"}
+
+// Permissions of authorization rules and CAS access controls in the documented order
+var (
+	RulePermissions = []string{"read", "update", "delete", "create", "secure", "add", "remove"}
+	CASPermissions  = []string{"readInfo", "select", "limitedPromote", "promote", "createTable", "dropTable", "deleteSource", "insert", "update", "delete", "alterTable", "alterCaslib", "manageAccess"}
+)
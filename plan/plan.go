@@ -0,0 +1,135 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Pending marks identifiers that are only known once a planned change has been applied
+const Pending = "(known after apply)"
+
+// Change describes a single mutating operation against SAS Viya
+type Change struct {
+	Action     string                 `json:"action"`
+	Resource   string                 `json:"resource"`
+	Target     string                 `json:"target"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Plan collects the changes that would be made instead of applying them
+type Plan struct {
+	Changes []Change
+	mutex   sync.Mutex
+}
+
+// Add a change to the plan
+func (p *Plan) Add(action, resource, target string, attributes map[string]interface{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Changes = append(p.Changes, Change{
+		Action:     action,
+		Resource:   resource,
+		Target:     target,
+		Attributes: attributes,
+	})
+}
+
+// Summary counts the planned additions, changes and removals
+func (p *Plan) Summary() (add, change, destroy int) {
+	for _, c := range p.Changes {
+		switch symbol(c.Action) {
+		case "+":
+			add++
+		case "-":
+			destroy++
+		default:
+			change++
+		}
+	}
+	return
+}
+
+// WriteText writes a human readable representation of the plan
+func (p *Plan) WriteText(w io.Writer) {
+	if len(p.Changes) == 0 {
+		fmt.Fprintln(w, "No changes. The SAS Viya environment matches the provided definition.")
+		return
+	}
+	for _, c := range p.Changes {
+		fmt.Fprintf(w, "  %s %s %s %s\n", symbol(c.Action), c.Action, c.Resource, c.Target)
+		var keys []string
+		for key := range c.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "      %s = %v\n", key, format(c.Attributes[key]))
+		}
+	}
+	add, change, destroy := p.Summary()
+	fmt.Fprintf(w, "\nPlan: %d to add, %d to change, %d to destroy.\n", add, change, destroy)
+}
+
+// WriteJSON writes a machine readable representation of the plan
+func (p *Plan) WriteJSON(w io.Writer) error {
+	add, change, destroy := p.Summary()
+	changes := p.Changes
+	if changes == nil {
+		changes = []Change{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{
+		"changes": changes,
+		"summary": map[string]int{
+			"add":     add,
+			"change":  change,
+			"destroy": destroy,
+		},
+	})
+}
+
+// PendingURI returns a placeholder URI for an object that is only created by the plan
+func PendingURI(collection, name string) string {
+	return collection + "/" + Pending + " " + name
+}
+
+// IsPending reports whether the URI refers to an object that is only created by the plan
+func IsPending(uri string) bool {
+	return strings.Contains(uri, Pending)
+}
+
+// symbol returns the diff marker of an action
+func symbol(action string) string {
+	switch action {
+	case "create", "add":
+		return "+"
+	case "delete", "remove":
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// format renders attribute values on a single line
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	case string:
+		return `"` + v + `"`
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
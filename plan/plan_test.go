@@ -0,0 +1,71 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	p := new(Plan)
+	p.Add("create", "group", "testgroup", nil)
+	p.Add("add", "membership", "testgroup", map[string]interface{}{"user": "testuser"})
+	p.Add("replace", "accessControls", "testcaslib", nil)
+	p.Add("delete", "rule", "testgroup on /testuri", nil)
+	add, change, destroy := p.Summary()
+	if add != 2 || change != 1 || destroy != 1 {
+		t.Errorf("Expected: %v, Returned: %v.", []int{2, 1, 1}, []int{add, change, destroy})
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	p := new(Plan)
+	p.Add("create", "rule", "testgroup on /testuri", map[string]interface{}{"permissions": []string{"read", "update"}})
+	var buf bytes.Buffer
+	p.WriteText(&buf)
+	var expected string = "  + create rule testgroup on /testuri\n      permissions = [read, update]\n\nPlan: 1 to add, 0 to change, 0 to destroy.\n"
+	if buf.String() != expected {
+		t.Errorf("Expected: %q, Returned: %q.", expected, buf.String())
+	}
+	buf.Reset()
+	new(Plan).WriteText(&buf)
+	if !strings.HasPrefix(buf.String(), "No changes.") {
+		t.Errorf("Expected: %q, Returned: %q.", "No changes.", buf.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	p := new(Plan)
+	p.Add("delete", "group", "testgroup", nil)
+	var buf bytes.Buffer
+	if err := p.WriteJSON(&buf); err != nil {
+		t.Errorf("Failed writing plan: %s.", err)
+	}
+	var returned struct {
+		Changes []Change       `json:"changes"`
+		Summary map[string]int `json:"summary"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &returned); err != nil {
+		t.Errorf("Failed reading plan: %s.", err)
+	}
+	if len(returned.Changes) != 1 || returned.Changes[0].Target != "testgroup" {
+		t.Errorf("Expected: %v, Returned: %v.", p.Changes, returned.Changes)
+	}
+	if returned.Summary["destroy"] != 1 {
+		t.Errorf("Expected: %v, Returned: %v.", 1, returned.Summary["destroy"])
+	}
+}
+
+func TestPendingURI(t *testing.T) {
+	uri := PendingURI("/folders/folders", "/Test/Sub Test 1")
+	if !IsPending(uri) {
+		t.Errorf("Expected: %v, Returned: %v.", true, IsPending(uri))
+	}
+	if IsPending("/folders/folders/testid") {
+		t.Errorf("Expected: %v, Returned: %v.", false, true)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	fi "github.com/sassoftware/sas-viya-authorization-model/file"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// Concepts a policy can apply to
+const (
+	Groups = "groups"
+	Matrix = "matrix"
+	IPAP   = "ipap"
+	DAP    = "dap"
+)
+
+// Policies are the guardrails every model needs to comply with before it is applied
+type Policies struct {
+	Policies []Policy `json:"policies" yaml:"policies"`
+}
+
+// Policy denies grants matching a selector or requires every target of a concept to have a grant matching it
+type Policy struct {
+	Name        string    `json:"name" yaml:"name"`
+	Description string    `json:"description,omitempty" yaml:"description,omitempty"`
+	Concept     string    `json:"concept" yaml:"concept"`
+	Deny        *Selector `json:"deny,omitempty" yaml:"deny,omitempty"`
+	Require     *Selector `json:"require,omitempty" yaml:"require,omitempty"`
+}
+
+// Selector matches grants. Targets, principals and excluded principals are patterns in which * matches any
+// characters. A grant matches if it has any of the permissions. Empty fields match every grant, except for the rule
+// type which selects grants unless prohibit is given
+type Selector struct {
+	Type             string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Targets          []string `json:"targets,omitempty" yaml:"targets,omitempty"`
+	Principals       []string `json:"principals,omitempty" yaml:"principals,omitempty"`
+	ExceptPrincipals []string `json:"exceptPrincipals,omitempty" yaml:"exceptPrincipals,omitempty"`
+	GrantType        string   `json:"grantType,omitempty" yaml:"grantType,omitempty"`
+	Permissions      []string `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+}
+
+// Grant is a permission or membership given (or prohibited) to a principal on a target by the model: an object URI of the matrix, a
+// folder of an IPAP, a CASLIB of a DAP or a custom group
+type Grant struct {
+	Concept     string
+	Type        string
+	Target      string
+	Principal   string
+	GrantType   string
+	Permissions []string
+	Pattern     string
+	Location    fi.Location
+	Column      int
+}
+
+// Target is an object URI, folder, CASLIB or custom group of the model
+type Target struct {
+	Concept  string
+	Name     string
+	Location fi.Location
+	Column   int
+}
+
+// Read a policy file. Files with a .yaml or .yml extension are read as YAML, all others as JSON. Unknown keys are
+// rejected, so that a typo cannot silently disable a guardrail
+func Read(path string) (*Policies, error) {
+	zap.S().Debugw("Reading policy file", "path", path)
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	p := new(Policies)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.UnmarshalStrict(body, p); err != nil {
+			return nil, fmt.Errorf("unmarshalling YAML file %s: %w", path, err)
+		}
+	default:
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(p); err != nil {
+			return nil, fmt.Errorf("unmarshalling JSON file %s: %w", path, err)
+		}
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("validating policy file %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Validate the policies for missing names, unknown concepts and selectors
+func (p *Policies) Validate() error {
+	names := make(map[string]bool)
+	for i, policy := range p.Policies {
+		if policy.Name == "" {
+			return fmt.Errorf("policy %d has no name", i+1)
+		}
+		if names[policy.Name] {
+			return fmt.Errorf("policy %s is defined more than once", policy.Name)
+		}
+		names[policy.Name] = true
+		switch policy.Concept {
+		case Groups, Matrix, IPAP, DAP:
+		default:
+			return fmt.Errorf("policy %s has concept %q, expected groups, matrix, ipap or dap", policy.Name, policy.Concept)
+		}
+		if (policy.Deny == nil) == (policy.Require == nil) {
+			return fmt.Errorf("policy %s needs either deny or require", policy.Name)
+		}
+		for _, s := range []*Selector{policy.Deny, policy.Require} {
+			if s != nil && s.GrantType != "" && (policy.Concept != IPAP || (s.GrantType != "object" && s.GrantType != "conveyed")) {
+				return fmt.Errorf("policy %s has grant type %q, expected object or conveyed for concept ipap", policy.Name, s.GrantType)
+			}
+			if s != nil && s.Type != "" && ((policy.Concept != Matrix && policy.Concept != IPAP) || (s.Type != "grant" && s.Type != "prohibit")) {
+				return fmt.Errorf("policy %s has type %q, expected grant or prohibit for concept matrix or ipap", policy.Name, s.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate the policies against the grants of the model files and return a diagnostic per violation. Denied grants
+// are reported on the row defining the grant, targets without a required grant on the row defining the target
+func (p *Policies) Evaluate(files mo.Files) []mo.Diagnostic {
+	grants, targets := Grants(files)
+	var violations []mo.Diagnostic
+	for _, policy := range p.Policies {
+		var rationale string = "policy " + policy.Name
+		if policy.Description != "" {
+			rationale += " (" + policy.Description + ")"
+		}
+		if policy.Deny != nil {
+			for _, g := range grants {
+				if permissions, matches := policy.Deny.match(policy.Concept, g); matches {
+					violations = append(violations, mo.Diagnostic{Location: g.Location, Column: g.Column, Severity: mo.Error, Message: fmt.Sprintf("%s violates %s", describe(g, permissions), rationale)})
+				}
+			}
+		}
+		if policy.Require != nil {
+			for _, t := range targets {
+				if t.Concept != policy.Concept || !matchesAny(policy.Require.Targets, t.Name) {
+					continue
+				}
+				var granted bool
+				for _, g := range grants {
+					if g.Target == t.Name {
+						if _, matches := policy.Require.match(policy.Concept, g); matches {
+							granted = true
+							break
+						}
+					}
+				}
+				if !granted {
+					violations = append(violations, mo.Diagnostic{Location: t.Location, Column: t.Column, Severity: mo.Error, Message: fmt.Sprintf("%s %s has no grant required by %s", noun(t.Concept), t.Name, rationale)})
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// Grants returns the grants and targets of the model files. The grants of an IPAP or DAP are expanded for every
+// folder or CASLIB it is applied to
+func Grants(files mo.Files) (grants []Grant, targets []Target) {
+	seen := make(map[string]bool)
+	addTarget := func(t Target) {
+		if !seen[t.Concept+"\x00"+t.Name] {
+			seen[t.Concept+"\x00"+t.Name] = true
+			targets = append(targets, t)
+		}
+	}
+	for _, r := range files.Groups {
+		addTarget(Target{Concept: Groups, Name: r.GroupID, Location: r.Location, Column: 1})
+		if r.ParentGroupID != "" {
+			grants = append(grants, Grant{Concept: Groups, Type: "grant", Target: r.ParentGroupID, Principal: r.GroupID, Location: r.Location, Column: 1})
+		}
+		if r.UserID != "" {
+			grants = append(grants, Grant{Concept: Groups, Type: "grant", Target: r.GroupID, Principal: r.UserID, Location: r.Location, Column: 3})
+		}
+	}
+	for _, r := range files.Matrix {
+		if r.URI == "" {
+			continue
+		}
+		addTarget(Target{Concept: Matrix, Name: r.URI, Location: r.Location, Column: 0})
+		grants = append(grants, Grant{Concept: Matrix, Type: r.RuleType(), Target: r.URI, Principal: r.Principal, Permissions: r.Permissions, Location: r.Location, Column: 1})
+	}
+	for _, f := range files.IPAPFolders {
+		var directory string = strings.TrimSuffix(f.Directory, "/")
+		addTarget(Target{Concept: IPAP, Name: directory, Location: f.Location, Column: 0})
+		for _, r := range files.IPAPPatterns {
+			if f.Pattern != "" && r.Pattern == f.Pattern {
+				grants = append(grants, Grant{Concept: IPAP, Type: r.RuleType(), Target: directory, Principal: r.Principal, GrantType: r.GrantType, Permissions: r.Permissions, Pattern: r.Pattern, Location: r.Location, Column: 1})
+			}
+		}
+	}
+	for _, c := range files.DAPCASLIBs {
+		addTarget(Target{Concept: DAP, Name: c.CASLIB, Location: c.Location, Column: 0})
+		for _, r := range files.DAPPatterns {
+			if r.Pattern == c.Pattern {
+				grants = append(grants, Grant{Concept: DAP, Type: "grant", Target: c.CASLIB, Principal: r.Principal, Permissions: r.Permissions, Pattern: r.Pattern, Location: r.Location, Column: 1})
+			}
+		}
+	}
+	return grants, targets
+}
+
+// match checks whether a grant of a concept matches the selector and returns the matching permissions
+func (s *Selector) match(concept string, g Grant) ([]string, bool) {
+	var ruleType string = s.Type
+	if ruleType == "" {
+		ruleType = "grant"
+	}
+	if g.Concept != concept || g.Type != ruleType || !matchesAny(s.Targets, g.Target) || !matchesAny(s.Principals, g.Principal) {
+		return nil, false
+	}
+	if len(s.ExceptPrincipals) > 0 && matchesAny(s.ExceptPrincipals, g.Principal) {
+		return nil, false
+	}
+	if s.GrantType != "" && s.GrantType != g.GrantType {
+		return nil, false
+	}
+	if len(s.Permissions) == 0 {
+		return g.Permissions, true
+	}
+	var permissions []string
+	for _, permission := range g.Permissions {
+		for _, selected := range s.Permissions {
+			if permission == selected {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions, len(permissions) > 0
+}
+
+// matchesAny checks whether a value matches any of the patterns. No patterns match every value
+func matchesAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if glob(pattern).MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// glob compiles a pattern in which * matches any characters, including the slashes of URIs and folder paths
+func glob(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$")
+}
+
+// describe renders a grant for a violation message
+func describe(g Grant, permissions []string) string {
+	switch g.Concept {
+	case Groups:
+		return fmt.Sprintf("membership of %s in group %s", g.Principal, g.Target)
+	case IPAP:
+		return fmt.Sprintf("%s %s of %s to %s on folder %s by pattern %s", g.GrantType, g.Type, strings.Join(permissions, ","), g.Principal, g.Target, g.Pattern)
+	case DAP:
+		return fmt.Sprintf("grant of %s to %s on CASLIB %s by pattern %s", strings.Join(permissions, ","), g.Principal, g.Target, g.Pattern)
+	default:
+		return fmt.Sprintf("%s of %s to %s on %s", g.Type, strings.Join(permissions, ","), g.Principal, g.Target)
+	}
+}
+
+// noun names the targets of a concept for a violation message
+func noun(concept string) string {
+	switch concept {
+	case Groups:
+		return "group"
+	case IPAP:
+		return "folder"
+	case DAP:
+		return "CASLIB"
+	default:
+		return "URI"
+	}
+}
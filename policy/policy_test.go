@@ -0,0 +1,87 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+)
+
+func TestEvaluateSample(t *testing.T) {
+	p, err := Read("../sample/sample_policy.yaml")
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	m, err := mo.Read("../sample/sample_model.yaml")
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if violations := p.Evaluate(m.Files()); len(violations) != 0 {
+		t.Errorf("Expected: %v, Returned: %v.", nil, violations)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	write := map[string]string{
+		"test_ipap.csv":    "Pattern,Principal,GrantType,Permissions,Type\nipap1,authenticatedUsers,object,\"read,update\",\nipap2,per007,object,\"read,secure\",\nipap2,authenticatedUsers,conveyed,\"update,delete\",prohibit\n",
+		"test_folders.csv": "Directory,Pattern\n/Projects/A,ipap1\n/Projects/B,ipap2\n/Other,ipap1\n",
+		"test_dap.csv":     "Pattern,Principal,Permissions\ndap1,SASAdministrators,manageAccess\ndap1,per007,\"readInfo,manageAccess\"\n",
+		"test_caslibs.csv": "CASLIB,Pattern\ntestcas1,dap1\n",
+		"test_groups.csv":  "ParentGroupID,GroupID,GroupName,UserID\nSASAdministrators,per007,Persona: Administrator,Hamish\n",
+	}
+	for name, content := range write {
+		ioutil.WriteFile(name, []byte(content), 0644)
+		defer os.Remove(name)
+	}
+	var files mo.Files
+	files.IPAPPatterns, _ = mo.ReadIPAPPatterns("test_ipap.csv")
+	files.IPAPFolders, _ = mo.ReadIPAPFolders("test_folders.csv")
+	files.DAPPatterns, _ = mo.ReadDAPPatterns("test_dap.csv")
+	files.DAPCASLIBs, _ = mo.ReadDAPCASLIBs("test_caslibs.csv")
+	files.Groups, _ = mo.ReadGroups("test_groups.csv")
+	p := &Policies{Policies: []Policy{
+		{Name: "read-only", Concept: IPAP, Deny: &Selector{Principals: []string{"authenticatedUsers"}, Permissions: []string{"update", "delete"}}},
+		{Name: "manage-access", Description: "administrators only", Concept: DAP, Deny: &Selector{ExceptPrincipals: []string{"SAS*"}, Permissions: []string{"manageAccess"}}},
+		{Name: "owner", Concept: IPAP, Require: &Selector{Targets: []string{"/Projects/*"}, Principals: []string{"per*"}, GrantType: "object", Permissions: []string{"secure"}}},
+		{Name: "no-direct-administrators", Concept: Groups, Deny: &Selector{Targets: []string{"SASAdministrators"}}},
+	}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	expected := []string{
+		"test_ipap.csv:2:2: error: object grant of update to authenticatedUsers on folder /Projects/A by pattern ipap1 violates policy read-only",
+		"test_ipap.csv:2:2: error: object grant of update to authenticatedUsers on folder /Other by pattern ipap1 violates policy read-only",
+		"test_dap.csv:3:2: error: grant of manageAccess to per007 on CASLIB testcas1 by pattern dap1 violates policy manage-access (administrators only)",
+		"test_folders.csv:2:1: error: folder /Projects/A has no grant required by policy owner",
+		"test_groups.csv:2:2: error: membership of per007 in group SASAdministrators violates policy no-direct-administrators",
+	}
+	var returned []string
+	for _, d := range p.Evaluate(files) {
+		returned = append(returned, d.String())
+	}
+	if !reflect.DeepEqual(expected, returned) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	for name, write := range map[string]string{
+		"unknown key":     "policies:\n  - name: p1\n    concept: ipap\n    deny:\n      principal: [authenticatedUsers]\n",
+		"unknown concept": "policies:\n  - name: p1\n    concept: folders\n    deny: {}\n",
+		"no selector":     "policies:\n  - name: p1\n    concept: ipap\n",
+		"both selectors":  "policies:\n  - name: p1\n    concept: ipap\n    deny: {}\n    require: {}\n",
+		"grant type":      "policies:\n  - name: p1\n    concept: dap\n    deny: {grantType: object}\n",
+		"duplicate name":  "policies:\n  - {name: p1, concept: ipap, deny: {}}\n  - {name: p1, concept: dap, deny: {}}\n",
+	} {
+		ioutil.WriteFile("test.yaml", []byte(write), 0644)
+		if _, err := Read("test.yaml"); err == nil {
+			t.Errorf("Expected: %v, Returned: %v.", name+" error", err)
+		}
+	}
+	os.Remove("test.yaml")
+}
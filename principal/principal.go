@@ -4,8 +4,11 @@
 package principal
 
 import (
+	"encoding/json"
+	"fmt"
+
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
-	"github.com/spf13/viper"
+	jo "github.com/sassoftware/sas-viya-authorization-model/journal"
 	"go.uber.org/zap"
 )
 
@@ -23,7 +26,7 @@ type Principal struct {
 }
 
 // Create a SAS Viya principal if it does not already exist
-func (p *Principal) Create() {
+func (p *Principal) Create() error {
 	if !p.Exists && p.Type == "group" {
 		zap.S().Infow("Creating custom group", "id", p.ID, "name", p.Name)
 		if p.Description == "" {
@@ -35,43 +38,82 @@ func (p *Principal) Create() {
 		if p.Name == "" {
 			p.Name = p.ID
 		}
-		p.Connection.Call("POST", "/identities/groups", "application/vnd.sas.identity.group+json", "", nil, []byte(`{"id": "`+p.ID+`", "name": "`+p.Name+`", "description": "`+p.Description+`"}`))
+		if p.Connection.Plan != nil {
+			p.Connection.Plan.Add("create", "group", p.ID, map[string]interface{}{"name": p.Name, "description": p.Description})
+			p.Exists = true
+			return nil
+		}
+		if _, _, err := p.Connection.Call("POST", "/identities/groups", "application/vnd.sas.identity.group+json", "", nil, p.body()); err != nil {
+			return fmt.Errorf("creating custom group %s: %w", p.ID, err)
+		}
 		p.Exists = true
+		return p.Connection.Record("create", "group", p.ID, &jo.Request{Action: "delete", Method: "DELETE", Path: "/identities/groups/" + p.ID})
 	}
+	return nil
 }
 
 // Nest a SAS Viya principal if it has parents
-func (p *Principal) Nest() {
-	if p.Exists && p.Type == "group" && p.Parents != nil {
+func (p *Principal) Nest() error {
+	if (p.Exists && p.Type == "group" || p.Type == "user") && p.Parents != nil {
 		for _, parent := range p.Parents {
-			zap.S().Infow("Nesting custom group", "id", p.ID, "parentid", parent.ID)
-			p.Connection.Call("PUT", "/identities/groups/"+parent.ID+"/groupMembers/"+p.ID, "", "", nil, nil)
+			if err := p.NestIn(parent); err != nil {
+				return err
+			}
 		}
 		p.Parents = nil
-	} else if p.Type == "user" && p.Parents != nil {
-		for _, parent := range p.Parents {
-			zap.S().Infow("Nesting user", "groupID", parent.ID, "userID", p.ID)
-			p.Connection.Call("PUT", "/identities/groups/"+parent.ID+"/userMembers/"+p.ID, "", "", nil, nil)
+	}
+	return nil
+}
+
+// NestIn adds a SAS Viya principal as member of a single parent group without modifying its parents
+func (p *Principal) NestIn(parent *Principal) error {
+	if p.Exists && p.Type == "group" {
+		zap.S().Infow("Nesting custom group", "id", p.ID, "parentid", parent.ID)
+		if p.Connection.Plan != nil {
+			p.Connection.Plan.Add("add", "membership", parent.ID, map[string]interface{}{"group": p.ID})
+			return nil
 		}
-		p.Parents = nil
+		if _, _, err := p.Connection.Call("PUT", "/identities/groups/"+parent.ID+"/groupMembers/"+p.ID, "", "", nil, nil); err != nil {
+			return fmt.Errorf("nesting custom group %s in %s: %w", p.ID, parent.ID, err)
+		}
+		return p.Connection.Record("add", "membership", parent.ID, &jo.Request{Action: "remove", Method: "DELETE", Path: "/identities/groups/" + parent.ID + "/groupMembers/" + p.ID})
+	} else if p.Type == "user" {
+		zap.S().Infow("Nesting user", "groupID", parent.ID, "userID", p.ID)
+		if p.Connection.Plan != nil {
+			p.Connection.Plan.Add("add", "membership", parent.ID, map[string]interface{}{"user": p.ID})
+			return nil
+		}
+		if _, _, err := p.Connection.Call("PUT", "/identities/groups/"+parent.ID+"/userMembers/"+p.ID, "", "", nil, nil); err != nil {
+			return fmt.Errorf("nesting user %s in %s: %w", p.ID, parent.ID, err)
+		}
+		return p.Connection.Record("add", "membership", parent.ID, &jo.Request{Action: "remove", Method: "DELETE", Path: "/identities/groups/" + parent.ID + "/userMembers/" + p.ID})
 	}
+	return nil
 }
 
 // Validate whether a SAS Viya principal exists
-func (p *Principal) Validate() {
+func (p *Principal) Validate() error {
 	if p.Type == "group" {
 		zap.S().Debugw("Validating custom group", "id", p.ID)
-		search, _ := p.Connection.Call("GET", "/identities/groups", "", "", [][]string{
+		search, _, err := p.Connection.Call("GET", "/identities/groups", "", "", [][]string{
 			0: {
 				"filter",
 				"eq(id,'" + p.ID + "')",
 			},
 			1: {
 				"limit",
-				viper.GetString("responselimit"),
+				p.Connection.ResponseLimit(),
 			},
 		}, nil)
-		if search.(map[string]interface{})["count"].(float64) == 0 {
+		if err != nil {
+			return fmt.Errorf("validating custom group %s: %w", p.ID, err)
+		}
+		result, _ := search.(map[string]interface{})
+		count, ok := result["count"].(float64)
+		if !ok {
+			return fmt.Errorf("validating custom group %s: %w", p.ID, co.ErrUnexpectedResponse)
+		}
+		if count == 0 {
 			zap.S().Debugw("Custom group does not exist", "id", p.ID)
 			p.Exists = false
 		} else {
@@ -79,73 +121,223 @@ func (p *Principal) Validate() {
 			p.Exists = true
 		}
 	}
+	return nil
 }
 
-// Delete a SAS Viya principal
-func (p *Principal) Delete() {
+// Delete a SAS Viya principal. With a journal, the direct members and parent groups of a custom group are recorded
+// as removed memberships before the group itself, so that a rollback creates the group again before its memberships
+func (p *Principal) Delete() error {
 	if p.ID != "SASAdministrators" && p.Type == "group" {
 		zap.S().Infow("Deleting custom group", "id", p.ID)
-		p.Connection.Call("DELETE", "/identities/groups/"+p.ID, "", "", nil, nil)
+		if p.Connection.Plan != nil {
+			p.Connection.Plan.Add("delete", "group", p.ID, nil)
+			p.Exists = false
+			return nil
+		}
+		var parents []string
+		if p.Connection.Journal != nil {
+			if err := p.GetDirectMembers(); err != nil {
+				return err
+			}
+			var err error
+			if parents, err = p.memberships(); err != nil {
+				return err
+			}
+		}
+		if _, _, err := p.Connection.Call("DELETE", "/identities/groups/"+p.ID, "", "", nil, nil); err != nil {
+			return fmt.Errorf("deleting custom group %s: %w", p.ID, err)
+		}
 		p.Exists = false
+		if p.Connection.Journal == nil {
+			return nil
+		}
+		for _, member := range p.Members {
+			if err := p.Connection.Record("remove", "membership", p.ID, &jo.Request{Action: "add", Method: "PUT", Path: "/identities/groups/" + p.ID + "/" + member.Type + "Members/" + member.ID}); err != nil {
+				return err
+			}
+		}
+		for _, parent := range parents {
+			if err := p.Connection.Record("remove", "membership", parent, &jo.Request{Action: "add", Method: "PUT", Path: "/identities/groups/" + parent + "/groupMembers/" + p.ID}); err != nil {
+				return err
+			}
+		}
+		return p.Connection.Record("delete", "group", p.ID, &jo.Request{Action: "create", Method: "POST", Path: "/identities/groups", ContentType: "application/vnd.sas.identity.group+json", Body: p.body()})
 	}
+	return nil
+}
+
+// memberships returns the IDs of the custom groups a SAS Viya principal is a direct member of
+func (p *Principal) memberships() ([]string, error) {
+	items := p.Connection.Collection("/identities/"+p.Type+"s/"+p.ID+"/memberships", [][]string{
+		0: {
+			"limit",
+			p.Connection.ResponseLimit(),
+		},
+	})
+	var parents []string
+	for items.Next() {
+		id, _ := items.Item()["id"].(string)
+		parents = append(parents, id)
+	}
+	if err := items.Err(); err != nil {
+		return nil, fmt.Errorf("listing memberships of %s %s: %w", p.Type, p.ID, err)
+	}
+	return parents, nil
+}
+
+// body returns the custom group as sent to SAS Viya when it is created
+func (p *Principal) body() []byte {
+	body, _ := json.Marshal(map[string]string{"id": p.ID, "name": p.Name, "description": p.Description})
+	return body
+}
+
+// Groups returns all SAS Viya custom groups
+func Groups(connection *co.Connection) ([]*Principal, error) {
+	zap.S().Debugw("Listing custom groups")
+	items := connection.Collection("/identities/groups", [][]string{
+		0: {
+			"providerId",
+			"local",
+		},
+		1: {
+			"limit",
+			connection.ResponseLimit(),
+		},
+	})
+	var groups []*Principal
+	for items.Next() {
+		g := new(Principal)
+		g.ID, _ = items.Item()["id"].(string)
+		g.Name, _ = items.Item()["name"].(string)
+		g.Description, _ = items.Item()["description"].(string)
+		g.Type = "group"
+		g.Exists = true
+		g.Connection = connection
+		if g.ID == "" {
+			return nil, fmt.Errorf("listing custom groups: %w", co.ErrUnexpectedResponse)
+		}
+		groups = append(groups, g)
+	}
+	if err := items.Err(); err != nil {
+		return nil, fmt.Errorf("listing custom groups: %w", err)
+	}
+	return groups, nil
 }
 
 // GetMembers of a SAS Viya principal
-func (p *Principal) GetMembers() {
+func (p *Principal) GetMembers() error {
 	if p.Type == "group" {
-		search, _ := p.Connection.Call("GET", "/identities/groups/"+p.ID+"/members", "", "", [][]string{
+		members := p.Connection.Collection("/identities/groups/"+p.ID+"/members", [][]string{
 			0: {
 				"showDuplicates",
 				"true",
 			},
 			1: {
 				"limit",
-				viper.GetString("responselimit"),
+				p.Connection.ResponseLimit(),
 			},
 			2: {
 				"depth",
 				"-1",
 			},
-		}, nil)
-		if search.(map[string]interface{})["count"] == "0" {
+		})
+		p.Members = nil
+		for members.Next() {
+			m := new(Principal)
+			m.ID, _ = members.Item()["id"].(string)
+			m.Type, _ = members.Item()["type"].(string)
+			p.Members = append(p.Members, m)
+		}
+		if err := members.Err(); err != nil {
+			return fmt.Errorf("listing members of custom group %s: %w", p.ID, err)
+		}
+		if p.Members == nil {
 			zap.S().Debugw("Custom group does not have any members", "id", p.ID)
-			p.Members = nil
-		} else {
-			for _, member := range search.(map[string]interface{})["items"].([]interface{}) {
-				m := new(Principal)
-				m.ID = member.(map[string]interface{})["id"].(string)
-				m.Type = member.(map[string]interface{})["type"].(string)
-				p.Members = append(p.Members, m)
+		}
+	}
+	return nil
+}
+
+// GetDirectMembers of a SAS Viya principal, i.e. the users and groups that are members of the group itself
+func (p *Principal) GetDirectMembers() error {
+	if p.Type == "group" {
+		members := p.Connection.Collection("/identities/groups/"+p.ID+"/members", [][]string{
+			0: {
+				"limit",
+				p.Connection.ResponseLimit(),
+			},
+		})
+		p.Members = nil
+		for members.Next() {
+			m := new(Principal)
+			m.ID, _ = members.Item()["id"].(string)
+			m.Type, _ = members.Item()["type"].(string)
+			p.Members = append(p.Members, m)
+		}
+		if err := members.Err(); err != nil {
+			return fmt.Errorf("listing members of custom group %s: %w", p.ID, err)
+		}
+	}
+	return nil
+}
+
+// HasMember reports whether a principal is among the members of a SAS Viya principal
+func (p *Principal) HasMember(member *Principal) bool {
+	for _, m := range p.Members {
+		if m.ID == member.ID && m.Type == member.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// GetParents of a SAS Viya principal, i.e. the groups a user or group is a direct member of
+func (p *Principal) GetParents() error {
+	if p.Type == "group" || p.Type == "user" {
+		memberships := p.Connection.Collection("/identities/"+p.Type+"s/"+p.ID+"/memberships", [][]string{
+			0: {
+				"limit",
+				p.Connection.ResponseLimit(),
+			},
+		})
+		p.Parents = nil
+		for memberships.Next() {
+			g := new(Principal)
+			g.ID, _ = memberships.Item()["id"].(string)
+			g.Name, _ = memberships.Item()["name"].(string)
+			g.Type = "group"
+			g.Exists = true
+			g.Connection = p.Connection
+			if g.ID == "" {
+				return fmt.Errorf("listing memberships of %s %s: %w", p.Type, p.ID, co.ErrUnexpectedResponse)
 			}
+			p.Parents = append(p.Parents, g)
+		}
+		if err := memberships.Err(); err != nil {
+			return fmt.Errorf("listing memberships of %s %s: %w", p.Type, p.ID, err)
 		}
 	}
+	return nil
 }
 
 // DeleteMembers of a SAS Viya principal
-func (p *Principal) DeleteMembers() {
+func (p *Principal) DeleteMembers() error {
 	if p.ID != "SASAdministrators" && p.Type == "group" && p.Members != nil {
 		for _, member := range p.Members {
-			if member.Type == "group" {
-				zap.S().Infow("Deleting group membership", "id", p.ID, "memberID", member.ID)
-				p.Connection.Call("DELETE", "/identities/groups/"+p.ID+"/groupMembers/"+member.ID, "", "", nil, nil)
-			} else if member.Type == "user" {
-				zap.S().Infow("Deleting group membership", "id", p.ID, "memberID", member.ID)
-				p.Connection.Call("DELETE", "/identities/groups/"+p.ID+"/userMembers/"+member.ID, "", "", nil, nil)
+			if err := p.removeMember(member.Type, member.ID); err != nil {
+				return err
 			}
 		}
 		p.Members = nil
 	}
+	return nil
 }
 
 // DeleteMember of a SAS Viya principal
-func (p *Principal) DeleteMember(Type string, ID string) {
+func (p *Principal) DeleteMember(Type string, ID string) error {
 	var tmp []*Principal
-	if Type == "group" {
-		zap.S().Infow("Deleting group membership", "id", p.ID, "memberID", ID)
-		p.Connection.Call("DELETE", "/identities/groups/"+p.ID+"/groupMembers/"+ID, "", "", nil, nil)
-	} else if Type == "user" {
-		zap.S().Infow("Deleting group membership", "id", p.ID, "memberID", ID)
-		p.Connection.Call("DELETE", "/identities/groups/"+p.ID+"/userMembers/"+ID, "", "", nil, nil)
+	if err := p.removeMember(Type, ID); err != nil {
+		return err
 	}
 	for _, member := range p.Members {
 		if member.ID != ID {
@@ -154,4 +346,21 @@ func (p *Principal) DeleteMember(Type string, ID string) {
 	}
 	p.Members = nil
 	p.Members = tmp
+	return nil
+}
+
+// removeMember deletes a single user or group membership of a SAS Viya principal
+func (p *Principal) removeMember(Type string, ID string) error {
+	if Type != "group" && Type != "user" {
+		return nil
+	}
+	zap.S().Infow("Deleting group membership", "id", p.ID, "memberID", ID)
+	if p.Connection.Plan != nil {
+		p.Connection.Plan.Add("remove", "membership", p.ID, map[string]interface{}{Type: ID})
+		return nil
+	}
+	if _, _, err := p.Connection.Call("DELETE", "/identities/groups/"+p.ID+"/"+Type+"Members/"+ID, "", "", nil, nil); err != nil {
+		return fmt.Errorf("deleting %s %s from custom group %s: %w", Type, ID, p.ID, err)
+	}
+	return p.Connection.Record("remove", "membership", p.ID, &jo.Request{Action: "add", Method: "PUT", Path: "/identities/groups/" + p.ID + "/" + Type + "Members/" + ID})
 }
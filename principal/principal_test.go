@@ -6,9 +6,11 @@ package principal
 import (
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	pl "github.com/sassoftware/sas-viya-authorization-model/plan"
 )
 
 func TestCreate(t *testing.T) {
@@ -58,6 +60,31 @@ func TestNest(t *testing.T) {
 	p.Nest()
 }
 
+func TestNestIn(t *testing.T) {
+	var returned string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		returned = req.Method + " " + req.URL.Path
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.Connected = true
+	parent := &Principal{ID: "parent1", Type: "group"}
+	p := &Principal{ID: "testuser", Type: "user", Connection: co}
+	if err := p.NestIn(parent); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	var expected string = "PUT /identities/groups/parent1/userMembers/testuser"
+	if returned != expected {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+	if p.Parents != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, p.Parents)
+	}
+}
+
 func TestValidate(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		rw.WriteHeader(http.StatusOK)
@@ -188,3 +215,59 @@ func TestDeleteMember(t *testing.T) {
 		t.Errorf("Expected: %v, Returned: %v.", 1, len(p.Members))
 	}
 }
+
+func TestPlan(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Errorf("Unexpected request in plan mode: %s %s.", req.Method, req.URL.String())
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.Connected = true
+	co.Plan = new(pl.Plan)
+	parent := new(Principal)
+	parent.ID = "parent1"
+	p := new(Principal)
+	p.Connection = co
+	p.ID = "testgroup"
+	p.Type = "group"
+	p.Parents = append(p.Parents, parent)
+	p.Create()
+	p.Nest()
+	p.Members = append(p.Members, &Principal{ID: "testuser", Type: "user"})
+	p.DeleteMembers()
+	p.Delete()
+	var returned []string
+	for _, c := range co.Plan.Changes {
+		returned = append(returned, c.Action+" "+c.Resource)
+	}
+	expected := []string{"create group", "add membership", "remove membership", "delete group"}
+	if !reflect.DeepEqual(returned, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
+
+func TestCreateError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusConflict)
+		rw.Write([]byte(`{"errorCode": 0, "message": "Group already exists.", "httpStatusCode": 409}`))
+	}))
+	defer server.Close()
+	co := new(co.Connection)
+	co.BaseURL = server.URL
+	co.AccessToken = "testaccesstoken"
+	co.Connected = true
+	p := new(Principal)
+	p.Connection = co
+	p.ID = "testgroup"
+	p.Type = "group"
+	err := p.Create()
+	if err == nil {
+		t.Fatal("Expected an error when the group cannot be created.")
+	}
+	if p.Exists {
+		t.Errorf("Expected: %v, Returned: %v.", false, p.Exists)
+	}
+}
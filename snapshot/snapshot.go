@@ -0,0 +1,469 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
+	ca "github.com/sassoftware/sas-viya-authorization-model/cas"
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	fi "github.com/sassoftware/sas-viya-authorization-model/file"
+	fo "github.com/sassoftware/sas-viya-authorization-model/folder"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+	"go.uber.org/zap"
+)
+
+// contentID matches the ID of a content object in its URI, e.g. of a report
+var contentID = regexp.MustCompile(`/[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}(/|$)`)
+
+// Version of the snapshot format. Snapshots of a later version cannot be read
+const Version = 1
+
+// Snapshot is the authorization state of a SAS Viya environment at a point in time
+type Snapshot struct {
+	Version   int       `json:"version"`
+	Created   time.Time `json:"created"`
+	BaseURL   string    `json:"baseUrl"`
+	CASServer string    `json:"casServer"`
+	Groups    []Group   `json:"groups"`
+	Folders   []Folder  `json:"folders"`
+	Rules     []Rule    `json:"rules"`
+	CASLIBs   []CASLIB  `json:"caslibs"`
+}
+
+// Group is a custom group with its direct group and user members
+type Group struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Members     []Member `json:"members,omitempty"`
+}
+
+// Member of a custom group
+type Member struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// Folder is a folder of the folder tree, listed after its parent folder
+type Folder struct {
+	Path string `json:"path"`
+	URI  string `json:"uri"`
+}
+
+// Rule is an authorization rule. URIs of folders are those at the time of the snapshot and are resolved by the folder
+// path on restore, as folders that were created again have a different URI
+type Rule struct {
+	ID                  string   `json:"id"`
+	Type                string   `json:"type"`
+	Principal           string   `json:"principal,omitempty"`
+	PrincipalType       string   `json:"principalType"`
+	Permissions         []string `json:"permissions"`
+	ObjectURI           string   `json:"objectUri,omitempty"`
+	ContainerURI        string   `json:"containerUri,omitempty"`
+	Condition           string   `json:"condition,omitempty"`
+	MediaType           string   `json:"mediaType,omitempty"`
+	ExpirationTimestamp string   `json:"expirationTimestamp,omitempty"`
+	Reason              string   `json:"reason,omitempty"`
+	Description         string   `json:"description,omitempty"`
+	Enabled             string   `json:"enabled,omitempty"`
+}
+
+// CASLIB is a global scope CASLIB with its direct CAS access controls
+type CASLIB struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Path        string       `json:"path,omitempty"`
+	Type        string       `json:"type,omitempty"`
+	Scope       string       `json:"scope,omitempty"`
+	Controls    []ca.Control `json:"controls"`
+}
+
+// Take a snapshot of the custom groups, folder tree, authorization rules and CASLIB access controls
+func Take(connection *co.Connection) (*Snapshot, error) {
+	zap.S().Infow("Taking snapshot of the authorization state", "baseURL", connection.BaseURL)
+	s := &Snapshot{Version: Version, Created: time.Now().UTC(), BaseURL: connection.BaseURL, CASServer: connection.CASServer}
+	if err := s.takeGroups(connection); err != nil {
+		return nil, err
+	}
+	if err := s.takeFolders(connection); err != nil {
+		return nil, err
+	}
+	rules, err := au.List(connection, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		s.Rules = append(s.Rules, Rule{
+			ID:                  rule.IDs[0],
+			Type:                rule.Type,
+			Principal:           rule.Principal.ID,
+			PrincipalType:       rule.Principal.Type,
+			Permissions:         rule.Permissions,
+			ObjectURI:           rule.ObjectURI,
+			ContainerURI:        rule.ContainerURI,
+			Condition:           rule.Condition,
+			MediaType:           rule.MediaType,
+			ExpirationTimestamp: rule.ExpirationTimeStamp,
+			Reason:              rule.Reason,
+			Description:         rule.Description,
+			Enabled:             rule.Enabled,
+		})
+	}
+	libs, err := ca.List(connection)
+	if err != nil {
+		return nil, err
+	}
+	for _, lib := range libs {
+		controls, err := lib.Controls()
+		if err != nil {
+			return nil, err
+		}
+		s.CASLIBs = append(s.CASLIBs, CASLIB{Name: lib.Name, Description: lib.Description, Path: lib.Path, Type: lib.Type, Scope: lib.Scope, Controls: controls})
+	}
+	sort.Slice(s.CASLIBs, func(i, j int) bool {
+		return s.CASLIBs[i].Name < s.CASLIBs[j].Name
+	})
+	zap.S().Infow("Took snapshot", "groups", len(s.Groups), "folders", len(s.Folders), "rules", len(s.Rules), "CASLIBs", len(s.CASLIBs))
+	return s, nil
+}
+
+// takeGroups reads all custom groups with their direct members
+func (s *Snapshot) takeGroups(connection *co.Connection) error {
+	groups, err := pr.Groups(connection)
+	if err != nil {
+		return err
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+	for _, g := range groups {
+		group := Group{ID: g.ID, Name: g.Name, Description: g.Description}
+		members := connection.Collection("/identities/groups/"+g.ID+"/members", [][]string{
+			0: {
+				"limit",
+				connection.ResponseLimit(),
+			},
+		})
+		for members.Next() {
+			id, _ := members.Item()["id"].(string)
+			memberType, _ := members.Item()["type"].(string)
+			group.Members = append(group.Members, Member{ID: id, Type: memberType})
+		}
+		if err := members.Err(); err != nil {
+			return fmt.Errorf("reading members of custom group %s: %w", g.ID, err)
+		}
+		s.Groups = append(s.Groups, group)
+	}
+	return nil
+}
+
+// takeFolders walks the folder tree breadth first, so that every folder is listed after its parent
+func (s *Snapshot) takeFolders(connection *co.Connection) error {
+	queue, err := fo.Roots(connection)
+	if err != nil {
+		return err
+	}
+	for len(queue) > 0 {
+		f := queue[0]
+		queue = queue[1:]
+		s.Folders = append(s.Folders, Folder{Path: f.Path, URI: f.URI})
+		children, err := f.Children()
+		if err != nil {
+			return err
+		}
+		queue = append(queue, children...)
+	}
+	return nil
+}
+
+// Exclude removes the folders below the given paths and the rules on them from the snapshot, e.g. the folders of
+// individual users that differ between environments
+func (s *Snapshot) Exclude(paths []string) {
+	excluded := make(map[string]bool)
+	var folders []Folder
+	for _, f := range s.Folders {
+		if below(f.Path, paths) {
+			excluded[f.URI] = true
+		} else {
+			folders = append(folders, f)
+		}
+	}
+	var rules []Rule
+	for _, rule := range s.Rules {
+		if !excluded[folder(rule.ObjectURI)] && !excluded[folder(rule.ContainerURI)] {
+			rules = append(rules, rule)
+		}
+	}
+	s.Folders, s.Rules = folders, rules
+}
+
+// ExcludeContent removes the rules on content other than folders from the snapshot, e.g. on reports, as the IDs in
+// their URIs differ between environments
+func (s *Snapshot) ExcludeContent() {
+	var rules []Rule
+	for _, rule := range s.Rules {
+		if !content(rule.ObjectURI) && !content(rule.ContainerURI) {
+			rules = append(rules, rule)
+		}
+	}
+	s.Rules = rules
+}
+
+// Excluded returns the URIs of the current folders below the given paths
+func Excluded(connection *co.Connection, paths []string) (map[string]bool, error) {
+	excluded := make(map[string]bool)
+	var queue []*fo.Folder
+	for _, path := range paths {
+		f := &fo.Folder{Path: strings.TrimSuffix(path, "/"), Connection: connection}
+		if err := f.Validate(); err != nil {
+			return nil, err
+		}
+		if f.Exists {
+			queue = append(queue, f)
+		}
+	}
+	for len(queue) > 0 {
+		f := queue[0]
+		queue = queue[1:]
+		excluded[f.URI] = true
+		children, err := f.Children()
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, children...)
+	}
+	return excluded, nil
+}
+
+// OnFolder reports whether an authorization rule is on one of the folders
+func OnFolder(rule *au.Authorization, uris map[string]bool) bool {
+	return uris[folder(rule.ObjectURI)] || uris[folder(rule.ContainerURI)]
+}
+
+// OnContent reports whether an authorization rule is on content other than folders
+func OnContent(rule *au.Authorization) bool {
+	return content(rule.ObjectURI) || content(rule.ContainerURI)
+}
+
+// below reports whether a folder path is one of the paths or below it
+func below(path string, paths []string) bool {
+	for _, p := range paths {
+		p = strings.TrimSuffix(p, "/")
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupRows returns the custom groups and memberships of the snapshot as rows of a groups file. Every group is
+// listed on its own before its memberships, so that it keeps its name
+func (s *Snapshot) GroupRows() []mo.GroupRow {
+	var rows []mo.GroupRow
+	names := make(map[string]string)
+	for _, g := range s.Groups {
+		rows = append(rows, mo.GroupRow{GroupID: g.ID, GroupName: g.Name})
+		names[g.ID] = g.Name
+	}
+	for _, g := range s.Groups {
+		for _, m := range g.Members {
+			if m.Type == "group" {
+				rows = append(rows, mo.GroupRow{ParentGroupID: g.ID, GroupID: m.ID, GroupName: names[m.ID]})
+			} else {
+				rows = append(rows, mo.GroupRow{GroupID: g.ID, GroupName: g.Name, UserID: m.ID})
+			}
+		}
+	}
+	return rows
+}
+
+// Files returns the authorization state of the snapshot as model rows located at source, so that policies can be
+// evaluated against it. Capability rules become matrix rows, the rules on every folder an IPAP named after the folder
+// path and the grants on every CASLIB a DAP named after the CASLIB. Disabled rules grant nothing and are skipped
+func (s *Snapshot) Files(source string) mo.Files {
+	location := fi.Location{Path: source}
+	files := mo.Files{Groups: s.GroupRows()}
+	for i := range files.Groups {
+		files.Groups[i].Location = location
+	}
+	folders := make(map[string]string)
+	for _, f := range s.Folders {
+		folders[f.URI] = f.Path
+	}
+	patterns := make(map[string]bool)
+	for _, rule := range s.Rules {
+		if rule.Enabled == "false" {
+			continue
+		}
+		var principal string = rule.Principal
+		if principal == "" {
+			principal = rule.PrincipalType
+		}
+		options := mo.RuleOptions{Type: rule.Type, Condition: rule.Condition, MediaType: rule.MediaType, ExpirationTimestamp: rule.ExpirationTimestamp, Reason: rule.Reason}
+		if rule.ContainerURI == "" && !strings.HasPrefix(rule.ObjectURI, "/folders/") {
+			files.Matrix = append(files.Matrix, mo.CapabilityRow{URI: rule.ObjectURI, Principal: principal, Permissions: rule.Permissions, RuleOptions: options, Location: location})
+			continue
+		}
+		var grantType, uri string = "object", folder(rule.ObjectURI)
+		if rule.ContainerURI != "" {
+			grantType, uri = "conveyed", folder(rule.ContainerURI)
+		}
+		path, exists := folders[uri]
+		if !exists {
+			continue
+		}
+		files.IPAPPatterns = append(files.IPAPPatterns, mo.IPAPRow{Pattern: path, Principal: principal, GrantType: grantType, Permissions: rule.Permissions, RuleOptions: options, Location: location})
+		if !patterns[path] {
+			patterns[path] = true
+			files.IPAPFolders = append(files.IPAPFolders, mo.FolderRow{Directory: path, Pattern: path, Location: location})
+		}
+	}
+	for _, lib := range s.CASLIBs {
+		files.DAPCASLIBs = append(files.DAPCASLIBs, mo.CASLIBRow{CASLIB: lib.Name, Description: lib.Description, Type: lib.Type, Path: lib.Path, Pattern: lib.Name, Location: location})
+		for _, control := range lib.Controls {
+			if control.Type != "grant" {
+				continue
+			}
+			var identity string = control.Identity
+			if identity == "*" {
+				identity = "authenticatedUsers"
+			}
+			files.DAPPatterns = append(files.DAPPatterns, mo.DAPRow{Pattern: lib.Name, Principal: identity, Permissions: []string{control.Permission}, Location: location})
+		}
+	}
+	return files
+}
+
+// Authorizations returns the rules of the snapshot for a connection, with the URIs of snapshot folders replaced by
+// the given current URIs. Rules on snapshot folders without a current URI are skipped
+func (s *Snapshot) Authorizations(connection *co.Connection, uris map[string]string) []*au.Authorization {
+	folders := make(map[string]string)
+	for _, f := range s.Folders {
+		folders[f.URI] = f.Path
+	}
+	var rules []*au.Authorization
+	for _, rule := range s.Rules {
+		var missing string
+		for _, uri := range []string{rule.ObjectURI, rule.ContainerURI} {
+			if path, snapshot := folders[folder(uri)]; snapshot && uris[folder(uri)] == "" {
+				missing = path
+			}
+		}
+		if missing != "" {
+			zap.S().Warnw("Skipping authorization rule on a folder that does not exist", "id", rule.ID, "folder", missing)
+			continue
+		}
+		a := &au.Authorization{
+			Type:                rule.Type,
+			Permissions:         rule.Permissions,
+			ObjectURI:           resolve(rule.ObjectURI, uris),
+			ContainerURI:        resolve(rule.ContainerURI, uris),
+			Condition:           rule.Condition,
+			MediaType:           rule.MediaType,
+			ExpirationTimeStamp: rule.ExpirationTimestamp,
+			Reason:              rule.Reason,
+			Description:         rule.Description,
+			Enabled:             rule.Enabled,
+			Principal:           &pr.Principal{ID: rule.Principal, Type: rule.PrincipalType, Connection: connection},
+		}
+		rules = append(rules, a)
+	}
+	return rules
+}
+
+// LIB returns the CASLIB of the snapshot for a connection, with its access controls as ACL
+func (c CASLIB) LIB(connection *co.Connection) *ca.LIB {
+	lib := &ca.LIB{Name: c.Name, Description: c.Description, Path: c.Path, Type: c.Type, Scope: c.Scope, Connection: connection}
+	for _, control := range c.Controls {
+		lib.ACL = append(lib.ACL, ca.AC{
+			Version:     control.Version,
+			Type:        control.Type,
+			Permissions: []string{control.Permission},
+			Principal:   &pr.Principal{ID: control.Identity, Type: control.IdentityType, Connection: connection},
+			TableFilter: control.TableFilter,
+		})
+	}
+	return lib
+}
+
+// folder returns the folder URI an object or container URI starts with
+func folder(uri string) string {
+	if !strings.HasPrefix(uri, "/folders/folders/") {
+		return ""
+	}
+	return strings.Join(strings.SplitN(uri, "/", 5)[:4], "/")
+}
+
+// content reports whether an object or container URI refers to content other than folders by its ID
+func content(uri string) bool {
+	return folder(uri) == "" && contentID.MatchString(uri)
+}
+
+// resolve replaces the folder URI an object or container URI starts with by its current URI
+func resolve(uri string, uris map[string]string) string {
+	if current, exists := uris[folder(uri)]; exists && folder(uri) != "" {
+		return current + strings.TrimPrefix(uri, folder(uri))
+	}
+	return uri
+}
+
+// Write the snapshot as gzip compressed JSON
+func (s *Snapshot) Write(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return fmt.Errorf("writing snapshot %s: %w", path, err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("writing snapshot %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("writing snapshot %s: %w", path, err)
+	}
+	return nil
+}
+
+// Read a snapshot written by Write. Uncompressed JSON is accepted as well, e.g. after inspecting and editing it
+func Read(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var dec *json.Decoder = json.NewDecoder(r)
+	if magic, _ := r.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot %s: %w", path, err)
+		}
+		defer gz.Close()
+		dec = json.NewDecoder(gz)
+	}
+	s := new(Snapshot)
+	if err := dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("reading snapshot %s: %w", path, err)
+	}
+	if s.Version < 1 || s.Version > Version {
+		return nil, fmt.Errorf("reading snapshot %s: unsupported version %d, expected at most %d", path, s.Version, Version)
+	}
+	return s, nil
+}
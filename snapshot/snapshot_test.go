@@ -0,0 +1,157 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package snapshot
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	ca "github.com/sassoftware/sas-viya-authorization-model/cas"
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	fi "github.com/sassoftware/sas-viya-authorization-model/file"
+	mo "github.com/sassoftware/sas-viya-authorization-model/model"
+)
+
+func TestTake(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/identities/groups":
+			rw.Write([]byte(`{"count": 2, "items": [{"id": "per001", "name": "Persona: Business User"}, {"id": "HR", "name": "Human Resources"}]}`))
+		case "/identities/groups/HR/members":
+			rw.Write([]byte(`{"count": 2, "items": [{"id": "per001", "type": "group"}, {"id": "alice", "type": "user"}]}`))
+		case "/identities/groups/per001/members":
+			rw.Write([]byte(`{"count": 0, "items": []}`))
+		case "/folders/rootFolders":
+			rw.Write([]byte(`{"count": 1, "items": [{"id": "a", "name": "Projects"}]}`))
+		case "/folders/folders/a/members":
+			rw.Write([]byte(`{"count": 1, "items": [{"uri": "/folders/folders/b", "name": "HR"}]}`))
+		case "/folders/folders/b/members":
+			rw.Write([]byte(`{"count": 0, "items": []}`))
+		case "/authorization/rules":
+			rw.Write([]byte(`{"count": 2, "items": [
+				{"id": "rule1", "principal": "HR", "principalType": "group", "type": "grant", "permissions": ["read"], "containerUri": "/folders/folders/b", "enabled": true},
+				{"id": "rule2", "principalType": "authenticatedUsers", "type": "prohibit", "permissions": ["delete"], "objectUri": "/folders/folders/a/**", "enabled": true}
+			]}`))
+		case "/casManagement/servers/cas-shared-default/caslibs":
+			rw.Write([]byte(`{"count": 1, "items": [{"name": "HRDATA", "type": "PATH", "path": "/data/hr/", "scope": "global"}]}`))
+		case "/casAccessManagement/servers/cas-shared-default/caslibControls/HRDATA":
+			rw.Write([]byte(`{"count": 1, "items": [{"identity": "HR", "identityType": "group", "permission": "select", "type": "grant"}]}`))
+		default:
+			t.Errorf("Unexpected request: %s %s.", req.Method, req.URL.String())
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	c := new(co.Connection)
+	c.BaseURL = server.URL
+	c.AccessToken = "testaccesstoken"
+	c.CASServer = "cas-shared-default"
+	c.Connected = true
+	s, err := Take(c)
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if err := s.Write("test.json.gz"); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	defer os.Remove("test.json.gz")
+	read, err := Read("test.json.gz")
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if !read.Created.Equal(s.Created) {
+		t.Errorf("Expected: %v, Returned: %v.", s.Created, read.Created)
+	}
+	read.Created = s.Created
+	if !reflect.DeepEqual(s, read) {
+		t.Errorf("Expected: %v, Returned: %v.", s, read)
+	}
+	folders := []Folder{{"/Projects", "/folders/folders/a"}, {"/Projects/HR", "/folders/folders/b"}}
+	if !reflect.DeepEqual(folders, read.Folders) {
+		t.Errorf("Expected: %v, Returned: %v.", folders, read.Folders)
+	}
+	rows := []mo.GroupRow{{GroupID: "HR", GroupName: "Human Resources"}, {GroupID: "per001", GroupName: "Persona: Business User"}, {ParentGroupID: "HR", GroupID: "per001", GroupName: "Persona: Business User"}, {GroupID: "HR", GroupName: "Human Resources", UserID: "alice"}}
+	if !reflect.DeepEqual(rows, read.GroupRows()) {
+		t.Errorf("Expected: %v, Returned: %v.", rows, read.GroupRows())
+	}
+	// Projects was created again, Projects/HR does not exist
+	rules := read.Authorizations(c, map[string]string{"/folders/folders/a": "/folders/folders/c"})
+	if len(rules) != 1 || rules[0].ObjectURI != "/folders/folders/c/**" {
+		t.Errorf("Expected: %v, Returned: %v.", "/folders/folders/c/**", rules)
+	}
+	lib := read.CASLIBs[0].LIB(c)
+	if len(lib.ACL) != 1 || lib.ACL[0].Principal.ID != "HR" || lib.ACL[0].Permissions[0] != "select" {
+		t.Errorf("Expected: %v, Returned: %v.", "grant select to HR", lib.ACL)
+	}
+}
+
+func TestReadVersion(t *testing.T) {
+	ioutil.WriteFile("test.json", []byte(`{"version": 2, "groups": []}`), 0644)
+	defer os.Remove("test.json")
+	if _, err := Read("test.json"); err == nil {
+		t.Errorf("Expected: %v, Returned: %v.", "unsupported version error", err)
+	}
+}
+
+func TestExclude(t *testing.T) {
+	s := &Snapshot{
+		Folders: []Folder{{"/Projects", "/folders/folders/a"}, {"/Users", "/folders/folders/u"}, {"/Users/alice", "/folders/folders/v"}},
+		Rules:   []Rule{{ID: "rule1", ContainerURI: "/folders/folders/a"}, {ID: "rule2", ObjectURI: "/folders/folders/v/**"}, {ID: "rule3", ObjectURI: "/SASDrive/**"}},
+	}
+	s.Exclude([]string{"/Users/"})
+	if !reflect.DeepEqual([]Folder{{"/Projects", "/folders/folders/a"}}, s.Folders) {
+		t.Errorf("Expected: %v, Returned: %v.", []Folder{{"/Projects", "/folders/folders/a"}}, s.Folders)
+	}
+	if len(s.Rules) != 2 || s.Rules[0].ID != "rule1" || s.Rules[1].ID != "rule3" {
+		t.Errorf("Expected: %v, Returned: %v.", "rule1 rule3", s.Rules)
+	}
+}
+
+func TestExcludeContent(t *testing.T) {
+	s := &Snapshot{Rules: []Rule{
+		{ID: "rule1", ObjectURI: "/folders/folders/00000000-0000-4000-8000-000000000001/**"},
+		{ID: "rule2", ObjectURI: "/reports/reports/00000000-0000-4000-8000-000000000002"},
+		{ID: "rule3", ObjectURI: "/SASDrive/**"},
+		{ID: "rule4", ContainerURI: "/files/files/00000000-0000-4000-8000-000000000003/content"},
+	}}
+	s.ExcludeContent()
+	if len(s.Rules) != 2 || s.Rules[0].ID != "rule1" || s.Rules[1].ID != "rule3" {
+		t.Errorf("Expected: %v, Returned: %v.", "rule1 rule3", s.Rules)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	s := &Snapshot{
+		Groups:  []Group{{ID: "HR", Name: "Human Resources", Members: []Member{{ID: "alice", Type: "user"}}}},
+		Folders: []Folder{{"/Projects", "/folders/folders/a"}},
+		Rules: []Rule{
+			{Type: "grant", PrincipalType: "authenticatedUsers", Permissions: []string{"read", "delete"}, ObjectURI: "/folders/folders/a/**"},
+			{Type: "grant", Principal: "HR", PrincipalType: "group", Permissions: []string{"read"}, ContainerURI: "/folders/folders/a"},
+			{Type: "prohibit", Principal: "HR", PrincipalType: "group", Permissions: []string{"read"}, ObjectURI: "/SASDrive/**"},
+			{Type: "grant", Principal: "HR", PrincipalType: "group", Permissions: []string{"read"}, ObjectURI: "/SASVisualAnalytics/**", Enabled: "false"},
+		},
+		CASLIBs: []CASLIB{{Name: "HRDATA", Controls: []ca.Control{{Identity: "*", IdentityType: "group", Permission: "ReadInfo", Type: "grant"}, {Identity: "HR", IdentityType: "group", Permission: "Select", Type: "deny"}}}},
+	}
+	files := s.Files("snapshot.json")
+	location := fi.Location{Path: "snapshot.json"}
+	expected := mo.Files{
+		Groups: []mo.GroupRow{{GroupID: "HR", GroupName: "Human Resources", Location: location}, {GroupID: "HR", GroupName: "Human Resources", UserID: "alice", Location: location}},
+		Matrix: []mo.CapabilityRow{{URI: "/SASDrive/**", Principal: "HR", Permissions: []string{"read"}, RuleOptions: mo.RuleOptions{Type: "prohibit"}, Location: location}},
+		IPAPPatterns: []mo.IPAPRow{
+			{Pattern: "/Projects", Principal: "authenticatedUsers", GrantType: "object", Permissions: []string{"read", "delete"}, RuleOptions: mo.RuleOptions{Type: "grant"}, Location: location},
+			{Pattern: "/Projects", Principal: "HR", GrantType: "conveyed", Permissions: []string{"read"}, RuleOptions: mo.RuleOptions{Type: "grant"}, Location: location},
+		},
+		IPAPFolders: []mo.FolderRow{{Directory: "/Projects", Pattern: "/Projects", Location: location}},
+		DAPPatterns: []mo.DAPRow{{Pattern: "HRDATA", Principal: "authenticatedUsers", Permissions: []string{"ReadInfo"}, Location: location}},
+		DAPCASLIBs:  []mo.CASLIBRow{{CASLIB: "HRDATA", Pattern: "HRDATA", Location: location}},
+	}
+	if !reflect.DeepEqual(expected, files) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, files)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package task
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// ErrUnknownDependency is returned for tasks that depend on a task which was not added before
+var ErrUnknownDependency = errors.New("unknown dependency")
+
+// task is a single operation together with its scheduling state
+type task struct {
+	id         string
+	index      int
+	run        func() error
+	pending    int
+	dependents []*task
+	err        error
+	skipped    bool
+}
+
+// Graph of operations that are executed once all of their dependencies succeeded
+type Graph struct {
+	tasks map[string]*task
+	order []*task
+}
+
+// Add an operation to the graph. Dependencies refer to the IDs of previously added operations, which
+// keeps the graph free of cycles. An operation with an unknown dependency is never executed. Adding an ID
+// twice keeps the first operation
+func (g *Graph) Add(id string, run func() error, dependencies ...string) {
+	if g.tasks == nil {
+		g.tasks = make(map[string]*task)
+	}
+	if _, exists := g.tasks[id]; exists {
+		return
+	}
+	t := &task{
+		id:    id,
+		index: len(g.order),
+		run:   run,
+	}
+	for _, dependency := range dependencies {
+		d, exists := g.tasks[dependency]
+		if !exists {
+			t.err = fmt.Errorf("scheduling %s after %s: %w", id, dependency, ErrUnknownDependency)
+			t.skipped = true
+			continue
+		}
+		d.dependents = append(d.dependents, t)
+		t.pending++
+	}
+	g.tasks[id] = t
+	g.order = append(g.order, t)
+}
+
+// Has reports whether an operation with the given ID was added
+func (g *Graph) Has(id string) bool {
+	_, exists := g.tasks[id]
+	return exists
+}
+
+// Len returns the number of operations in the graph
+func (g *Graph) Len() int {
+	return len(g.order)
+}
+
+// Run executes all operations with at most the given number of concurrent workers. Operations that
+// are ready are started in the order they were added, so a single worker processes them sequentially.
+// Operations depending on a failed operation are skipped. The errors are returned in the order the
+// operations were added
+func (g *Graph) Run(workers int) []error {
+	if workers < 1 {
+		workers = 1
+	}
+	type result struct {
+		task *task
+		err  error
+	}
+	results := make(chan result)
+	var ready []*task
+	for _, t := range g.order {
+		if t.err != nil {
+			g.skip(t)
+		} else if t.pending == 0 {
+			ready = append(ready, t)
+		}
+	}
+	running := 0
+	for len(ready) > 0 || running > 0 {
+		for running < workers && len(ready) > 0 {
+			t := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				results <- result{task: t, err: t.run()}
+			}()
+		}
+		r := <-results
+		running--
+		if r.err != nil {
+			r.task.err = r.err
+			g.skip(r.task)
+			continue
+		}
+		for _, d := range r.task.dependents {
+			d.pending--
+			if d.pending == 0 && !d.skipped {
+				ready = append(ready, d)
+			}
+		}
+		sort.Slice(ready, func(i, j int) bool {
+			return ready[i].index < ready[j].index
+		})
+	}
+	var errs []error
+	for _, t := range g.order {
+		if t.err != nil {
+			errs = append(errs, t.err)
+		}
+	}
+	return errs
+}
+
+// skip all operations depending on a failed operation
+func (g *Graph) skip(failed *task) {
+	for _, d := range failed.dependents {
+		if !d.skipped {
+			d.skipped = true
+			zap.S().Warnw("Skipping operation as a dependency failed", "operation", d.id, "dependency", failed.id)
+			g.skip(d)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package task
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunSequential(t *testing.T) {
+	var g Graph
+	var returned []string
+	record := func(id string) func() error {
+		return func() error {
+			returned = append(returned, id)
+			return nil
+		}
+	}
+	g.Add("folder /a", record("folder /a"))
+	g.Add("group g", record("group g"))
+	g.Add("folder /a/b", record("folder /a/b"), "folder /a")
+	g.Add("rule /a/b g", record("rule /a/b g"), "folder /a/b", "group g")
+	g.Add("group g", record("duplicate"))
+	if errs := g.Run(1); errs != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, errs)
+	}
+	expected := []string{"folder /a", "group g", "folder /a/b", "rule /a/b g"}
+	if !reflect.DeepEqual(returned, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
+
+func TestRunFailedDependency(t *testing.T) {
+	var g Graph
+	failed := errors.New("failed")
+	var ran []string
+	var mutex sync.Mutex
+	record := func(id string) func() error {
+		return func() error {
+			mutex.Lock()
+			ran = append(ran, id)
+			mutex.Unlock()
+			return nil
+		}
+	}
+	g.Add("folder /a", func() error { return failed })
+	g.Add("folder /a/b", record("folder /a/b"), "folder /a")
+	g.Add("rule /a/b", record("rule /a/b"), "folder /a/b")
+	g.Add("group g", record("group g"))
+	g.Add("rule /c", record("rule /c"), "folder /c")
+	errs := g.Run(4)
+	if len(errs) != 2 || errs[0] != failed || !errors.Is(errs[1], ErrUnknownDependency) {
+		t.Errorf("Expected: %v, Returned: %v.", []error{failed, ErrUnknownDependency}, errs)
+	}
+	expected := []string{"group g"}
+	if !reflect.DeepEqual(ran, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, ran)
+	}
+}
+
+func TestRunUnknownDependency(t *testing.T) {
+	var g Graph
+	var ran []string
+	g.Add("folder /a", func() error {
+		ran = append(ran, "folder /a")
+		return nil
+	})
+	g.Add("rule /a", func() error {
+		ran = append(ran, "rule /a")
+		return nil
+	}, "folder /a", "group g")
+	errs := g.Run(1)
+	if len(errs) != 1 || !errors.Is(errs[0], ErrUnknownDependency) {
+		t.Errorf("Expected: %v, Returned: %v.", []error{ErrUnknownDependency}, errs)
+	}
+	expected := []string{"folder /a"}
+	if !reflect.DeepEqual(ran, expected) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, ran)
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	var g Graph
+	var mutex sync.Mutex
+	var running, returned int
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		g.Add(id, func() error {
+			mutex.Lock()
+			running++
+			if running > returned {
+				returned = running
+			}
+			mutex.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+			return nil
+		})
+	}
+	var expected int = 3
+	if errs := g.Run(expected); errs != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, errs)
+	}
+	if returned != expected {
+		t.Errorf("Expected: %v, Returned: %v.", expected, returned)
+	}
+}
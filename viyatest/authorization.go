@@ -0,0 +1,171 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package viyatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Rule is a general authorization rule
+type Rule struct {
+	ID                  string   `json:"id"`
+	Principal           string   `json:"principal,omitempty"`
+	PrincipalType       string   `json:"principalType"`
+	Type                string   `json:"type"`
+	Permissions         []string `json:"permissions"`
+	ObjectURI           string   `json:"objectUri,omitempty"`
+	ContainerURI        string   `json:"containerUri,omitempty"`
+	Condition           string   `json:"condition,omitempty"`
+	Filter              string   `json:"filter,omitempty"`
+	MediaType           string   `json:"mediaType,omitempty"`
+	ExpirationTimestamp string   `json:"expirationTimestamp,omitempty"`
+	Reason              string   `json:"reason,omitempty"`
+	Description         string   `json:"description,omitempty"`
+	Enabled             bool     `json:"enabled"`
+}
+
+// AddRule adds an authorization rule and returns its ID. The ID of the rule is ignored
+func (v *Viya) AddRule(rule Rule) string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	rule.ID = v.id()
+	rule.Permissions = append([]string(nil), rule.Permissions...)
+	v.rules[rule.ID] = &rule
+	v.revisions[rule.ID] = 1
+	return rule.ID
+}
+
+// Rules returns the authorization rules in the order they were created
+func (v *Viya) Rules() []Rule {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var rules []Rule
+	for _, rule := range v.sortedRules() {
+		copied := *rule
+		copied.Permissions = append([]string(nil), rule.Permissions...)
+		rules = append(rules, copied)
+	}
+	return rules
+}
+
+// authorization serves the authorization REST API
+func (v *Viya) authorization(r *request) response {
+	s := r.segments
+	switch {
+	case len(s) == 2 && s[1] == "rules" && r.method == "GET":
+		var items []map[string]interface{}
+		for _, rule := range v.sortedRules() {
+			items = append(items, object(rule))
+		}
+		return collection(r, items)
+	case len(s) == 2 && s[1] == "rules" && r.method == "POST":
+		rule, res := decodeRule(r.body)
+		if rule == nil {
+			return res
+		}
+		rule.ID = v.id()
+		v.rules[rule.ID] = rule
+		v.revisions[rule.ID] = 1
+		return v.ruleResponse(http.StatusCreated, rule)
+	case len(s) == 3 && s[1] == "rules" && r.method == "GET":
+		if rule, exists := v.rules[s[2]]; exists {
+			return v.ruleResponse(http.StatusOK, rule)
+		}
+		return notFound("rule", s[2])
+	case len(s) == 3 && s[1] == "rules" && r.method == "PUT":
+		return v.updateRule(r, s[2])
+	case len(s) == 3 && s[1] == "rules" && r.method == "DELETE":
+		if _, exists := v.rules[s[2]]; !exists {
+			return notFound("rule", s[2])
+		}
+		delete(v.rules, s[2])
+		delete(v.revisions, s[2])
+		return noContent()
+	}
+	return notImplemented(r)
+}
+
+// updateRule replaces an authorization rule, which requires its current ETag as If-Match
+func (v *Viya) updateRule(r *request, id string) response {
+	if _, exists := v.rules[id]; !exists {
+		return notFound("rule", id)
+	}
+	ifMatch := r.header.Get("If-Match")
+	if ifMatch == "" {
+		return fail(http.StatusPreconditionRequired, "updating rule %s requires an If-Match header", id)
+	}
+	if ifMatch != v.etag(id) {
+		return fail(http.StatusPreconditionFailed, "rule %s was changed", id)
+	}
+	rule, res := decodeRule(r.body)
+	if rule == nil {
+		return res
+	}
+	rule.ID = id
+	v.rules[id] = rule
+	v.revisions[id]++
+	return v.ruleResponse(http.StatusOK, rule)
+}
+
+// decodeRule reads and validates an authorization rule. The enabled state is also accepted as a string and rules are
+// enabled by default
+func decodeRule(body []byte) (*Rule, response) {
+	var fields struct {
+		Rule
+		Enabled interface{} `json:"enabled"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fail(http.StatusBadRequest, "invalid rule: %s", err)
+	}
+	rule := fields.Rule
+	switch enabled := fields.Enabled.(type) {
+	case bool:
+		rule.Enabled = enabled
+	case string:
+		rule.Enabled = enabled != "false"
+	default:
+		rule.Enabled = true
+	}
+	if rule.Type == "" {
+		rule.Type = "grant"
+	}
+	switch {
+	case rule.Type != "grant" && rule.Type != "prohibit":
+		return nil, fail(http.StatusBadRequest, "invalid rule type %s", rule.Type)
+	case rule.PrincipalType != "group" && rule.PrincipalType != "user" && rule.PrincipalType != "authenticatedUsers" && rule.PrincipalType != "everyone" && rule.PrincipalType != "guest":
+		return nil, fail(http.StatusBadRequest, "invalid principal type %q", rule.PrincipalType)
+	case (rule.PrincipalType == "group" || rule.PrincipalType == "user") && rule.Principal == "":
+		return nil, fail(http.StatusBadRequest, "the principal of the rule needs to be provided")
+	case (rule.ObjectURI == "") == (rule.ContainerURI == ""):
+		return nil, fail(http.StatusBadRequest, "either an objectUri or a containerUri needs to be provided")
+	case len(rule.Permissions) == 0:
+		return nil, fail(http.StatusBadRequest, "the permissions of the rule need to be provided")
+	}
+	return &rule, response{}
+}
+
+// ruleResponse returns an authorization rule with its ETag
+func (v *Viya) ruleResponse(status int, rule *Rule) response {
+	return response{status: status, header: http.Header{"Etag": {v.etag(rule.ID)}}, body: object(rule)}
+}
+
+// etag returns the ETag of the current revision of an authorization rule
+func (v *Viya) etag(id string) string {
+	return `"` + id + "-" + strconv.Itoa(v.revisions[id]) + `"`
+}
+
+// sortedRules returns the authorization rules ordered by ID, i.e. in the order they were created
+func (v *Viya) sortedRules() []*Rule {
+	var rules []*Rule
+	for _, rule := range v.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+	return rules
+}
@@ -0,0 +1,242 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package viyatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	ca "github.com/sassoftware/sas-viya-authorization-model/cas"
+)
+
+// CASLIB of the CAS server with its direct CAS access controls
+type CASLIB struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Path        string       `json:"path,omitempty"`
+	Type        string       `json:"type,omitempty"`
+	Scope       string       `json:"scope,omitempty"`
+	Controls    []ca.Control `json:"-"`
+}
+
+// session is a CAS session. Changes of access controls within a transaction only apply when it is committed
+type session struct {
+	transaction map[string][]ca.Control
+}
+
+// AddCASLIB adds a CASLIB or replaces the CASLIB with the same name
+func (v *Viya) AddCASLIB(lib CASLIB) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if lib.Scope == "" {
+		lib.Scope = "global"
+	}
+	lib.Controls = append([]ca.Control(nil), lib.Controls...)
+	v.caslibs[strings.ToUpper(lib.Name)] = &lib
+}
+
+// CASLIBs returns the CASLIBs with their committed access controls ordered by name
+func (v *Viya) CASLIBs() []CASLIB {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var caslibs []CASLIB
+	for _, lib := range v.sortedCASLIBs() {
+		copied := *lib
+		copied.Controls = append([]ca.Control(nil), lib.Controls...)
+		caslibs = append(caslibs, copied)
+	}
+	return caslibs
+}
+
+// casManagement serves the casManagement REST API
+func (v *Viya) casManagement(r *request) response {
+	s := r.segments
+	if len(s) < 4 || s[1] != "servers" {
+		return notImplemented(r)
+	}
+	if s[2] != CASServer {
+		return notFound("server", s[2])
+	}
+	switch {
+	case len(s) == 4 && s[3] == "sessions" && r.method == "POST":
+		id := v.id()
+		v.sessions[id] = new(session)
+		return ok(map[string]interface{}{"id": id})
+	case len(s) == 5 && s[3] == "sessions" && r.method == "DELETE":
+		if _, exists := v.sessions[s[4]]; !exists {
+			return notFound("session", s[4])
+		}
+		delete(v.sessions, s[4])
+		return noContent()
+	case len(s) == 5 && s[3] == "sessions" && r.method == "POST":
+		return v.transaction(s[4], r.query.Get("action"))
+	case len(s) == 4 && s[3] == "caslibs" && r.method == "GET":
+		var items []map[string]interface{}
+		for _, lib := range v.sortedCASLIBs() {
+			items = append(items, object(lib))
+		}
+		return collection(r, items)
+	case len(s) == 4 && s[3] == "caslibs" && r.method == "POST":
+		var lib CASLIB
+		if err := json.Unmarshal(r.body, &lib); err != nil || lib.Name == "" {
+			return fail(http.StatusBadRequest, "the name of the CASLIB needs to be provided")
+		}
+		if _, exists := v.caslibs[strings.ToUpper(lib.Name)]; exists {
+			return fail(http.StatusConflict, "CASLIB %s already exists", lib.Name)
+		}
+		v.caslibs[strings.ToUpper(lib.Name)] = &lib
+		return created(object(lib))
+	case len(s) == 5 && s[3] == "caslibs" && r.method == "DELETE":
+		if _, exists := v.caslibs[strings.ToUpper(s[4])]; !exists {
+			return notFound("CASLIB", s[4])
+		}
+		delete(v.caslibs, strings.ToUpper(s[4]))
+		return noContent()
+	}
+	return notImplemented(r)
+}
+
+// casAccessManagement serves the casAccessManagement REST API
+func (v *Viya) casAccessManagement(r *request) response {
+	s := r.segments
+	if len(s) < 4 || s[1] != "servers" {
+		return notImplemented(r)
+	}
+	if s[2] != CASServer {
+		return notFound("server", s[2])
+	}
+	var sess *session
+	if id := r.query.Get("sessionId"); id != "" {
+		if sess = v.sessions[id]; sess == nil {
+			return notFound("session", id)
+		}
+	}
+	switch {
+	case len(s) == 6 && s[3] == "admUser" && s[4] == "assumeRole" && r.method == "PUT":
+		if sess == nil {
+			return fail(http.StatusBadRequest, "a sessionId needs to be provided")
+		}
+		return noContent()
+	case len(s) == 5 && s[3] == "caslibControls" && r.method == "GET":
+		controls, res := v.controls(sess, s[4])
+		if res.status != 0 {
+			return res
+		}
+		var items []map[string]interface{}
+		for _, control := range controls {
+			items = append(items, object(control))
+		}
+		return collection(r, items)
+	case len(s) == 6 && s[3] == "caslibControls" && s[5] == "lock" && r.method == "POST":
+		if _, res := v.controls(sess, s[4]); res.status != 0 {
+			return res
+		}
+		return noContent()
+	case len(s) == 5 && s[3] == "caslibControls" && (r.method == "PUT" || r.method == "PATCH" || r.method == "DELETE"):
+		return v.updateControls(r, sess, s[4])
+	}
+	return notImplemented(r)
+}
+
+// transaction starts, commits or cancels the access control transaction of a CAS session
+func (v *Viya) transaction(id, action string) response {
+	sess, exists := v.sessions[id]
+	if !exists {
+		return notFound("session", id)
+	}
+	switch action {
+	case "start":
+		sess.transaction = make(map[string][]ca.Control)
+	case "commit":
+		for name, controls := range sess.transaction {
+			if lib, exists := v.caslibs[name]; exists {
+				lib.Controls = controls
+			}
+		}
+		sess.transaction = nil
+	case "cancel":
+		sess.transaction = nil
+	default:
+		return fail(http.StatusBadRequest, "invalid action %q", action)
+	}
+	return noContent()
+}
+
+// updateControls replaces (PUT), adds (PATCH) or removes (DELETE) direct CAS access controls of a CASLIB. Removing an
+// empty list of controls removes all controls
+func (v *Viya) updateControls(r *request, sess *session, name string) response {
+	current, res := v.controls(sess, name)
+	if res.status != 0 {
+		return res
+	}
+	var controls []ca.Control
+	if err := json.Unmarshal(r.body, &controls); err != nil {
+		return fail(http.StatusBadRequest, "invalid access controls: %s", err)
+	}
+	var updated []ca.Control
+	switch r.method {
+	case "PUT":
+		updated = controls
+	case "PATCH":
+		updated = current
+		for _, control := range controls {
+			if !containsControl(updated, control) {
+				updated = append(updated, control)
+			}
+		}
+	case "DELETE":
+		if len(controls) > 0 {
+			for _, control := range current {
+				if !containsControl(controls, control) {
+					updated = append(updated, control)
+				}
+			}
+		}
+	}
+	if sess != nil && sess.transaction != nil {
+		sess.transaction[strings.ToUpper(name)] = updated
+	} else {
+		v.caslibs[strings.ToUpper(name)].Controls = updated
+	}
+	return noContent()
+}
+
+// controls returns the direct CAS access controls of a CASLIB as seen by a CAS session, i.e. including the changes of
+// its transaction
+func (v *Viya) controls(sess *session, name string) ([]ca.Control, response) {
+	lib, exists := v.caslibs[strings.ToUpper(name)]
+	if !exists {
+		return nil, notFound("CASLIB", name)
+	}
+	if sess != nil && sess.transaction != nil {
+		if controls, changed := sess.transaction[strings.ToUpper(name)]; changed {
+			return append([]ca.Control(nil), controls...), response{}
+		}
+	}
+	return append([]ca.Control(nil), lib.Controls...), response{}
+}
+
+// sortedCASLIBs returns the CASLIBs ordered by name
+func (v *Viya) sortedCASLIBs() []*CASLIB {
+	var caslibs []*CASLIB
+	for _, lib := range v.caslibs {
+		caslibs = append(caslibs, lib)
+	}
+	sort.Slice(caslibs, func(i, j int) bool {
+		return caslibs[i].Name < caslibs[j].Name
+	})
+	return caslibs
+}
+
+// containsControl reports whether a list contains an access control of the same identity, permission and type
+func containsControl(controls []ca.Control, control ca.Control) bool {
+	for _, c := range controls {
+		if c.Identity == control.Identity && c.IdentityType == control.IdentityType && c.Permission == control.Permission && c.Type == control.Type {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package viyatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Folder is a content folder with its path
+type Folder struct {
+	Path string
+	URI  string
+}
+
+// folder is a content folder, the parent of a root folder is empty
+type folder struct {
+	id     string
+	name   string
+	parent string
+}
+
+// AddFolder adds a content folder and its missing parent folders and returns its URI
+func (v *Viya) AddFolder(path string) string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var parent string
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		child := v.child(parent, name)
+		if child == nil {
+			child = &folder{id: v.id(), name: name, parent: parent}
+			v.folders[child.id] = child
+		}
+		parent = child.id
+	}
+	return "/folders/folders/" + parent
+}
+
+// Folders returns the content folders ordered by path
+func (v *Viya) Folders() []Folder {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var folders []Folder
+	for _, f := range v.folders {
+		folders = append(folders, Folder{Path: v.path(f), URI: "/folders/folders/" + f.id})
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Path < folders[j].Path
+	})
+	return folders
+}
+
+// folderAPI serves the folders REST API
+func (v *Viya) folderAPI(r *request) response {
+	s := r.segments
+	switch {
+	case len(s) == 2 && s[1] == "rootFolders" && r.method == "GET":
+		return collection(r, v.folderItems(""))
+	case len(s) == 2 && s[1] == "ancestors" && r.method == "GET":
+		return v.ancestors(r.query.Get("childUri"))
+	case len(s) == 2 && s[1] == "folders" && r.method == "POST":
+		return v.createFolder(r)
+	case len(s) == 3 && s[1] == "folders" && s[2] == "@item" && r.method == "GET":
+		if f := v.find(r.query.Get("path")); f != nil {
+			return ok(v.folderItem(f))
+		}
+		return notFound("folder", r.query.Get("path"))
+	case len(s) == 3 && s[1] == "folders" && r.method == "GET":
+		if f, exists := v.folders[s[2]]; exists {
+			return ok(v.folderItem(f))
+		}
+		return notFound("folder", s[2])
+	case len(s) == 3 && s[1] == "folders" && r.method == "DELETE":
+		return v.deleteFolder(s[2], r.query.Get("recursive") == "true")
+	case len(s) == 4 && s[1] == "folders" && s[3] == "members" && r.method == "GET":
+		if _, exists := v.folders[s[2]]; !exists {
+			return notFound("folder", s[2])
+		}
+		var items []map[string]interface{}
+		for _, item := range v.folderItems(s[2]) {
+			items = append(items, map[string]interface{}{
+				"uri":         "/folders/folders/" + item["id"].(string),
+				"name":        item["name"],
+				"contentType": "folder",
+				"type":        "child",
+			})
+		}
+		return collection(r, items)
+	}
+	return notImplemented(r)
+}
+
+// createFolder creates a content folder in the parent folder of the request
+func (v *Viya) createFolder(r *request) response {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(r.body, &body); err != nil || body.Name == "" {
+		return fail(http.StatusBadRequest, "the name of the folder needs to be provided")
+	}
+	var parent string
+	if uri := r.query.Get("parentFolderUri"); uri != "" && uri != "none" {
+		parent = strings.TrimPrefix(uri, "/folders/folders/")
+		if _, exists := v.folders[parent]; !exists {
+			return notFound("folder", uri)
+		}
+	}
+	if v.child(parent, body.Name) != nil {
+		return fail(http.StatusConflict, "folder %s already exists", body.Name)
+	}
+	f := &folder{id: v.id(), name: body.Name, parent: parent}
+	v.folders[f.id] = f
+	return created(v.folderItem(f))
+}
+
+// deleteFolder deletes a content folder, which needs to be empty unless it is deleted recursively
+func (v *Viya) deleteFolder(id string, recursive bool) response {
+	if _, exists := v.folders[id]; !exists {
+		return notFound("folder", id)
+	}
+	children := v.folderItems(id)
+	if len(children) > 0 && !recursive {
+		return fail(http.StatusConflict, "folder %s is not empty", id)
+	}
+	for _, child := range children {
+		v.deleteFolder(child["id"].(string), true)
+	}
+	delete(v.folders, id)
+	return noContent()
+}
+
+// ancestors lists the folders containing a folder, the nearest first
+func (v *Viya) ancestors(uri string) response {
+	f, exists := v.folders[strings.TrimPrefix(uri, "/folders/folders/")]
+	if !strings.HasPrefix(uri, "/folders/folders/") || !exists {
+		return notFound("member", uri)
+	}
+	ancestors := []map[string]interface{}{}
+	for f.parent != "" {
+		f = v.folders[f.parent]
+		ancestors = append(ancestors, v.folderItem(f))
+	}
+	return ok(map[string]interface{}{"childUri": uri, "ancestors": ancestors})
+}
+
+// find returns the folder of a path, if any
+func (v *Viya) find(path string) *folder {
+	var f *folder
+	var parent string
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if f = v.child(parent, name); f == nil {
+			return nil
+		}
+		parent = f.id
+	}
+	return f
+}
+
+// child returns the subfolder of a folder with a name, if any
+func (v *Viya) child(parent, name string) *folder {
+	for _, f := range v.folders {
+		if f.parent == parent && f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// path returns the path of a folder
+func (v *Viya) path(f *folder) string {
+	var path string
+	for ; f != nil; f = v.folders[f.parent] {
+		path = "/" + f.name + path
+	}
+	return path
+}
+
+// folderItems returns the representations of the subfolders of a folder ordered by name
+func (v *Viya) folderItems(parent string) []map[string]interface{} {
+	var children []*folder
+	for _, f := range v.folders {
+		if f.parent == parent {
+			children = append(children, f)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].name < children[j].name
+	})
+	var items []map[string]interface{}
+	for _, f := range children {
+		items = append(items, v.folderItem(f))
+	}
+	return items
+}
+
+// folderItem returns the representation of a folder
+func (v *Viya) folderItem(f *folder) map[string]interface{} {
+	item := map[string]interface{}{"id": f.id, "name": f.name, "type": "folder"}
+	if f.parent != "" {
+		item["parentFolderUri"] = "/folders/folders/" + f.parent
+	}
+	return item
+}
@@ -0,0 +1,309 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package viyatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// User of the identity provider
+type User struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Group is a custom group
+type Group struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Member of a custom group, either a user or a group
+type Member struct {
+	ID   string
+	Type string
+}
+
+// group is a custom group with its direct members
+type group struct {
+	Group
+	members []Member
+}
+
+// AddUser adds a user to the identity provider. Users cannot be created through the REST API
+func (v *Viya) AddUser(id, name string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.users[id] = &User{ID: id, Name: name}
+}
+
+// AddGroup adds a custom group or replaces its name and description
+func (v *Viya) AddGroup(id, name, description string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if g, exists := v.groups[id]; exists {
+		g.Name, g.Description = name, description
+		return
+	}
+	v.groups[id] = &group{Group: Group{ID: id, Name: name, Description: description}}
+}
+
+// AddMember adds an existing user or group as direct member of a custom group
+func (v *Viya) AddMember(groupID, memberType, memberID string) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if _, exists := v.groups[groupID]; !exists {
+		return fmt.Errorf("custom group %s does not exist", groupID)
+	}
+	if !v.exists(memberType, memberID) {
+		return fmt.Errorf("%s %s does not exist", memberType, memberID)
+	}
+	v.addMember(groupID, memberType, memberID)
+	return nil
+}
+
+// Groups returns the custom groups ordered by ID
+func (v *Viya) Groups() []Group {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var groups []Group
+	for _, g := range v.sortedGroups() {
+		groups = append(groups, g.Group)
+	}
+	return groups
+}
+
+// Members returns the direct members of a custom group in the order they were added
+func (v *Viya) Members(groupID string) []Member {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	g, exists := v.groups[groupID]
+	if !exists {
+		return nil
+	}
+	return append([]Member(nil), g.members...)
+}
+
+// identities serves the identities REST API
+func (v *Viya) identities(r *request) response {
+	s := r.segments
+	switch {
+	case len(s) == 2 && s[1] == "groups" && r.method == "GET":
+		var items []map[string]interface{}
+		if provider := r.query.Get("providerId"); provider == "" || provider == "local" {
+			for _, g := range v.sortedGroups() {
+				items = append(items, v.groupItem(g))
+			}
+		}
+		return collection(r, items)
+	case len(s) == 2 && s[1] == "groups" && r.method == "POST":
+		return v.createGroup(r)
+	case len(s) == 2 && s[1] == "users" && r.method == "GET":
+		var ids []string
+		for id := range v.users {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		var items []map[string]interface{}
+		for _, id := range ids {
+			items = append(items, object(v.users[id]))
+		}
+		return collection(r, items)
+	case len(s) == 3 && s[1] == "groups" && r.method == "GET":
+		if g, exists := v.groups[s[2]]; exists {
+			return ok(v.groupItem(g))
+		}
+		return notFound("group", s[2])
+	case len(s) == 3 && s[1] == "groups" && r.method == "DELETE":
+		return v.deleteGroup(s[2])
+	case len(s) == 3 && s[1] == "users" && r.method == "GET":
+		if u, exists := v.users[s[2]]; exists {
+			return ok(object(u))
+		}
+		return notFound("user", s[2])
+	case len(s) == 4 && s[1] == "groups" && s[3] == "members" && r.method == "GET":
+		return v.members(r, s[2])
+	case len(s) == 4 && (s[1] == "groups" || s[1] == "users") && s[3] == "memberships" && r.method == "GET":
+		return v.memberships(r, s[1][:len(s[1])-1], s[2])
+	case len(s) == 5 && s[1] == "groups" && (s[3] == "groupMembers" || s[3] == "userMembers") && r.method == "PUT":
+		return v.addMember(s[2], s[3][:len(s[3])-len("Members")], s[4])
+	case len(s) == 5 && s[1] == "groups" && (s[3] == "groupMembers" || s[3] == "userMembers") && r.method == "DELETE":
+		return v.removeMember(s[2], s[3][:len(s[3])-len("Members")], s[4])
+	}
+	return notImplemented(r)
+}
+
+// createGroup creates a custom group
+func (v *Viya) createGroup(r *request) response {
+	var g Group
+	if err := json.Unmarshal(r.body, &g); err != nil {
+		return fail(http.StatusBadRequest, "invalid group: %s", err)
+	}
+	if g.ID == "" {
+		return fail(http.StatusBadRequest, "the id of the group needs to be provided")
+	}
+	if _, exists := v.groups[g.ID]; exists {
+		return fail(http.StatusConflict, "group %s already exists", g.ID)
+	}
+	if g.Name == "" {
+		g.Name = g.ID
+	}
+	v.groups[g.ID] = &group{Group: g}
+	return created(v.groupItem(v.groups[g.ID]))
+}
+
+// deleteGroup deletes a custom group and its memberships in other groups
+func (v *Viya) deleteGroup(id string) response {
+	if _, exists := v.groups[id]; !exists {
+		return notFound("group", id)
+	}
+	delete(v.groups, id)
+	for _, g := range v.groups {
+		g.members = without(g.members, Member{ID: id, Type: "group"})
+	}
+	return noContent()
+}
+
+// members lists the direct members of a custom group, or all nested members for depth -1
+func (v *Viya) members(r *request, id string) response {
+	g, exists := v.groups[id]
+	if !exists {
+		return notFound("group", id)
+	}
+	members := g.members
+	if r.query.Get("depth") == "-1" {
+		members = v.nested(g, map[string]bool{id: true})
+	}
+	var items []map[string]interface{}
+	seen := make(map[Member]bool)
+	for _, m := range members {
+		if seen[m] && r.query.Get("showDuplicates") != "true" {
+			continue
+		}
+		seen[m] = true
+		items = append(items, v.memberItem(m))
+	}
+	return collection(r, items)
+}
+
+// nested returns the direct and indirect members of a custom group, visiting every group once
+func (v *Viya) nested(g *group, visited map[string]bool) []Member {
+	var members []Member
+	for _, m := range g.members {
+		members = append(members, m)
+		if sub, exists := v.groups[m.ID]; m.Type == "group" && exists && !visited[m.ID] {
+			visited[m.ID] = true
+			members = append(members, v.nested(sub, visited)...)
+		}
+	}
+	return members
+}
+
+// memberships lists the custom groups a user or group is a direct member of
+func (v *Viya) memberships(r *request, memberType, id string) response {
+	if !v.exists(memberType, id) {
+		return notFound(memberType, id)
+	}
+	var items []map[string]interface{}
+	for _, g := range v.sortedGroups() {
+		for _, m := range g.members {
+			if m == (Member{ID: id, Type: memberType}) {
+				items = append(items, v.groupItem(g))
+				break
+			}
+		}
+	}
+	return collection(r, items)
+}
+
+// addMember adds a user or group as direct member of a custom group, which is idempotent
+func (v *Viya) addMember(groupID, memberType, memberID string) response {
+	g, exists := v.groups[groupID]
+	if !exists {
+		return notFound("group", groupID)
+	}
+	if !v.exists(memberType, memberID) {
+		return notFound(memberType, memberID)
+	}
+	member := Member{ID: memberID, Type: memberType}
+	for _, m := range g.members {
+		if m == member {
+			return noContent()
+		}
+	}
+	g.members = append(g.members, member)
+	return noContent()
+}
+
+// removeMember removes a direct member of a custom group
+func (v *Viya) removeMember(groupID, memberType, memberID string) response {
+	g, exists := v.groups[groupID]
+	if !exists {
+		return notFound("group", groupID)
+	}
+	member := Member{ID: memberID, Type: memberType}
+	remaining := without(g.members, member)
+	if len(remaining) == len(g.members) {
+		return notFound(memberType+" member of group "+groupID, memberID)
+	}
+	g.members = remaining
+	return noContent()
+}
+
+// exists reports whether a user or group exists
+func (v *Viya) exists(principalType, id string) bool {
+	if principalType == "group" {
+		_, exists := v.groups[id]
+		return exists
+	}
+	_, exists := v.users[id]
+	return principalType == "user" && exists
+}
+
+// sortedGroups returns the custom groups ordered by ID
+func (v *Viya) sortedGroups() []*group {
+	var groups []*group
+	for _, g := range v.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+	return groups
+}
+
+// groupItem returns the representation of a custom group
+func (v *Viya) groupItem(g *group) map[string]interface{} {
+	item := object(g.Group)
+	item["type"] = "group"
+	item["providerId"] = "local"
+	item["state"] = "active"
+	return item
+}
+
+// memberItem returns the representation of a member of a custom group
+func (v *Viya) memberItem(m Member) map[string]interface{} {
+	item := map[string]interface{}{"id": m.ID, "type": m.Type}
+	if g, exists := v.groups[m.ID]; m.Type == "group" && exists {
+		item["name"] = g.Name
+	} else if u, exists := v.users[m.ID]; m.Type == "user" && exists {
+		item["name"] = u.Name
+	}
+	return item
+}
+
+// without returns the members except one
+func without(members []Member, member Member) []Member {
+	var remaining []Member
+	for _, m := range members {
+		if m != member {
+			remaining = append(remaining, m)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,322 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package viyatest provides a stateful in-memory fake of SAS Viya for end-to-end tests without a SAS Viya environment
+package viyatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+)
+
+// BaseURL of the fake when used as the Client of a connection
+const BaseURL = "http://viya.test"
+
+// CASServer is the only CAS server of the fake
+const CASServer = "cas-shared-default"
+
+// defaultLimit is the page size of collections without a limit, as in SAS Viya
+const defaultLimit = 10
+
+// Viya is a stateful in-memory fake of SAS Logon Manager and the identities, authorization, folders, casManagement
+// and casAccessManagement REST APIs as far as they are used by goViyaAuth. It serves requests as the Client of a
+// connection or as an http.Handler, e.g. of an httptest.Server. Requests the fake does not implement fail with status
+// 501. A Viya is safe for concurrent use
+type Viya struct {
+	mutex     sync.Mutex
+	next      int
+	tokens    map[string]bool
+	users     map[string]*User
+	groups    map[string]*group
+	rules     map[string]*Rule
+	revisions map[string]int
+	folders   map[string]*folder
+	caslibs   map[string]*CASLIB
+	sessions  map[string]*session
+}
+
+// request to the fake
+type request struct {
+	method   string
+	path     string
+	segments []string
+	query    url.Values
+	header   http.Header
+	body     []byte
+}
+
+// response of the fake
+type response struct {
+	status int
+	header http.Header
+	body   interface{}
+}
+
+// New returns an empty fake without users, groups, rules, folders and CASLIBs
+func New() *Viya {
+	return &Viya{
+		tokens:    make(map[string]bool),
+		users:     make(map[string]*User),
+		groups:    make(map[string]*group),
+		rules:     make(map[string]*Rule),
+		revisions: make(map[string]int),
+		folders:   make(map[string]*folder),
+		caslibs:   make(map[string]*CASLIB),
+		sessions:  make(map[string]*session),
+	}
+}
+
+// Connection returns a connection to the fake, established with the OAuth 2.0 password grant
+func (v *Viya) Connection() (*co.Connection, error) {
+	c := co.New(co.Options{BaseURL: BaseURL, User: "sasadm", Password: "viyatest", Client: v})
+	if err := c.Connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Do serves a request of a connection without a network
+func (v *Viya) Do(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	v.ServeHTTP(rec, req)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// ServeHTTP serves a request to the fake
+func (v *Viya) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	r := &request{
+		method:   req.Method,
+		path:     req.URL.Path,
+		segments: strings.Split(strings.Trim(req.URL.Path, "/"), "/"),
+		query:    req.URL.Query(),
+		header:   req.Header,
+	}
+	if req.Body != nil {
+		r.body, _ = ioutil.ReadAll(req.Body)
+	}
+	v.mutex.Lock()
+	res := v.serve(r)
+	v.mutex.Unlock()
+	for name, values := range res.header {
+		rw.Header()[name] = values
+	}
+	if res.body == nil {
+		rw.WriteHeader(res.status)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(res.status)
+	json.NewEncoder(rw).Encode(res.body)
+}
+
+// serve routes a request to the fake API
+func (v *Viya) serve(r *request) response {
+	if r.path == "/SASLogon/oauth/token" {
+		return v.token(r)
+	}
+	if !v.tokens[strings.TrimPrefix(r.header.Get("Authorization"), "bearer ")] {
+		return fail(http.StatusUnauthorized, "invalid OAuth Access Token")
+	}
+	switch r.segments[0] {
+	case "identities":
+		return v.identities(r)
+	case "authorization":
+		return v.authorization(r)
+	case "folders":
+		return v.folderAPI(r)
+	case "casManagement":
+		return v.casManagement(r)
+	case "casAccessManagement":
+		return v.casAccessManagement(r)
+	}
+	return notImplemented(r)
+}
+
+// token issues an OAuth Access Token for the password, client credentials and refresh token grants
+func (v *Viya) token(r *request) response {
+	if r.method != "POST" {
+		return notImplemented(r)
+	}
+	form, err := url.ParseQuery(string(r.body))
+	if err != nil {
+		return fail(http.StatusBadRequest, "invalid token request: %s", err)
+	}
+	switch form.Get("grant_type") {
+	case "password":
+		if form.Get("username") == "" || form.Get("password") == "" {
+			return fail(http.StatusUnauthorized, "bad credentials")
+		}
+	case "client_credentials", "refresh_token":
+	default:
+		return fail(http.StatusBadRequest, "unsupported grant type %q", form.Get("grant_type"))
+	}
+	token := "token-" + v.id()
+	v.tokens[token] = true
+	return ok(map[string]interface{}{
+		"access_token":  token,
+		"token_type":    "bearer",
+		"expires_in":    3600,
+		"refresh_token": "refresh-" + token,
+	})
+}
+
+// id returns a new unique ID in the format of a UUID
+func (v *Viya) id() string {
+	v.next++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", v.next)
+}
+
+// ok returns a successful response
+func ok(body interface{}) response {
+	return response{status: http.StatusOK, body: body}
+}
+
+// created returns the response for a created resource
+func created(body interface{}) response {
+	return response{status: http.StatusCreated, body: body}
+}
+
+// noContent returns a successful response without a body
+func noContent() response {
+	return response{status: http.StatusNoContent}
+}
+
+// fail returns an error response in the format of the SAS Viya REST APIs
+func fail(status int, format string, args ...interface{}) response {
+	return response{status: status, body: map[string]interface{}{
+		"errorCode":      status,
+		"message":        fmt.Sprintf(format, args...),
+		"details":        []string{},
+		"httpStatusCode": status,
+	}}
+}
+
+// notFound returns the error response for a missing resource
+func notFound(resource, id string) response {
+	return fail(http.StatusNotFound, "%s %s was not found", resource, id)
+}
+
+// notImplemented returns the error response for a request the fake does not serve
+func notImplemented(r *request) response {
+	return fail(http.StatusNotImplemented, "%s %s is not implemented by the fake", r.method, r.path)
+}
+
+// collection returns a page of the items matching the filter of the request
+func collection(r *request, items []map[string]interface{}) response {
+	var matching []map[string]interface{}
+	for _, item := range items {
+		matches, err := match(r.query.Get("filter"), item)
+		if err != nil {
+			return fail(http.StatusBadRequest, "%s", err)
+		}
+		if matches {
+			matching = append(matching, item)
+		}
+	}
+	start, _ := strconv.Atoi(r.query.Get("start"))
+	limit, err := strconv.Atoi(r.query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	page := []map[string]interface{}{}
+	for i := start; i < len(matching) && i < start+limit; i++ {
+		page = append(page, matching[i])
+	}
+	return ok(map[string]interface{}{
+		"count": len(matching),
+		"start": start,
+		"limit": limit,
+		"items": page,
+	})
+}
+
+// match reports whether an item matches a filter of the and, or and eq functions, e.g.
+// and(eq(principal,'HR'),eq(type,'grant')). An empty filter matches every item
+func match(filter string, item map[string]interface{}) (bool, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return true, nil
+	}
+	open := strings.Index(filter, "(")
+	if open < 0 || !strings.HasSuffix(filter, ")") {
+		return false, fmt.Errorf("invalid filter %s", filter)
+	}
+	args := split(filter[open+1 : len(filter)-1])
+	switch function := filter[:open]; function {
+	case "and", "or":
+		for _, arg := range args {
+			matches, err := match(arg, item)
+			if err != nil {
+				return false, err
+			}
+			if matches == (function == "or") {
+				return matches, nil
+			}
+		}
+		return function == "and", nil
+	case "eq":
+		if len(args) != 2 {
+			return false, fmt.Errorf("invalid filter %s", filter)
+		}
+		value, _ := item[unquote(args[0])].(string)
+		return value == unquote(args[1]), nil
+	default:
+		return false, fmt.Errorf("filter function %s is not implemented by the fake", function)
+	}
+}
+
+// split splits the arguments of a filter function at the commas outside of nested functions and quotes
+func split(args string) []string {
+	var parts []string
+	var depth int
+	var quote rune
+	var begin int
+	for i, c := range args {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(args[begin:i]))
+			begin = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(args[begin:]))
+}
+
+// unquote removes the single or double quotes around a filter argument
+func unquote(arg string) string {
+	if len(arg) >= 2 && (arg[0] == '\'' || arg[0] == '"') && arg[len(arg)-1] == arg[0] {
+		return arg[1 : len(arg)-1]
+	}
+	return arg
+}
+
+// object returns the JSON representation of a value as a collection item
+func object(value interface{}) map[string]interface{} {
+	var item map[string]interface{}
+	encoded, _ := json.Marshal(value)
+	json.Unmarshal(encoded, &item)
+	return item
+}
@@ -0,0 +1,232 @@
+// Copyright © 2021, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package viyatest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	au "github.com/sassoftware/sas-viya-authorization-model/authorization"
+	ca "github.com/sassoftware/sas-viya-authorization-model/cas"
+	co "github.com/sassoftware/sas-viya-authorization-model/connection"
+	fo "github.com/sassoftware/sas-viya-authorization-model/folder"
+	pr "github.com/sassoftware/sas-viya-authorization-model/principal"
+)
+
+// connect returns a connection to a fake or fails the test
+func connect(t *testing.T, v *Viya) *co.Connection {
+	c, err := v.Connection()
+	if err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	return c
+}
+
+func TestGroups(t *testing.T) {
+	v := New()
+	v.AddUser("alice", "Alice")
+	c := connect(t, v)
+	hr := &pr.Principal{ID: "HR", Name: "Human Resources", Type: "group", Connection: c}
+	persona := &pr.Principal{ID: "per001", Type: "group", Connection: c}
+	for _, p := range []*pr.Principal{hr, persona} {
+		if err := p.Create(); err != nil {
+			t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+		}
+	}
+	if err := hr.Create(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if err := (&pr.Principal{ID: "HR", Type: "group", Connection: c}).Create(); !co.IsStatus(err, http.StatusConflict) {
+		t.Errorf("Expected: %v, Returned: %v.", http.StatusConflict, err)
+	}
+	alice := &pr.Principal{ID: "alice", Type: "user", Connection: c}
+	if err := persona.NestIn(hr); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if err := alice.NestIn(persona); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if err := (&pr.Principal{ID: "bob", Type: "user", Connection: c}).NestIn(hr); !co.IsStatus(err, http.StatusNotFound) {
+		t.Errorf("Expected: %v, Returned: %v.", http.StatusNotFound, err)
+	}
+	groups, err := pr.Groups(c)
+	if err != nil || len(groups) != 2 || groups[0].ID != "HR" || groups[0].Name != "Human Resources" {
+		t.Errorf("Expected: %v, Returned: %v (%v).", "HR per001", groups, err)
+	}
+	if err := hr.GetMembers(); err != nil || len(hr.Members) != 2 || hr.Members[1].ID != "alice" {
+		t.Errorf("Expected: %v, Returned: %v (%v).", "per001 alice", hr.Members, err)
+	}
+	if err := alice.GetParents(); err != nil || len(alice.Parents) != 1 || alice.Parents[0].ID != "per001" {
+		t.Errorf("Expected: %v, Returned: %v (%v).", "per001", alice.Parents, err)
+	}
+	if err := persona.DeleteMember("user", "alice"); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if err := persona.Delete(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if expected := []Group{{"HR", "Human Resources", "Automatically created by goViyaAuth"}}; !reflect.DeepEqual(expected, v.Groups()) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, v.Groups())
+	}
+	if members := v.Members("HR"); len(members) != 0 {
+		t.Errorf("Expected: %v, Returned: %v.", nil, members)
+	}
+}
+
+func TestRules(t *testing.T) {
+	v := New()
+	c := connect(t, v)
+	hr := &pr.Principal{ID: "HR", Type: "group", Connection: c}
+	rule := &au.Authorization{Principal: hr, Type: "grant", Permissions: []string{"read"}, ContainerURI: "/folders/folders/a", Enabled: "true", Description: au.ManagedDescription}
+	if err := rule.Enable(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if comparison, err := rule.Compare(); err != nil || comparison.State != au.Identical {
+		t.Errorf("Expected: %v, Returned: %v (%v).", au.Identical, comparison.State, err)
+	}
+	rule.Permissions = []string{"read", "update"}
+	if comparison, _ := rule.Compare(); comparison.State != au.Differs {
+		t.Errorf("Expected: %v, Returned: %v.", au.Differs, comparison.State)
+	}
+	if err := rule.Update(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	rules := v.Rules()
+	if len(rules) != 1 || !reflect.DeepEqual(rules[0].Permissions, []string{"read", "update"}) || !rules[0].Enabled {
+		t.Errorf("Expected: %v, Returned: %v.", "read,update", rules)
+	}
+	// updates require the current ETag
+	if _, _, _, err := c.CallWithHeader("PUT", "/authorization/rules/"+rules[0].ID, "", "", nil, []byte(`{"principalType": "authenticatedUsers", "permissions": ["read"], "containerUri": "/folders/folders/a"}`), http.Header{"If-Match": {`"outdated"`}}); !co.IsStatus(err, http.StatusPreconditionFailed) {
+		t.Errorf("Expected: %v, Returned: %v.", http.StatusPreconditionFailed, err)
+	}
+	v.AddRule(Rule{PrincipalType: "authenticatedUsers", Type: "prohibit", Permissions: []string{"delete"}, ObjectURI: "/folders/folders/a/**"})
+	list, err := au.List(c, "eq(principalType,'authenticatedUsers')")
+	if err != nil || len(list) != 1 || list[0].Type != "prohibit" || list[0].Enabled != "false" {
+		t.Errorf("Expected: %v, Returned: %v (%v).", "prohibit", list, err)
+	}
+	if err := rule.Delete(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if rules := v.Rules(); len(rules) != 1 || rules[0].Type != "prohibit" {
+		t.Errorf("Expected: %v, Returned: %v.", "prohibit", rules)
+	}
+}
+
+func TestFolders(t *testing.T) {
+	v := New()
+	c := connect(t, v)
+	projects := &fo.Folder{Path: "/Projects", Connection: c}
+	hr := &fo.Folder{Path: "/Projects/HR", Parent: projects, Connection: c}
+	for _, f := range []*fo.Folder{projects, hr} {
+		if err := f.Validate(); err != nil || f.Exists {
+			t.Errorf("Expected: %v, Returned: %v (%v).", false, f.Exists, err)
+		}
+		if err := f.Create(); err != nil {
+			t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+		}
+	}
+	validated := &fo.Folder{Path: "/Projects/HR", Connection: c}
+	if err := validated.Validate(); err != nil || validated.URI != hr.URI {
+		t.Errorf("Expected: %v, Returned: %v (%v).", hr.URI, validated.URI, err)
+	}
+	children, err := projects.Children()
+	if err != nil || len(children) != 1 || children[0].Path != "/Projects/HR" {
+		t.Errorf("Expected: %v, Returned: %v (%v).", "/Projects/HR", children, err)
+	}
+	ancestors, err := fo.Ancestors(c, hr.URI)
+	if err != nil || len(ancestors) != 1 || ancestors[0].Path != "/Projects" || ancestors[0].URI != projects.URI {
+		t.Errorf("Expected: %v, Returned: %v (%v).", "/Projects", ancestors, err)
+	}
+	if err := projects.Delete(); !co.IsStatus(err, http.StatusConflict) {
+		t.Errorf("Expected: %v, Returned: %v.", http.StatusConflict, err)
+	}
+	if uri := v.AddFolder("/Projects/Finance/Reports"); len(v.Folders()) != 4 || v.Folders()[1].Path != "/Projects/Finance" || v.Folders()[2].URI != uri {
+		t.Errorf("Expected: %v, Returned: %v.", uri, v.Folders())
+	}
+	if err := projects.DeleteRecursive(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if folders := v.Folders(); len(folders) != 0 {
+		t.Errorf("Expected: %v, Returned: %v.", nil, folders)
+	}
+}
+
+func TestCASLIBs(t *testing.T) {
+	v := New()
+	v.AddCASLIB(CASLIB{Name: "HRDATA", Type: "PATH", Path: "/data/hr/", Controls: []ca.Control{{Identity: "Finance", IdentityType: "group", Permission: "select", Type: "grant"}}})
+	c := connect(t, v)
+	hr := &pr.Principal{ID: "HR", Type: "group"}
+	lib := &ca.LIB{Name: "HRDATA", Connection: c, ACL: []ca.AC{{Type: "grant", Permissions: []string{"select", "readInfo"}, Principal: hr}}}
+	if err := lib.Validate(); err != nil || !lib.Exists {
+		t.Errorf("Expected: %v, Returned: %v (%v).", true, lib.Exists, err)
+	}
+	if err := lib.Sync(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	expected := []ca.Control{{Identity: "HR", IdentityType: "group", Permission: "select", Type: "grant"}, {Identity: "HR", IdentityType: "group", Permission: "readInfo", Type: "grant"}}
+	if controls := v.CASLIBs()[0].Controls; !reflect.DeepEqual(expected, controls) {
+		t.Errorf("Expected: %v, Returned: %v.", expected, controls)
+	}
+	created := &ca.LIB{Name: "FINDATA", Type: "PATH", Path: "/data/fin/", Scope: "global", Connection: c}
+	if err := created.Create(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	caslibs, err := ca.List(c)
+	if err != nil || len(caslibs) != 2 || caslibs[0].Name != "FINDATA" {
+		t.Errorf("Expected: %v, Returned: %v (%v).", "FINDATA HRDATA", caslibs, err)
+	}
+	lib.ACL = nil
+	if err := lib.Remove(); err != nil {
+		t.Errorf("Expected: %v, Returned: %v.", nil, err)
+	}
+	if controls, err := lib.Controls(); err != nil || len(controls) != 0 {
+		t.Errorf("Expected: %v, Returned: %v (%v).", nil, controls, err)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	v := New()
+	v.AddGroup("HR", "Human Resources", "")
+	server := httptest.NewServer(v)
+	defer server.Close()
+	c := co.New(co.Options{BaseURL: server.URL, GrantType: "client_credentials", ClientSecret: "secret"})
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Expected: %v, Returned: %v.", nil, err)
+	}
+	defer c.Disconnect()
+	if groups, err := pr.Groups(c); err != nil || len(groups) != 1 {
+		t.Errorf("Expected: %v, Returned: %v (%v).", "HR", groups, err)
+	}
+	if _, err := au.Decisions(c, "alice", "/folders/folders/a"); !co.IsStatus(err, http.StatusNotImplemented) {
+		t.Errorf("Expected: %v, Returned: %v.", http.StatusNotImplemented, err)
+	}
+	if _, status, _ := (&co.Connection{BaseURL: server.URL, AccessToken: "invalid"}).Call("GET", "/identities/groups", "", "", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected: %v, Returned: %v.", http.StatusUnauthorized, status)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	item := map[string]interface{}{"principal": "HR", "type": "grant", "name": "HRDATA"}
+	var tests = []struct {
+		filter   string
+		expected bool
+	}{
+		{"", true},
+		{"eq(principal,'HR')", true},
+		{"and(eq(principal,'HR'),eq(type,'prohibit'))", false},
+		{"or(eq(principal,'Finance'),eq(type,'grant'))", true},
+		{`eq("name","HRDATA")`, true},
+		{"eq(principal,'a,b')", false},
+	}
+	for _, test := range tests {
+		if returned, err := match(test.filter, item); err != nil || returned != test.expected {
+			t.Errorf("Expected: %v, Returned: %v (%v).", test.expected, returned, err)
+		}
+	}
+	if _, err := match("startsWith(principal,'H')", item); err == nil {
+		t.Errorf("Expected: %v, Returned: %v.", "unsupported filter error", err)
+	}
+}